@@ -0,0 +1,450 @@
+// Package analysis runs data-flow analyses over the functions of a memory image: which definitions of every register
+// reach the instructions that read it, which values registers can hold, the memory addresses and jump targets that
+// resolve to constants, and which functions read a register before writing it, like the r7 the teleporter checks.
+//
+// Functions are found by following calls from the entry points, including calls through registers that hold a
+// constant. The analyses are per function and only look at the registers: memory, the stack and input are unknown.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ckyong/synacor/decompiler"
+)
+
+const (
+	opSet  = 1
+	opPush = 2
+	opPop  = 3
+	opJmp  = 6
+	opJt   = 7
+	opJf   = 8
+	opRmem = 15
+	opWmem = 16
+	opCall = 17
+	opRet  = 18
+	opIn   = 20
+)
+
+// Definition is the instruction that last wrote a register, or the function entry for the value the register had when
+// the function was called.
+type Definition struct {
+	Address uint16 `json:"address"`
+	Entry   bool   `json:"entry,omitempty"`
+}
+
+func (definition Definition) String() string {
+	if definition.Entry {
+		return "entry"
+	}
+	return fmt.Sprint(definition.Address)
+}
+
+// Instruction is an instruction of a function with what the analyses know about it.
+type Instruction struct {
+	Address uint16 `json:"address"`
+	Text    string `json:"text"`
+	// Definitions that reach the registers the instruction reads, by register name. For a call these include the
+	// registers the called function reads.
+	Reaching map[string][]Definition `json:"reaching,omitempty"`
+	// Values the registers the instruction reads can hold, by register name, leaving out registers that can hold
+	// anything.
+	Ranges map[string]Range `json:"ranges,omitempty"`
+	// The address rmem or wmem accesses through a register, if the register holds a constant.
+	Memory *uint16 `json:"memory,omitempty"`
+	// Where jmp, jt, jf or call through a register goes, if the register holds a constant.
+	Target *uint16 `json:"target,omitempty"`
+}
+
+type Function struct {
+	Entry uint16 `json:"entry"`
+	// Registers read before they are written, directly or by a called function.
+	Reads []string `json:"reads"`
+	// Registers the function or a function it calls may write.
+	Writes       []string       `json:"writes"`
+	Calls        []uint16       `json:"calls"`
+	Instructions []*Instruction `json:"instructions"`
+	// Why the function could not be analysed.
+	Err string `json:"error,omitempty"`
+
+	cfg    *decompiler.Function
+	reads  [8]bool
+	writes [8]bool
+	// Definitions reaching the registers at every instruction, and the values the registers can hold there.
+	reaching map[uint16][8]definitions
+	ranges   map[uint16]registers
+}
+
+type Program struct {
+	Functions []*Function `json:"functions"`
+	// Entries of the functions that read r7 before writing it.
+	ReadR7    []uint16 `json:"reads_r7"`
+	functions map[uint16]*Function
+}
+
+// Function returns the function that starts at entry, or nil if there is none.
+func (program *Program) Function(entry uint16) *Function {
+	return program.functions[entry]
+}
+
+// Entries returns the likely function entries of a memory image: 0, the target of every call to an address, and, as
+// most functions are only called through registers, the start of code that follows a ret and is not already part of
+// another function.
+func Entries(memory []uint16) []uint16 {
+	entries := []uint16{0}
+	var followReturns []uint16
+	afterReturn := false
+	for address := 0; address < len(memory); {
+		ins, err := decompiler.Decode(memory, uint16(address))
+		if err != nil {
+			address, afterReturn = address+1, false
+			continue
+		}
+		if afterReturn {
+			followReturns = append(followReturns, ins.Address)
+		}
+		if ins.Op == opCall && !decompiler.IsRegister(ins.Operands[0]) {
+			entries = append(entries, ins.Operands[0])
+		}
+		address, afterReturn = address+1+len(ins.Operands), ins.Op == opRet
+	}
+
+	covered := map[uint16]bool{}
+	cover := func(entry uint16) bool {
+		if covered[entry] {
+			return false
+		}
+		cfg, err := decompiler.BuildFunction(memory, entry)
+		if err != nil {
+			return false
+		}
+		for _, block := range cfg.Blocks {
+			for _, ins := range block.Instructions {
+				covered[ins.Address] = true
+			}
+		}
+		return true
+	}
+	seen := map[uint16]bool{}
+	result := []uint16{}
+	for _, entry := range entries {
+		if !seen[entry] {
+			seen[entry] = true
+			cover(entry)
+			result = append(result, entry)
+		}
+	}
+	for _, entry := range followReturns {
+		if cover(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Analyze finds every function that can be called from entries and analyses them.
+//
+// Calls the analysis cannot resolve are assumed to write every register and to read none, so that a call through a
+// table does not make every function read r7.
+func Analyze(memory []uint16, entries ...uint16) *Program {
+	program := &Program{functions: map[uint16]*Function{}}
+	pending := append([]uint16{}, entries...)
+	for len(pending) > 0 {
+		for _, entry := range pending {
+			if program.functions[entry] != nil {
+				continue
+			}
+			function := &Function{Entry: entry}
+			program.functions[entry] = function
+			if cfg, err := decompiler.BuildFunction(memory, entry); err != nil {
+				function.Err = err.Error()
+			} else {
+				function.cfg = cfg
+			}
+		}
+		pending = nil
+
+		program.summarizeWrites()
+		for _, function := range program.functions {
+			if function.cfg != nil {
+				function.reaching = program.reachingDefinitions(function)
+				function.ranges = program.valueRanges(function)
+			}
+		}
+
+		// Constant targets of calls through registers may be functions nobody calls directly.
+		for _, function := range program.functions {
+			function.Calls = program.calls(function)
+			for _, callee := range function.Calls {
+				if program.functions[callee] == nil {
+					pending = append(pending, callee)
+				}
+			}
+		}
+	}
+
+	program.summarizeReads()
+	for _, function := range program.functions {
+		program.Functions = append(program.Functions, function)
+		function.Reads, function.Writes = names(function.reads), names(function.writes)
+		if function.cfg != nil {
+			function.Instructions = program.instructions(function)
+		}
+		if function.reads[7] {
+			program.ReadR7 = append(program.ReadR7, function.Entry)
+		}
+	}
+	sort.Slice(program.Functions, func(i, j int) bool { return program.Functions[i].Entry < program.Functions[j].Entry })
+	sort.Slice(program.ReadR7, func(i, j int) bool { return program.ReadR7[i] < program.ReadR7[j] })
+	return program
+}
+
+func names(registers [8]bool) []string {
+	result := []string{}
+	for r, set := range registers {
+		if set {
+			result = append(result, fmt.Sprintf("r%v", r))
+		}
+	}
+	return result
+}
+
+// Returns every instruction of the function in order of address.
+func (function *Function) instructions() []decompiler.Instruction {
+	var result []decompiler.Instruction
+	for _, block := range function.cfg.Blocks {
+		result = append(result, block.Instructions...)
+	}
+	return result
+}
+
+// Returns the register ins writes, if any. Instructions that take a destination always have it first.
+func destination(ins decompiler.Instruction) (uint16, bool) {
+	switch ins.Op {
+	case 1, 3, 4, 5, 9, 10, 11, 12, 13, 14, 15, 20:
+		if decompiler.IsRegister(ins.Operands[0]) {
+			return ins.Operands[0] - 32768, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the registers ins reads itself.
+func uses(ins decompiler.Instruction) []uint16 {
+	operands := ins.Operands
+	if _, ok := destination(ins); ok || ins.Op == opPop || ins.Op == opIn {
+		operands = operands[1:]
+	}
+	var result []uint16
+	for _, operand := range operands {
+		if decompiler.IsRegister(operand) {
+			result = append(result, operand-32768)
+		}
+	}
+	return result
+}
+
+// Returns the function a call goes to, if it is constant.
+func (program *Program) callee(function *Function, ins decompiler.Instruction) (uint16, bool) {
+	if !decompiler.IsRegister(ins.Operands[0]) {
+		return ins.Operands[0], true
+	}
+	value := function.ranges[ins.Address][ins.Operands[0]-32768]
+	return value.Min, value.constant()
+}
+
+// Returns the functions the function calls, in order, once its ranges are known.
+func (program *Program) calls(function *Function) []uint16 {
+	if function.cfg == nil {
+		return []uint16{}
+	}
+	seen := map[uint16]bool{}
+	result := []uint16{}
+	for _, ins := range function.instructions() {
+		if ins.Op != opCall {
+			continue
+		}
+		if callee, ok := program.callee(function, ins); ok && !seen[callee] {
+			seen[callee] = true
+			result = append(result, callee)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Returns the registers a call may write: those of the function it calls, or all of them if it is not known.
+func (program *Program) callWrites(function *Function, ins decompiler.Instruction) [8]bool {
+	if callee, ok := program.callee(function, ins); ok && program.functions[callee] != nil && program.functions[callee].cfg != nil {
+		return program.functions[callee].writes
+	}
+	return [8]bool{true, true, true, true, true, true, true, true}
+}
+
+// Works out the registers every function may write, including through the functions it calls, until nothing changes.
+func (program *Program) summarizeWrites() {
+	for changed := true; changed; {
+		changed = false
+		for _, function := range program.functions {
+			writes := function.writes
+			if function.cfg == nil {
+				writes = [8]bool{true, true, true, true, true, true, true, true}
+			} else {
+				for _, ins := range function.instructions() {
+					if r, ok := destination(ins); ok {
+						writes[r] = true
+					}
+					if ins.Op == opCall {
+						for r, written := range program.callWrites(function, ins) {
+							writes[r] = writes[r] || written
+						}
+					}
+				}
+			}
+			if writes != function.writes {
+				function.writes, changed = writes, true
+			}
+		}
+	}
+}
+
+// Returns the registers ins reads, including the ones the function it calls reads.
+func (program *Program) reads(function *Function, ins decompiler.Instruction) []uint16 {
+	read := [8]bool{}
+	for _, r := range uses(ins) {
+		read[r] = true
+	}
+	if ins.Op == opCall {
+		if callee, ok := program.callee(function, ins); ok && program.functions[callee] != nil {
+			for r, reads := range program.functions[callee].reads {
+				read[r] = read[r] || reads
+			}
+		}
+	}
+	var result []uint16
+	for r, isRead := range read {
+		if isRead {
+			result = append(result, uint16(r))
+		}
+	}
+	return result
+}
+
+// Works out the registers every function reads before writing them: the ones whose value at the entry reaches an
+// instruction that reads them, until nothing changes. Saving a register with push is not reading it, otherwise every
+// function that saves r7 would read it.
+func (program *Program) summarizeReads() {
+	for changed := true; changed; {
+		changed = false
+		for _, function := range program.functions {
+			if function.cfg == nil {
+				continue
+			}
+			reads := function.reads
+			for _, ins := range function.instructions() {
+				if ins.Op == opPush {
+					continue
+				}
+				for _, r := range program.reads(function, ins) {
+					reads[r] = reads[r] || function.reaching[ins.Address][r].entry
+				}
+			}
+			if reads != function.reads {
+				function.reads, changed = reads, true
+			}
+		}
+	}
+}
+
+// Collects what the analyses found out about every instruction of the function.
+func (program *Program) instructions(function *Function) []*Instruction {
+	var result []*Instruction
+	for _, ins := range function.instructions() {
+		text := strings.TrimPrefix(ins.String(), fmt.Sprintf("%v: ", ins.Address))
+		for _, operand := range ins.Operands {
+			if decompiler.IsRegister(operand) {
+				text = strings.Replace(text, fmt.Sprint(operand), decompiler.RegisterName(operand), 1)
+			}
+		}
+		annotated := &Instruction{Address: ins.Address, Text: text}
+
+		registers := function.ranges[ins.Address]
+		for _, r := range program.reads(function, ins) {
+			name := fmt.Sprintf("r%v", r)
+			if annotated.Reaching == nil {
+				annotated.Reaching, annotated.Ranges = map[string][]Definition{}, map[string]Range{}
+			}
+			annotated.Reaching[name] = function.reaching[ins.Address][r].list(function.Entry)
+			if !registers[r].full() {
+				annotated.Ranges[name] = registers[r]
+			}
+		}
+
+		value := func(operand uint16) *uint16 {
+			if !decompiler.IsRegister(operand) {
+				return nil
+			}
+			if known := registers[operand-32768]; known.constant() {
+				return &known.Min
+			}
+			return nil
+		}
+		switch ins.Op {
+		case opRmem:
+			annotated.Memory = value(ins.Operands[1])
+		case opWmem:
+			annotated.Memory = value(ins.Operands[0])
+		case opJmp, opCall:
+			annotated.Target = value(ins.Operands[0])
+		case opJt, opJf:
+			annotated.Target = value(ins.Operands[1])
+		}
+		result = append(result, annotated)
+	}
+	return result
+}
+
+// Notes returns a comment for every analysed instruction, to annotate a listing with: the values and definitions of
+// the registers it reads, the memory it accesses and where it jumps. Function entries also say which registers the
+// function reads.
+func (program *Program) Notes() map[uint16]string {
+	notes := map[uint16]string{}
+	for _, function := range program.Functions {
+		for _, ins := range function.Instructions {
+			var parts []string
+			if ins.Address == function.Entry && len(function.Reads) > 0 {
+				parts = append(parts, "function reads "+strings.Join(function.Reads, " "))
+			}
+
+			registers := make([]string, 0, len(ins.Reaching))
+			for name := range ins.Reaching {
+				registers = append(registers, name)
+			}
+			sort.Strings(registers)
+			for _, name := range registers {
+				part := name
+				if value, ok := ins.Ranges[name]; ok {
+					part += " " + value.String()
+				}
+				definitions := make([]string, len(ins.Reaching[name]))
+				for i, definition := range ins.Reaching[name] {
+					definitions[i] = definition.String()
+				}
+				parts = append(parts, part+" from "+strings.Join(definitions, ","))
+			}
+
+			if ins.Memory != nil {
+				parts = append(parts, fmt.Sprintf("memory %v", *ins.Memory))
+			}
+			if ins.Target != nil {
+				parts = append(parts, fmt.Sprintf("to %v", *ins.Target))
+			}
+			if len(parts) > 0 {
+				notes[ins.Address] = strings.Join(parts, "; ")
+			}
+		}
+	}
+	return notes
+}
@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+var program = assembler.MustAssemble(`
+	set r0 3
+	jt r1 other
+	set r0 5
+other:
+	add r2 r0 1
+	set r1 helper
+	call r1
+	set r3 table
+	rmem r4 r3
+	set r5 done
+	jmp r5
+	out 'x'
+done:
+	halt
+helper:
+	push r7
+	add r0 r7 1
+	pop r7
+	ret
+table:
+	data 7
+`)
+
+const (
+	other  = 9
+	call   = 16
+	rmem   = 21
+	jmp    = 27
+	done   = 31
+	helper = 32
+	table  = 41
+)
+
+// Returns the analysed instruction at address.
+func instruction(t *testing.T, function *Function, address uint16) *Instruction {
+	for _, ins := range function.Instructions {
+		if ins.Address == address {
+			return ins
+		}
+	}
+	t.Fatalf("no instruction at %v in %v", address, function.Entry)
+	return nil
+}
+
+func TestAnalyze(t *testing.T) {
+	analysed := Analyze(program, 0)
+	main, called := analysed.Function(0), analysed.Function(helper)
+	if len(analysed.Functions) != 2 || main == nil || called == nil {
+		t.Fatalf("expected the call through r1 to find the helper, got %v", analysed.Functions)
+	}
+	if !reflect.DeepEqual(analysed.ReadR7, []uint16{0, helper}) {
+		t.Errorf("expected the helper and its caller to read r7, got %v", analysed.ReadR7)
+	}
+	if !reflect.DeepEqual(called.Reads, []string{"r7"}) || !reflect.DeepEqual(called.Writes, []string{"r0", "r7"}) {
+		t.Errorf("expected the helper to read r7 and write r0 and r7, got %v and %v", called.Reads, called.Writes)
+	}
+	if !reflect.DeepEqual(main.Reads, []string{"r1", "r7"}) {
+		t.Errorf("expected the caller to read r1 and r7, got %v", main.Reads)
+	}
+
+	add := instruction(t, main, other)
+	if definitions := add.Reaching["r0"]; !reflect.DeepEqual(definitions, []Definition{{Address: 0}, {Address: 6}}) {
+		t.Errorf("expected both sets of r0 to reach the add, got %v", definitions)
+	}
+	if add.Ranges["r0"] != (Range{Min: 3, Max: 5}) || add.Text != "add r2 r0 1" {
+		t.Errorf("expected r0 from 3 to 5, got %v for %v", add.Ranges, add.Text)
+	}
+	if note := analysed.Notes()[other]; note != "r0 in 3..5 from 0,6" {
+		t.Errorf("unexpected note %q", note)
+	}
+
+	if ins := instruction(t, main, call); ins.Target == nil || *ins.Target != helper || ins.Reaching["r7"][0] != (Definition{Entry: true}) {
+		t.Errorf("expected the call to go to the helper with r7 from the entry, got %+v", ins)
+	}
+	if ins := instruction(t, main, rmem); ins.Memory == nil || *ins.Memory != table {
+		t.Errorf("expected rmem to read the table, got %+v", ins)
+	}
+	if ins := instruction(t, main, jmp); ins.Target == nil || *ins.Target != done {
+		t.Errorf("expected jmp to go to done, got %+v", ins)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	for _, test := range []struct {
+		min, max int
+		expected Range
+	}{
+		{0, 10, Range{Min: 0, Max: 10}},
+		{32770, 32780, Range{Min: 2, Max: 12}},
+		{32760, 32780, Range{Min: 0, Max: 32767}},
+	} {
+		if result := modulo(test.min, test.max); result != test.expected {
+			t.Errorf("%v to %v: expected %v, got %v", test.min, test.max, test.expected, result)
+		}
+	}
+	if mask(0) != 0 || mask(5) != 7 || mask(8) != 15 || mask(65535) != 65535 {
+		t.Errorf("unexpected masks")
+	}
+
+	// Counts to 30000, which widening gets through without visiting the loop 30000 times.
+	loop := Analyze(assembler.MustAssemble(`
+	set r0 0
+loop:
+	add r0 r0 1
+	mod r2 r0 8
+	gt r1 r0 30000
+	jf r1 loop
+	halt
+`), 0).Function(0)
+	if mod := instruction(t, loop, 7); mod.Ranges["r0"] != (Range{Min: 0, Max: 32767}) {
+		t.Errorf("expected r0 to be any number below 32768, got %v", mod.Ranges)
+	}
+	if jf := instruction(t, loop, 15); jf.Ranges["r1"] != (Range{Min: 0, Max: 1}) {
+		t.Errorf("expected r1 to be 0 or 1, got %v", jf.Ranges)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := vm.DumpMemory()
+	analysed := Analyze(memory[:], Entries(memory[:])...)
+	// The teleporter checks r7 itself at 5451 and the confirmation function uses it at 6042.
+	for _, entry := range []uint16{5445, 6027} {
+		found := false
+		for _, reader := range analysed.ReadR7 {
+			found = found || reader == entry
+		}
+		if !found {
+			t.Errorf("expected %v to read r7, got %v", entry, analysed.ReadR7)
+		}
+	}
+	if reads := analysed.Function(6027).Reads; !reflect.DeepEqual(reads, []string{"r0", "r1", "r7"}) {
+		t.Errorf("expected the confirmation function to read r0, r1 and r7, got %v", reads)
+	}
+	// See teleporter.CallSite.
+	if call := instruction(t, analysed.Function(5445), 5489); call.Ranges["r0"] != (Range{Min: 4, Max: 4}) || call.Ranges["r1"] != (Range{Min: 1, Max: 1}) {
+		t.Errorf("expected the confirmation to be called with 4 and 1, got %v", call.Ranges)
+	}
+}
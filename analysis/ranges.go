@@ -0,0 +1,241 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/ckyong/synacor/decompiler"
+)
+
+// Range is the values from Min to Max a register can hold. Registers usually hold numbers below 32768, but rmem can
+// load any word into them.
+type Range struct {
+	Min uint16 `json:"min"`
+	Max uint16 `json:"max"`
+}
+
+var everything = Range{Min: 0, Max: 65535}
+
+// Blocks are visited this many times before the ranges that keep growing in them are widened to everything, so that a
+// loop counting to 30000 does not take 30000 rounds.
+const widenAfter = 4
+
+func (r Range) constant() bool {
+	return r.Min == r.Max
+}
+
+func (r Range) full() bool {
+	return r == everything
+}
+
+func (r Range) String() string {
+	if r.constant() {
+		return fmt.Sprintf("= %v", r.Min)
+	}
+	return fmt.Sprintf("in %v..%v", r.Min, r.Max)
+}
+
+func (r Range) join(other Range) Range {
+	if other.Min < r.Min {
+		r.Min = other.Min
+	}
+	if other.Max > r.Max {
+		r.Max = other.Max
+	}
+	return r
+}
+
+// Returns r with whichever bound next goes past moved to the end.
+func (r Range) widen(next Range) Range {
+	if next.Min < r.Min {
+		r.Min = 0
+	}
+	if next.Max > r.Max {
+		r.Max = everything.Max
+	}
+	return r
+}
+
+func constant(value uint16) Range {
+	return Range{Min: value, Max: value}
+}
+
+// Returns the values of a result from min to max modulo 32768.
+func modulo(min, max int) Range {
+	wraps := min / 32768
+	if max/32768 != wraps {
+		return Range{Min: 0, Max: 32767}
+	}
+	return Range{Min: uint16(min - wraps*32768), Max: uint16(max - wraps*32768)}
+}
+
+// Returns the smallest number with every bit set that is at least value.
+func mask(value uint16) uint16 {
+	result := uint16(0)
+	for result < value {
+		result = result<<1 | 1
+	}
+	return result
+}
+
+// The values every register can hold at an instruction.
+type registers [8]Range
+
+func (state *registers) value(operand uint16) Range {
+	if decompiler.IsRegister(operand) {
+		return state[operand-32768]
+	}
+	return constant(operand)
+}
+
+// Updates the ranges past ins.
+func (program *Program) evaluate(function *Function, ins decompiler.Instruction, state *registers) {
+	if ins.Op == opCall {
+		for r, written := range program.callWrites(function, ins) {
+			if written {
+				state[r] = everything
+			}
+		}
+		return
+	}
+	r, ok := destination(ins)
+	if !ok {
+		return
+	}
+
+	var a, b Range
+	if len(ins.Operands) > 1 {
+		a = state.value(ins.Operands[1])
+	}
+	if len(ins.Operands) > 2 {
+		b = state.value(ins.Operands[2])
+	}
+	both := a.constant() && b.constant()
+
+	result := everything
+	switch ins.Op {
+	case opSet:
+		result = a
+	case 4:
+		switch {
+		case both:
+			result = constant(0)
+			if a.Min == b.Min {
+				result = constant(1)
+			}
+		case a.Max < b.Min || b.Max < a.Min:
+			result = constant(0)
+		default:
+			result = Range{Min: 0, Max: 1}
+		}
+	case 5:
+		switch {
+		case a.Min > b.Max:
+			result = constant(1)
+		case a.Max <= b.Min:
+			result = constant(0)
+		default:
+			result = Range{Min: 0, Max: 1}
+		}
+	case 9:
+		result = modulo(int(a.Min)+int(b.Min), int(a.Max)+int(b.Max))
+	case 10:
+		result = modulo(int(a.Min)*int(b.Min), int(a.Max)*int(b.Max))
+	case 11:
+		switch {
+		case b.Max == 0:
+			// Divides by zero, which faults.
+		case both:
+			result = constant(a.Min % b.Min)
+		case a.Max < b.Min:
+			result = a
+		default:
+			result = Range{Min: 0, Max: b.Max - 1}
+			if a.Max < result.Max {
+				result.Max = a.Max
+			}
+		}
+	case 12:
+		if both {
+			result = constant(a.Min & b.Min)
+		} else {
+			result = Range{Min: 0, Max: a.Max}
+			if b.Max < result.Max {
+				result.Max = b.Max
+			}
+		}
+	case 13:
+		if both {
+			result = constant(a.Min | b.Min)
+		} else {
+			result = a.join(b)
+			result.Min = a.Min
+			if b.Min > result.Min {
+				result.Min = b.Min
+			}
+			result.Max = mask(result.Max)
+		}
+	case 14:
+		if a.Max <= 32767 {
+			result = Range{Min: 32767 - a.Max, Max: 32767 - a.Min}
+		} else {
+			result = Range{Min: 0, Max: 32767}
+		}
+	case opIn:
+		result = Range{Min: 0, Max: 255}
+	}
+	state[r] = result
+}
+
+// Returns the values every register can hold at each instruction of the function, knowing nothing about them at the
+// entry.
+func (program *Program) valueRanges(function *Function) map[uint16]registers {
+	in := map[*decompiler.Block]*registers{}
+	visits := map[*decompiler.Block]int{}
+	entry := function.cfg.Block(function.Entry)
+	in[entry] = &registers{everything, everything, everything, everything, everything, everything, everything, everything}
+
+	pending := []*decompiler.Block{entry}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		state := *in[block]
+		for _, ins := range block.Instructions {
+			program.evaluate(function, ins, &state)
+		}
+
+		for _, succ := range block.Succs {
+			previous := in[succ]
+			if previous == nil {
+				next := state
+				in[succ] = &next
+				pending = append(pending, succ)
+				continue
+			}
+			next := *previous
+			for r := range next {
+				next[r] = next[r].join(state[r])
+				if visits[succ] >= widenAfter {
+					next[r] = previous[r].widen(next[r])
+				}
+			}
+			if next != *previous {
+				in[succ] = &next
+				visits[succ]++
+				pending = append(pending, succ)
+			}
+		}
+	}
+
+	result := map[uint16]registers{}
+	for _, block := range function.cfg.Blocks {
+		if in[block] == nil {
+			continue
+		}
+		state := *in[block]
+		for _, ins := range block.Instructions {
+			result[ins.Address] = state
+			program.evaluate(function, ins, &state)
+		}
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"github.com/ckyong/synacor/decompiler"
+)
+
+// The definitions of a register that may reach an instruction: the addresses of instructions that write it, in order,
+// and whether the value it had at the entry of the function can still be there.
+type definitions struct {
+	entry bool
+	at    []uint16
+}
+
+func (d definitions) union(other definitions) definitions {
+	result := definitions{entry: d.entry || other.entry}
+	i, j := 0, 0
+	for i < len(d.at) || j < len(other.at) {
+		switch {
+		case j == len(other.at) || (i < len(d.at) && d.at[i] < other.at[j]):
+			result.at = append(result.at, d.at[i])
+			i++
+		case i == len(d.at) || other.at[j] < d.at[i]:
+			result.at = append(result.at, other.at[j])
+			j++
+		default:
+			result.at = append(result.at, d.at[i])
+			i, j = i+1, j+1
+		}
+	}
+	return result
+}
+
+func (d definitions) equal(other definitions) bool {
+	if d.entry != other.entry || len(d.at) != len(other.at) {
+		return false
+	}
+	for i := range d.at {
+		if d.at[i] != other.at[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d definitions) list(entry uint16) []Definition {
+	var result []Definition
+	if d.entry {
+		result = append(result, Definition{Address: entry, Entry: true})
+	}
+	for _, address := range d.at {
+		result = append(result, Definition{Address: address})
+	}
+	return result
+}
+
+// Updates the definitions past ins. A call may or may not write the registers the called function writes, so it adds
+// itself to their definitions rather than replacing them.
+func (program *Program) defineAfter(function *Function, ins decompiler.Instruction, state *[8]definitions) {
+	if r, ok := destination(ins); ok {
+		state[r] = definitions{at: []uint16{ins.Address}}
+	}
+	if ins.Op == opCall {
+		for r, written := range program.callWrites(function, ins) {
+			if written {
+				state[r] = state[r].union(definitions{at: []uint16{ins.Address}})
+			}
+		}
+	}
+}
+
+// Returns the definitions of every register that reach each instruction of the function.
+func (program *Program) reachingDefinitions(function *Function) map[uint16][8]definitions {
+	start := [8]definitions{}
+	for r := range start {
+		start[r].entry = true
+	}
+
+	out := map[*decompiler.Block]*[8]definitions{}
+	in := func(block *decompiler.Block) [8]definitions {
+		var state [8]definitions
+		if block.Start == function.Entry {
+			state = start
+		}
+		for _, pred := range block.Preds {
+			if out[pred] != nil {
+				for r := range state {
+					state[r] = state[r].union(out[pred][r])
+				}
+			}
+		}
+		return state
+	}
+
+	pending := append([]*decompiler.Block{}, function.cfg.Blocks...)
+	queued := map[*decompiler.Block]bool{}
+	for _, block := range pending {
+		queued[block] = true
+	}
+	for len(pending) > 0 {
+		block := pending[0]
+		pending, queued[block] = pending[1:], false
+		state := in(block)
+		for _, ins := range block.Instructions {
+			program.defineAfter(function, ins, &state)
+		}
+		if previous := out[block]; previous != nil && equalDefinitions(*previous, state) {
+			continue
+		}
+		out[block] = &state
+		for _, succ := range block.Succs {
+			if !queued[succ] {
+				pending, queued[succ] = append(pending, succ), true
+			}
+		}
+	}
+
+	result := map[uint16][8]definitions{}
+	for _, block := range function.cfg.Blocks {
+		state := in(block)
+		for _, ins := range block.Instructions {
+			result[ins.Address] = state
+			program.defineAfter(function, ins, &state)
+		}
+	}
+	return result
+}
+
+func equalDefinitions(a, b [8]definitions) bool {
+	for r := range a {
+		if !a[r].equal(b[r]) {
+			return false
+		}
+	}
+	return true
+}
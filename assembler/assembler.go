@@ -0,0 +1,148 @@
+// Package assembler turns Synacor assembly text into a memory image.
+//
+// Every line holds at most one instruction, written as its mnemonic followed by its operands, the same way the
+// disassembler prints them. Operands are r0 to r7, numbers, character literals such as 'a', or labels. A label is a
+// name followed by a colon and may stand on its own line or in front of an instruction. Everything after a ; is a
+// comment. The data directive emits its operands as raw words.
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("line %v: %v", err.Line, err.Message)
+}
+
+var opCodes = map[string]uint16{}
+
+func init() {
+	for op, name := range VirtualMachine.OpNames {
+		opCodes[name] = op
+	}
+}
+
+// An operand that refers to a label, filled in once every label is known.
+type fixup struct {
+	address uint16
+	label   string
+	line    int
+}
+
+// Assemble returns the program described by source, starting at address 0.
+func Assemble(source string) ([]uint16, error) {
+	var program []uint16
+	var fixups []fixup
+	labels := map[string]uint16{}
+
+	for i, text := range strings.Split(source, "\n") {
+		line := i + 1
+		if comment := strings.Index(text, ";"); comment >= 0 && !inCharacter(text, comment) {
+			text = text[:comment]
+		}
+
+		// A space is the only character that would otherwise be split in two.
+		fields := strings.Fields(strings.ReplaceAll(text, "' '", "32"))
+		for len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			label := strings.TrimSuffix(fields[0], ":")
+			if _, ok := labels[label]; ok {
+				return nil, &SyntaxError{Line: line, Message: fmt.Sprintf("label %v defined twice", label)}
+			}
+			labels[label] = uint16(len(program))
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		mnemonic := strings.ToLower(fields[0])
+		operands := fields[1:]
+		if mnemonic == "data" {
+			if len(operands) == 0 {
+				return nil, &SyntaxError{Line: line, Message: "data needs at least one value"}
+			}
+		} else {
+			op, ok := opCodes[mnemonic]
+			if !ok {
+				return nil, &SyntaxError{Line: line, Message: fmt.Sprintf("unknown instruction %v", fields[0])}
+			}
+			if len(operands) != int(VirtualMachine.OpArgs[op]) {
+				return nil, &SyntaxError{Line: line, Message: fmt.Sprintf("%v takes %v operands, got %v", mnemonic, VirtualMachine.OpArgs[op], len(operands))}
+			}
+			program = append(program, op)
+		}
+
+		for _, operand := range operands {
+			value, isLabel, err := parseOperand(operand)
+			if err != nil {
+				return nil, &SyntaxError{Line: line, Message: err.Error()}
+			}
+			if isLabel {
+				fixups = append(fixups, fixup{address: uint16(len(program)), label: operand, line: line})
+			}
+			program = append(program, value)
+		}
+	}
+
+	for _, f := range fixups {
+		address, ok := labels[f.label]
+		if !ok {
+			return nil, &SyntaxError{Line: f.line, Message: fmt.Sprintf("unknown label %v", f.label)}
+		}
+		program[f.address] = address
+	}
+
+	if len(program) > 32768 {
+		return nil, &SyntaxError{Message: "program does not fit in memory"}
+	}
+	return program, nil
+}
+
+// MustAssemble is like Assemble but panics on errors, for programs written out in Go source.
+func MustAssemble(source string) []uint16 {
+	program, err := Assemble(source)
+	if err != nil {
+		panic(err)
+	}
+	return program
+}
+
+// Returns the encoded value of an operand, or reports that it is a label to be filled in later.
+func parseOperand(operand string) (uint16, bool, error) {
+	lower := strings.ToLower(operand)
+	if len(lower) == 2 && lower[0] == 'r' && lower[1] >= '0' && lower[1] <= '7' {
+		return 32768 + uint16(lower[1]-'0'), false, nil
+	}
+
+	if strings.HasPrefix(operand, "'") {
+		char, err := strconv.Unquote(operand)
+		if err != nil || len(char) != 1 {
+			return 0, false, fmt.Errorf("invalid character %v", operand)
+		}
+		return uint16(char[0]), false, nil
+	}
+
+	if operand[0] >= '0' && operand[0] <= '9' {
+		value, err := strconv.ParseUint(operand, 0, 16)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid number %v", operand)
+		}
+		return uint16(value), false, nil
+	}
+
+	return 0, true, nil
+}
+
+// Whether the ; at index is part of a character literal such as ';'.
+func inCharacter(text string, index int) bool {
+	return index > 0 && index+1 < len(text) && text[index-1] == '\'' && text[index+1] == '\''
+}
@@ -0,0 +1,189 @@
+// Package bruteforce tries a range of values for a register or a word of Memory, each on its own clone of a VM restored
+// from a snapshot, and reports the values for which the clone reaches a goal.
+package bruteforce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Location is one of the registers r0 to r7, or an address in Memory.
+type Location struct {
+	Register bool
+	Index    uint16
+}
+
+// ParseLocation reads a register, r0 to r7, or an address.
+func ParseLocation(text string) (Location, error) {
+	if strings.HasPrefix(text, "r") {
+		register, err := strconv.ParseUint(text[1:], 10, 16)
+		if err != nil || register > 7 {
+			return Location{}, fmt.Errorf("%q is not a register", text)
+		}
+		return Location{Register: true, Index: uint16(register)}, nil
+	}
+
+	address, err := strconv.ParseUint(text, 10, 16)
+	if err != nil || address > 32767 {
+		return Location{}, fmt.Errorf("%q is neither a register nor an address", text)
+	}
+	return Location{Index: uint16(address)}, nil
+}
+
+func (location Location) String() string {
+	if location.Register {
+		return fmt.Sprintf("r%v", location.Index)
+	}
+	return fmt.Sprint(location.Index)
+}
+
+func (location Location) set(vm *VirtualMachine.VirtualMachine, value uint16) {
+	if location.Register {
+		vm.Register[location.Index] = value
+	} else {
+		vm.Memory.Set(location.Index, value)
+	}
+}
+
+// Goal reports whether a candidate has succeeded. It is checked after every instruction, with everything the candidate
+// has printed so far.
+type Goal func(vm *VirtualMachine.VirtualMachine, output []byte) bool
+
+// Reaches is the goal of executing the instruction at address.
+func Reaches(address uint16) Goal {
+	return func(vm *VirtualMachine.VirtualMachine, output []byte) bool {
+		return vm.Index == address
+	}
+}
+
+// Prints is the goal of printing text. As the goal is checked after every instruction, text has been printed once the
+// output ends with it.
+func Prints(text string) Goal {
+	return func(vm *VirtualMachine.VirtualMachine, output []byte) bool {
+		return bytes.HasSuffix(output, []byte(text))
+	}
+}
+
+type Match struct {
+	Value uint16
+	// Instructions the candidate executed to reach the goal.
+	Steps  uint64
+	Output string
+}
+
+type Search struct {
+	// State every candidate starts from, as returned by VirtualMachine.Snapshot.
+	Snapshot []byte
+	Location Location
+	// Values to try, From and To included.
+	From, To uint16
+	// What the candidates read when they ask for input. A candidate that runs out of input has failed.
+	Input string
+	// Instructions a candidate may execute before it has failed.
+	Budget  uint64
+	Goal    Goal
+	Workers int
+	// Prepare is called on the VM of every candidate before it runs, to install hooks for example.
+	Prepare func(vm *VirtualMachine.VirtualMachine)
+	// Progress is called with the number of candidates that are done, from one worker at a time.
+	Progress func(done int, total int)
+	// Found is called with every match as soon as it is found, from one worker at a time.
+	Found func(match Match)
+}
+
+// How many instructions a candidate executes between checks for cancellation.
+const cancelCheck = 1 << 16
+
+// Run tries every value on Workers goroutines and returns the matches in order of value. Once ctx is done the search
+// stops and returns the matches found so far together with the error of ctx.
+func (search *Search) Run(ctx context.Context) ([]Match, error) {
+	vm := VirtualMachine.New(nil)
+	if err := vm.Restore(search.Snapshot); err != nil {
+		return nil, fmt.Errorf("the snapshot cannot be restored: %w", err)
+	}
+	workers := search.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	candidates := make(chan uint16)
+	go func() {
+		defer close(candidates)
+		for value := int(search.From); value <= int(search.To); value++ {
+			select {
+			case candidates <- uint16(value):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var lock sync.Mutex
+	var matches []Match
+	done, total := 0, int(search.To)-int(search.From)+1
+	var group sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		// Every worker clones its own copy, as cloning has to happen on the goroutine that uses the VM. Its engine keeps
+		// the code decoded for one candidate for the next, as the clones share everything they do not write to.
+		base := vm.Clone()
+		engine := VirtualMachine.NewThreaded(base)
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for value := range candidates {
+				match, ok := search.try(ctx, engine, base.Clone(), value)
+
+				lock.Lock()
+				if ok {
+					matches = append(matches, match)
+					if search.Found != nil {
+						search.Found(match)
+					}
+				}
+				done++
+				if search.Progress != nil {
+					search.Progress(done, total)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Value < matches[j].Value })
+	return matches, ctx.Err()
+}
+
+// Runs vm on engine as the candidate for value until it reaches the goal, halts, fails, runs out of input or of budget,
+// or ctx is done.
+func (search *Search) try(ctx context.Context, engine *VirtualMachine.ThreadedVirtualMachine,
+	vm *VirtualMachine.VirtualMachine, value uint16) (Match, bool) {
+	search.Location.set(vm, value)
+	output := bytes.Buffer{}
+	vm.SetIO(strings.NewReader(search.Input), &output)
+	if search.Prepare != nil {
+		search.Prepare(vm)
+	}
+
+	engine.Reset(vm)
+	for steps := uint64(1); steps <= search.Budget; steps++ {
+		halted, err := engine.Step()
+		if err != nil {
+			return Match{}, false
+		}
+		if search.Goal(vm, output.Bytes()) {
+			return Match{Value: value, Steps: steps, Output: output.String()}, true
+		}
+		if halted || (steps%cancelCheck == 0 && ctx.Err() != nil) {
+			return Match{}, false
+		}
+	}
+	return Match{}, false
+}
@@ -0,0 +1,168 @@
+package bruteforce
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	"github.com/ckyong/synacor/hooks"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Prints y for the multiples of 7 in r0 and n for everything else, after reading a line.
+var multiples = assembler.MustAssemble(`
+	in r1
+	mod r1 r0 7
+	jt r1 no
+yes:
+	out 'y'
+	halt
+no:
+	out 'n'
+	halt
+`)
+
+func snapshot(t *testing.T, vm *VirtualMachine.VirtualMachine) []byte {
+	snapshot, err := vm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestParseLocation(t *testing.T) {
+	for text, expected := range map[string]Location{"r7": {Register: true, Index: 7}, "r0": {Register: true}, "2732": {Index: 2732}} {
+		if location, err := ParseLocation(text); err != nil || location != expected || location.String() != text {
+			t.Errorf("%v: expected %v, got %v: %v", text, expected, location, err)
+		}
+	}
+	for _, text := range []string{"r8", "rx", "32768", "-1", ""} {
+		if _, err := ParseLocation(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	search := Search{
+		Snapshot: snapshot(t, VirtualMachine.New(multiples)),
+		Location: Location{Register: true},
+		From:     1,
+		To:       30,
+		Input:    "\n",
+		Budget:   100,
+		Goal:     Prints("y"),
+		Workers:  4,
+	}
+	matches, err := search.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []uint16{}
+	for _, match := range matches {
+		values = append(values, match.Value)
+	}
+	if !reflect.DeepEqual(values, []uint16{7, 14, 21, 28}) || matches[0].Output != "y" || matches[0].Steps != 4 {
+		t.Errorf("expected the multiples of 7 after 4 instructions, got %v", matches)
+	}
+
+	// The same with the goal of reaching yes, and the value in the operand of mod rather than in r0.
+	search.Location, search.Goal = Location{Index: 4}, Reaches(9)
+	if matches, err := search.Run(context.Background()); err != nil || len(matches) != 4 || matches[1].Value != 14 {
+		t.Errorf("expected the multiples of 7 from memory, got %v: %v", matches, err)
+	}
+
+	// Without input no candidate gets anywhere.
+	search.Input = ""
+	if matches, err := search.Run(context.Background()); err != nil || len(matches) != 0 {
+		t.Errorf("expected no matches without input, got %v: %v", matches, err)
+	}
+
+	search.Snapshot = []byte("{")
+	if _, err := search.Run(context.Background()); err == nil {
+		t.Error("expected an error for a broken snapshot")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := 0
+	search := Search{
+		Snapshot: snapshot(t, VirtualMachine.New(multiples)),
+		Location: Location{Register: true},
+		From:     0,
+		To:       32767,
+		Input:    "\n",
+		Budget:   100,
+		Goal:     Prints("y"),
+		Workers:  2,
+		Progress: func(count int, total int) {
+			done = count
+			if total != 32768 {
+				t.Errorf("expected 32768 candidates, got %v", total)
+			}
+		},
+		Found: func(match Match) {
+			if match.Value >= 21 {
+				cancel()
+			}
+		},
+	}
+
+	matches, err := search.Run(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected the search to be canceled, got %v", err)
+	}
+	if len(matches) < 4 || done == 32768 {
+		t.Errorf("expected the search to stop early after 21, got %v after %v candidates", matches, done)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Play until the hack, with the teleporter and the strange book in the inventory.
+	entries, err := transcript.Load("../tools/autoplay/autopath.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if entry.Text == "hack teleporter" {
+			entries = entries[:i]
+			break
+		}
+	}
+	if err := transcript.NewPlayer(vm, entries, io.Discard).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+		t.Fatal(err)
+	}
+
+	search := Search{
+		Snapshot: snapshot(t, vm),
+		Location: Location{Register: true, Index: 7},
+		From:     25700,
+		To:       25800,
+		Input:    "use teleporter\n",
+		Budget:   10_000_000,
+		// Past the check of the confirmation result.
+		Goal:    Reaches(5498),
+		Workers: 4,
+		Prepare: hooks.Install,
+	}
+	matches, err := search.Run(context.Background())
+	if err != nil || len(matches) != 1 || matches[0].Value != 25734 {
+		t.Errorf("expected 25734, got %v: %v", matches, err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package codes picks the codes that mark progress in the challenge out of the game output.
+package codes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+type Code struct {
+	Code string
+	// For a code seen in a mirror, the code as it reads the right way round.
+	Mirrored string
+	// Instructions the VM had executed when the code was printed.
+	Step uint64
+	// Room the code belongs to, empty for codes printed before the first room is entered. A code printed on the way to
+	// another room, like the teleporter's, belongs to the room entered before the game next asks what to do.
+	Room string
+}
+
+// Twelve letters and digits, standing on their own.
+var pattern = regexp.MustCompile(`\b[A-Za-z0-9]{12}\b`)
+
+// Find returns the words in text that look like codes, in order. Ordinary words of the same length are told apart by
+// being all lower case after their first letter.
+func Find(text string) []string {
+	var result []string
+	for _, token := range pattern.FindAllString(text, -1) {
+		if strings.ToLower(token[1:]) != token[1:] || strings.ContainsAny(token, "0123456789") {
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+// Letters that turn into another letter in a mirror. The rest either look the same or have no mirror image, and are
+// kept as they are.
+var mirrorImages = map[rune]rune{'b': 'd', 'd': 'b', 'p': 'q', 'q': 'p'}
+
+// Mirror returns code the way it looks in a mirror: reversed, with every letter flipped.
+func Mirror(code string) string {
+	runes := []rune(code)
+	result := make([]rune, len(runes))
+	for i, r := range runes {
+		if image, ok := mirrorImages[r]; ok {
+			r = image
+		}
+		result[len(runes)-1-i] = r
+	}
+	return string(result)
+}
+
+// The line the game asks for input with.
+const prompt = "What do you do?"
+
+// Detector is an OutputObserver that collects the codes the game prints, looking at the output a line at a time.
+type Detector struct {
+	line strings.Builder
+	room string
+	// Codes at the end of Codes printed in a room since the game last asked what to do, which a room header can still
+	// claim.
+	pending int
+	Codes   []Code
+}
+
+func (detector *Detector) Observe(vm *VirtualMachine.VirtualMachine, char uint16) {
+	if char != '\n' {
+		detector.line.WriteRune(rune(char))
+		return
+	}
+
+	line := detector.line.String()
+	detector.line.Reset()
+
+	if strings.HasPrefix(line, "== ") && strings.HasSuffix(line, " ==") {
+		detector.room = strings.TrimSuffix(strings.TrimPrefix(line, "== "), " ==")
+		for i := len(detector.Codes) - detector.pending; i < len(detector.Codes); i++ {
+			detector.Codes[i].Room = detector.room
+		}
+		detector.pending = 0
+		return
+	}
+	if line == prompt {
+		detector.pending = 0
+		return
+	}
+
+	for _, found := range Find(line) {
+		if detector.seen(found) {
+			continue
+		}
+
+		code := Code{Code: found, Step: vm.Steps, Room: detector.room}
+		if strings.Contains(strings.ToLower(line), "mirror") {
+			code.Mirrored = Mirror(found)
+		}
+		detector.Codes = append(detector.Codes, code)
+		if detector.room != "" {
+			detector.pending++
+		}
+	}
+}
+
+func (detector *Detector) seen(code string) bool {
+	for _, known := range detector.Codes {
+		if known.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Write lists the codes one per line: the code, the step it was printed at and the room, separated by tabs. A
+// mirrored code is followed by the form that reads the right way round.
+func (detector *Detector) Write(writer io.Writer) error {
+	for _, code := range detector.Codes {
+		room := code.Room
+		if room == "" {
+			room = "-"
+		}
+
+		line := fmt.Sprintf("%v\t%v\t%v", code.Code, code.Step, room)
+		if code.Mirrored != "" {
+			line += fmt.Sprintf("\tmirrored %v", code.Mirrored)
+		}
+		if _, err := fmt.Fprintln(writer, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes the codes to filePath in the format of Write.
+func (detector *Detector) Save(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := detector.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
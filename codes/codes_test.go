@@ -0,0 +1,61 @@
+package codes
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestFind(t *testing.T) {
+	found := Find(`Successfully read "KhzTCQoXxRMi"; the Headquarters code is plzkiqnvpcm1, not abcdefghijklm.`)
+	if expected := []string{"KhzTCQoXxRMi", "plzkiqnvpcm1"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	if mirrored := Mirror("xxdiiplHVuYd"); mirrored != "bYuVHlqiibxx" {
+		t.Errorf("expected bYuVHlqiibxx, got %v", mirrored)
+	}
+}
+
+func TestDetector(t *testing.T) {
+	// Codes before the first room belong to none, the teleporter's comes before the header of the room it leads to.
+	text := "code KhzTCQoXxRMi\n== Beach ==\nagain KhzTCQoXxRMi\nIn the mirror: xxdiiplHVuYd\n" +
+		"What do you do?\nYou teleport: fEumXFJeUoRX\n== Ruins ==\n"
+	source := strings.Builder{}
+	for _, char := range text {
+		fmt.Fprintf(&source, "out %v\n", char)
+	}
+	source.WriteString("halt")
+
+	vm := VirtualMachine.New(assembler.MustAssemble(source.String()))
+	vm.SetIO(strings.NewReader(""), &strings.Builder{})
+	detector := &Detector{}
+	vm.AddObserver(detector)
+	if err := VirtualMachine.NewThreaded(vm).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Code{
+		{Code: "KhzTCQoXxRMi", Step: 17},
+		{Code: "xxdiiplHVuYd", Mirrored: "bYuVHlqiibxx", Step: 76, Room: "Beach"},
+		{Code: "fEumXFJeUoRX", Step: 119, Room: "Ruins"},
+	}
+	if !reflect.DeepEqual(detector.Codes, expected) {
+		t.Errorf("expected %v, got %v", expected, detector.Codes)
+	}
+
+	written := strings.Builder{}
+	if err := detector.Write(&written); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "KhzTCQoXxRMi\t17\t-\nxxdiiplHVuYd\t76\tBeach\tmirrored bYuVHlqiibxx\n" +
+		"fEumXFJeUoRX\t119\tRuins\n"; written.String() != expected {
+		t.Errorf("expected %q, got %q", expected, written.String())
+	}
+}
@@ -0,0 +1,254 @@
+// Package coins solves the monument in the ruins, which opens the north door once the five coins found around it are
+// placed into its slots in an order that makes its equation hold.
+package coins
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ckyong/synacor/gamestate"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+	"github.com/ckyong/synacor/world"
+)
+
+// What the game prints when the last coin makes the equation hold.
+const DoorOpen = "you hear a click from the north door"
+
+type factor struct {
+	// Index of the slot, or -1 for a number.
+	slot   int
+	number int
+	power  int
+}
+
+type term struct {
+	sign    int
+	factors []factor
+}
+
+// Equation is a sum of products of slots and numbers, each possibly raised to a power, that has to equal Result.
+type Equation struct {
+	Text   string
+	Slots  int
+	Result int
+	terms  []term
+}
+
+// ParseEquation reads an equation like the one on the monument, "_ + _ * _^2 + _^3 - _ = 399", where every _ is a
+// slot to put a coin in.
+func ParseEquation(text string) (Equation, error) {
+	sides := strings.Split(text, "=")
+	if len(sides) != 2 {
+		return Equation{}, fmt.Errorf("%q does not have one =", text)
+	}
+	result, err := strconv.Atoi(strings.TrimSpace(sides[1]))
+	if err != nil {
+		return Equation{}, fmt.Errorf("%q does not equal a number", text)
+	}
+
+	equation := Equation{Text: strings.TrimSpace(text), Result: result}
+	current := term{sign: 1}
+	expectOperand := true
+	for _, token := range strings.Fields(sides[0]) {
+		if !expectOperand {
+			switch token {
+			case "+":
+				equation.terms = append(equation.terms, current)
+				current = term{sign: 1}
+			case "-":
+				equation.terms = append(equation.terms, current)
+				current = term{sign: -1}
+			case "*":
+			default:
+				return Equation{}, fmt.Errorf("%q: expected an operator, got %q", text, token)
+			}
+			expectOperand = true
+			continue
+		}
+
+		base, exponent, found := strings.Cut(token, "^")
+		factor := factor{slot: -1, power: 1}
+		if found {
+			if factor.power, err = strconv.Atoi(exponent); err != nil || factor.power < 0 {
+				return Equation{}, fmt.Errorf("%q: %q is not a power", text, exponent)
+			}
+		}
+		if base == "_" {
+			factor.slot = equation.Slots
+			equation.Slots++
+		} else if factor.number, err = strconv.Atoi(base); err != nil {
+			return Equation{}, fmt.Errorf("%q: expected a slot or a number, got %q", text, token)
+		}
+		current.factors = append(current.factors, factor)
+		expectOperand = false
+	}
+	if expectOperand {
+		return Equation{}, fmt.Errorf("%q ends in an operator", text)
+	}
+	equation.terms = append(equation.terms, current)
+	return equation, nil
+}
+
+// Evaluate returns the left side of the equation with values in its slots, in order.
+func (equation Equation) Evaluate(values []int) int {
+	sum := 0
+	for _, term := range equation.terms {
+		product := term.sign
+		for _, factor := range term.factors {
+			base := factor.number
+			if factor.slot >= 0 {
+				base = values[factor.slot]
+			}
+			for i := 0; i < factor.power; i++ {
+				product *= base
+			}
+		}
+		sum += product
+	}
+	return sum
+}
+
+// Solve returns the coins in the order they have to go into the slots. With more coins than slots any of them may be
+// left over.
+func (equation Equation) Solve(coins map[string]int) ([]string, bool) {
+	names := make([]string, 0, len(coins))
+	for name := range coins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, equation.Slots)
+	values := make([]int, 0, equation.Slots)
+	used := map[string]bool{}
+	var place func() bool
+	place = func() bool {
+		if len(order) == equation.Slots {
+			return equation.Evaluate(values) == equation.Result
+		}
+		for _, name := range names {
+			if used[name] {
+				continue
+			}
+			used[name] = true
+			order, values = append(order, name), append(values, coins[name])
+			if place() {
+				return true
+			}
+			used[name] = false
+			order, values = order[:len(order)-1], values[:len(values)-1]
+		}
+		return false
+	}
+
+	if !place() {
+		return nil, false
+	}
+	return order, true
+}
+
+// Commands returns the commands that place the coins in order.
+func Commands(order []string) []string {
+	commands := make([]string, len(order))
+	for i, coin := range order {
+		commands[i] = "use " + coin
+	}
+	return commands
+}
+
+// Words the coins use for their values: dots are counted and shapes have as many corners as their value.
+var valueWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"triangle": 3, "square": 4, "pentagon": 5, "hexagon": 6, "heptagon": 7, "octagon": 8, "nonagon": 9, "decagon": 10,
+}
+
+var valuePattern = regexp.MustCompile(`It has (?:an? )?(\w+)(?: dots?)? on one side`)
+
+// Value reads the value of a coin from its description, like "It has seven dots on one side."
+func Value(description string) (int, bool) {
+	match := valuePattern.FindStringSubmatch(description)
+	if match == nil {
+		return 0, false
+	}
+	value, ok := valueWords[match[1]]
+	return value, ok
+}
+
+// The monument equation in the description of the central hall.
+var equationPattern = regexp.MustCompile(`(?m)^[_0-9][^=\n]*=\s*\d+\s*$`)
+
+// FromMemory reads the equation from the rooms reachable from the one the player is in, and the values of the coins
+// the player carries from the item table.
+func FromMemory(game *gamestate.State) (Equation, map[string]int, error) {
+	text := ""
+	for _, room := range game.Rooms() {
+		if text = equationPattern.FindString(room.Description); text != "" {
+			break
+		}
+	}
+	if text == "" {
+		return Equation{}, nil, fmt.Errorf("none of the rooms has an equation in its description")
+	}
+	equation, err := ParseEquation(text)
+	if err != nil {
+		return Equation{}, nil, err
+	}
+
+	coins := map[string]int{}
+	for _, item := range game.Inventory() {
+		if value, ok := Value(item.Description); ok {
+			coins[item.Name] = value
+		}
+	}
+	return equation, coins, nil
+}
+
+// FromOutput asks the game, which has to be waiting for a command in the room with the monument, to look around, list
+// the inventory and look at every coin in it, and reads the equation and the values of the coins from what it prints.
+// Every command may take up to budget instructions.
+func FromOutput(vm *VirtualMachine.VirtualMachine, budget uint64) (Equation, map[string]int, error) {
+	send := func(command string) (string, error) {
+		output, outcome, err := world.Send(vm, command, budget)
+		if err == nil && outcome != world.Waiting {
+			err = fmt.Errorf("%v: the game did not ask for the next command (%v)", command, outcome)
+		}
+		return output, err
+	}
+
+	room, err := send("look")
+	if err != nil {
+		return Equation{}, nil, err
+	}
+	text := equationPattern.FindString(room)
+	if text == "" {
+		return Equation{}, nil, fmt.Errorf("there is no equation in the room: %q", room)
+	}
+	equation, err := ParseEquation(text)
+	if err != nil {
+		return Equation{}, nil, err
+	}
+
+	inventory, err := send("inv")
+	if err != nil {
+		return Equation{}, nil, err
+	}
+	coins := map[string]int{}
+	for _, line := range strings.Split(inventory, "\n") {
+		name := strings.TrimPrefix(line, "- ")
+		if name == line || !strings.HasSuffix(name, "coin") {
+			continue
+		}
+		description, err := send("look " + name)
+		if err != nil {
+			return Equation{}, nil, err
+		}
+		value, ok := Value(description)
+		if !ok {
+			return Equation{}, nil, fmt.Errorf("%v has no value in %q", name, description)
+		}
+		coins[name] = value
+	}
+	return equation, coins, nil
+}
@@ -0,0 +1,123 @@
+package coins
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+	"github.com/ckyong/synacor/world"
+)
+
+var monument = map[string]int{"red coin": 2, "corroded coin": 3, "shiny coin": 5, "concave coin": 7, "blue coin": 9}
+
+func TestEquation(t *testing.T) {
+	equation, err := ParseEquation("_ + _ * _^2 + _^3 - _ = 399")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if equation.Slots != 5 || equation.Result != 399 {
+		t.Errorf("expected 5 slots equal to 399, got %v equal to %v", equation.Slots, equation.Result)
+	}
+	if value := equation.Evaluate([]int{9, 2, 5, 7, 3}); value != 399 {
+		t.Errorf("expected 9 + 2 * 5^2 + 7^3 - 3 to be 399, got %v", value)
+	}
+
+	equation, err = ParseEquation("2 * _ - 3^2 * _ = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := equation.Evaluate([]int{5, 1}); value != 1 {
+		t.Errorf("expected 2 * 5 - 3^2 * 1 to be 1, got %v", value)
+	}
+
+	for _, text := range []string{"_ + _", "_ + = 3", "_ _ = 3", "_ / _ = 3", "_^x = 3", "_ = x", "_ + _ = 1 = 2"} {
+		if _, err := ParseEquation(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestSolve(t *testing.T) {
+	equation, err := ParseEquation("_ + _ * _^2 + _^3 - _ = 399")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, ok := equation.Solve(monument)
+	expected := []string{"blue coin", "red coin", "shiny coin", "concave coin", "corroded coin"}
+	if !ok || !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+	if commands := Commands(order); commands[0] != "use blue coin" || len(commands) != 5 {
+		t.Errorf("unexpected commands %v", commands)
+	}
+
+	equation.Result = 400
+	if order, ok := equation.Solve(monument); ok {
+		t.Errorf("expected no solution for 400, got %v", order)
+	}
+}
+
+func TestValue(t *testing.T) {
+	for description, expected := range map[string]int{
+		"This coin is made of a red metal.  It has two dots on one side.":         2,
+		"This coin is somewhat corroded.  It has a triangle on one side.":         3,
+		"This coin is somehow still quite shiny.  It has a pentagon on one side.": 5,
+		"It has one dot on one side.":                                             1,
+	} {
+		if value, ok := Value(description); !ok || value != expected {
+			t.Errorf("%q: expected %v, got %v", description, expected, value)
+		}
+	}
+	if _, ok := Value("This can is full of high-quality lantern oil."); ok {
+		t.Error("found a value in the description of the can")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := transcript.Load("../tools/coin_solver/coins.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transcript.NewPlayer(vm, entries, io.Discard).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+		t.Fatal(err)
+	}
+
+	equation, values, err := FromMemory(gamestate.New(&vm.Memory, gamestate.Challenge))
+	if err != nil || equation.Text != "_ + _ * _^2 + _^3 - _ = 399" || !reflect.DeepEqual(values, monument) {
+		t.Errorf("from memory, expected the monument and its coins, got %v with %v: %v", equation.Text, values, err)
+	}
+
+	equation, values, err = FromOutput(vm, 10_000_000)
+	if err != nil || equation.Text != "_ + _ * _^2 + _^3 - _ = 399" || !reflect.DeepEqual(values, monument) {
+		t.Fatalf("from the output, expected the monument and its coins, got %v with %v: %v", equation.Text, values, err)
+	}
+
+	order, _ := equation.Solve(values)
+	output := strings.Builder{}
+	for _, command := range Commands(order) {
+		printed, _, err := world.Send(vm, command, 10_000_000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output.WriteString(printed)
+	}
+	if !strings.Contains(output.String(), DoorOpen) {
+		t.Errorf("the door did not open:\n%v", output.String())
+	}
+}
@@ -0,0 +1,397 @@
+// Package compiler translates Synacor bytecode into a standalone Go program.
+//
+// Every basic block that can be found statically becomes a labelled piece of Go code. Anything else, such as code
+// reached through an indirect jump into the middle of a block or code that has been written to since it was compiled,
+// runs on an interpreter embedded in the generated program, so the result behaves exactly like the VM.
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/ckyong/synacor/decompiler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+type Options struct {
+	// Entries are the functions code is discovered from, together with everything they call. Defaults to address 0.
+	Entries []uint16
+	// From and To limit compilation to the blocks that start within that range. To == 0 means there is no upper limit.
+	From uint16
+	To   uint16
+	// Sweep also takes the target of every literal call found anywhere in memory as an entry. Most functions in
+	// challenge.bin are only reached through calls via registers, so this finds far more code. Data that happens to
+	// decode as a call is harmless: a block only runs when the program really jumps to it.
+	Sweep bool
+}
+
+// A straight run of instructions that is compiled as one labelled piece of code.
+type block struct {
+	id           int
+	start        uint16
+	instructions []decompiler.Instruction
+	// Address control continues at when the last instruction does not transfer it elsewhere.
+	next uint16
+}
+
+func (b *block) end() uint16 {
+	return b.instructions[len(b.instructions)-1].Next()
+}
+
+// Compile returns the formatted source of a Go program that runs the given memory image.
+func Compile(memory []uint16, options Options) ([]byte, error) {
+	entries := options.Entries
+	if len(entries) == 0 {
+		entries = []uint16{0}
+	}
+	if options.Sweep {
+		for address := range memory {
+			ins, err := decompiler.Decode(memory, uint16(address))
+			if err == nil && ins.Op == 17 && !decompiler.IsRegister(ins.Operands[0]) {
+				entries = append(entries, ins.Operands[0])
+			}
+		}
+	}
+
+	blocks := discover(memory, entries, options)
+
+	g := &generator{
+		memory: memory,
+		blocks: blocks,
+		starts: map[uint16]*block{},
+	}
+	for _, b := range blocks {
+		g.starts[b.start] = b
+	}
+
+	source := g.generate()
+	formatted, err := format.Source(source)
+	if err != nil {
+		return source, fmt.Errorf("generated code does not compile: %w", err)
+	}
+	return formatted, nil
+}
+
+// Finds every function reachable from entries through literal calls and cuts their basic blocks after each call, so
+// that return addresses start a block of their own.
+func discover(memory []uint16, entries []uint16, options Options) []*block {
+	starts := map[uint16]*block{}
+	seen := map[uint16]bool{}
+	pending := append([]uint16{}, entries...)
+
+	for len(pending) > 0 {
+		entry := pending[0]
+		pending = pending[1:]
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+
+		fn, err := decompiler.BuildFunction(memory, entry)
+		if err != nil {
+			// Left to the interpreter.
+			continue
+		}
+		pending = append(pending, fn.Calls()...)
+
+		for _, fnBlock := range fn.Blocks {
+			current := &block{start: fnBlock.Start}
+			for _, ins := range fnBlock.Instructions {
+				current.instructions = append(current.instructions, ins)
+				if ins.Op == 17 {
+					current.next = ins.Next()
+					add(starts, current, options)
+					current = &block{start: ins.Next()}
+				}
+			}
+			if len(current.instructions) > 0 {
+				current.next = current.end()
+				add(starts, current, options)
+			}
+		}
+	}
+
+	var result []*block
+	for _, b := range starts {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].start < result[j].start
+	})
+	for i, b := range result {
+		b.id = i
+	}
+	return result
+}
+
+func add(starts map[uint16]*block, b *block, options Options) {
+	if b.start < options.From || (options.To != 0 && b.start > options.To) {
+		return
+	}
+	if _, ok := starts[b.start]; !ok {
+		starts[b.start] = b
+	}
+}
+
+type generator struct {
+	memory []uint16
+	blocks []*block
+	starts map[uint16]*block
+	out    bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+func (g *generator) generate() []byte {
+	g.printf("// Code generated by tools/compiler. DO NOT EDIT.\n\n")
+	g.printf("package main\n\n")
+	g.printf("import (\n\t\"bufio\"\n\t\"errors\"\n\t\"fmt\"\n\t\"os\"\n)\n\n")
+	g.printf("const blockCount = %v\n\n", len(g.blocks))
+
+	g.image()
+	g.coverage()
+	g.operandCounts()
+	g.printf("%v\n", runtime)
+	g.run()
+
+	return g.out.Bytes()
+}
+
+// Writes the initial memory, leaving out the trailing zeros.
+func (g *generator) image() {
+	end := len(g.memory)
+	for end > 0 && g.memory[end-1] == 0 {
+		end--
+	}
+
+	g.printf("var image = [32768]uint16{")
+	for i := 0; i < end; i++ {
+		if i%16 == 0 {
+			g.printf("\n")
+		}
+		g.printf("%v, ", g.memory[i])
+	}
+	g.printf("\n}\n\n")
+}
+
+// Writes, for every address holding compiled code, the blocks that have to fall back to the interpreter once it is
+// written to.
+func (g *generator) coverage() {
+	cover := map[uint16][]int{}
+	for _, b := range g.blocks {
+		for address := b.start; address < b.end(); address++ {
+			cover[address] = append(cover[address], b.id)
+		}
+	}
+
+	var addresses []int
+	for address := range cover {
+		addresses = append(addresses, int(address))
+	}
+	sort.Ints(addresses)
+
+	g.printf("var coverage = [32768][]int{\n")
+	for _, address := range addresses {
+		var ids []string
+		for _, id := range cover[uint16(address)] {
+			ids = append(ids, fmt.Sprint(id))
+		}
+		g.printf("%v: {%v},\n", address, strings.Join(ids, ", "))
+	}
+	g.printf("}\n\n")
+}
+
+// Writes the number of operands of every operation, by opcode, for the interpreter to check instructions with.
+func (g *generator) operandCounts() {
+	g.printf("var opArgs = [...]uint16{")
+	for op := 0; op < len(VirtualMachine.OpArgs); op++ {
+		g.printf("%v, ", VirtualMachine.OpArgs[uint16(op)])
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) run() {
+	g.printf("func (m *machine) run() error {\n")
+	g.printf("dispatch:\n")
+	g.printf("switch m.pc {\n")
+	for _, b := range g.blocks {
+		g.printf("case %v:\nif !m.stale[%v] {\ngoto L%v\n}\n", b.start, b.id, b.start)
+	}
+	g.printf("}\n")
+	g.printf("if halted, err := m.step(); halted || err != nil {\nreturn err\n}\n")
+	g.printf("goto dispatch\n")
+
+	for _, b := range g.blocks {
+		g.printf("\nL%v:\n{\n", b.start)
+		for _, ins := range b.instructions {
+			g.instruction(b, ins)
+		}
+		if !transfers(b.instructions[len(b.instructions)-1]) {
+			g.transfer(fmt.Sprint(b.next))
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+// Whether the instruction always leaves the block, so nothing needs to follow it.
+func transfers(ins decompiler.Instruction) bool {
+	switch ins.Op {
+	case 0, 6, 17, 18:
+		return true
+	}
+	return false
+}
+
+// Returns the Go expression for the value of an operand.
+func value(operand uint16) string {
+	if decompiler.IsRegister(operand) {
+		return fmt.Sprintf("m.reg[%v]", operand-32768)
+	}
+	return fmt.Sprint(operand)
+}
+
+// Writes the code that continues execution at target, going straight to its label when it is a compiled block.
+func (g *generator) transfer(target string) {
+	g.printf("m.pc = %v\n", target)
+	var address uint16
+	if _, err := fmt.Sscan(target, &address); err == nil {
+		if b, ok := g.starts[address]; ok {
+			g.printf("if !m.stale[%v] {\ngoto L%v\n}\n", b.id, b.start)
+		}
+	}
+	g.printf("goto dispatch\n")
+}
+
+// Writes val into the destination operand, re-checking the current block when that was a memory write.
+func (g *generator) write(b *block, ins decompiler.Instruction, destination uint16, val string) {
+	if decompiler.IsRegister(destination) {
+		g.printf("m.reg[%v] = %v\n", destination-32768, val)
+		return
+	}
+	g.printf("m.write(%v, %v)\n", destination, val)
+	g.staleCheck(b, ins)
+}
+
+// Leaves the block for the interpreter if a memory write has just invalidated it.
+func (g *generator) staleCheck(b *block, ins decompiler.Instruction) {
+	g.printf("if m.stale[%v] {\nm.pc = %v\ngoto dispatch\n}\n", b.id, ins.Next())
+}
+
+// Stops with an InvalidAddressError, like the VM, when the register operand holds an address past the end of memory.
+// A literal operand is always a valid address, as anything larger is a register or an invalid number.
+func (g *generator) addressCheck(ins decompiler.Instruction, operand uint16) {
+	if decompiler.IsRegister(operand) {
+		g.printf("if %v >= 32768 {\nm.pc = %v\nreturn &InvalidAddressError{Address: %v, Index: %v}\n}\n",
+			value(operand), ins.Address, value(operand), ins.Address)
+	}
+}
+
+// Folds arithmetic on two literals using the same 16-bit wrap around as the VM, so the Go compiler never sees an
+// overflowing constant.
+func fold(op uint16, b uint16, c uint16) (string, bool) {
+	if decompiler.IsRegister(b) || decompiler.IsRegister(c) {
+		return "", false
+	}
+	switch op {
+	case 9:
+		return fmt.Sprint((b + c) % 32768), true
+	case 10:
+		return fmt.Sprint((b * c) % 32768), true
+	case 12:
+		return fmt.Sprint(b & c), true
+	case 13:
+		return fmt.Sprint(b | c), true
+	}
+	return "", false
+}
+
+func (g *generator) instruction(b *block, ins decompiler.Instruction) {
+	args := ins.Operands
+	g.printf("// %v\n", ins)
+
+	for _, operand := range args {
+		if operand > 32775 {
+			// The VM refuses to run the instruction at all.
+			g.printf("m.pc = %v\nreturn &InvalidNumberError{Value: %v, Index: %v}\n", ins.Address, operand, ins.Address)
+			return
+		}
+	}
+
+	switch ins.Op {
+	case 0: // halt
+		g.printf("return nil\n")
+	case 1: // set
+		g.write(b, ins, args[0], value(args[1]))
+	case 2: // push
+		g.printf("m.stack = append(m.stack, %v)\n", value(args[0]))
+	case 3: // pop
+		g.printf("if len(m.stack) == 0 {\nm.pc = %v\nreturn errEmptyStack\n}\n", ins.Address)
+		g.write(b, ins, args[0], "m.pop()")
+	case 4: // eq
+		g.write(b, ins, args[0], fmt.Sprintf("flag(%v == %v)", value(args[1]), value(args[2])))
+	case 5: // gt
+		g.write(b, ins, args[0], fmt.Sprintf("flag(%v > %v)", value(args[1]), value(args[2])))
+	case 6: // jmp
+		g.transfer(value(args[0]))
+	case 7, 8: // jt, jf
+		comparison := "!="
+		if ins.Op == 8 {
+			comparison = "=="
+		}
+		g.printf("if %v %v 0 {\n", value(args[0]), comparison)
+		g.transfer(value(args[1]))
+		g.printf("}\n")
+	case 9, 10, 12, 13: // add, mult, and, or
+		if folded, ok := fold(ins.Op, args[1], args[2]); ok {
+			g.write(b, ins, args[0], folded)
+			break
+		}
+		expression := map[uint16]string{
+			9:  "(%v + %v) %% 32768",
+			10: "(%v * %v) %% 32768",
+			12: "%v & %v",
+			13: "%v | %v",
+		}[ins.Op]
+		g.write(b, ins, args[0], fmt.Sprintf(expression, value(args[1]), value(args[2])))
+	case 11: // mod
+		if decompiler.IsRegister(args[2]) || args[2] == 0 {
+			g.printf("if %v == 0 {\nm.pc = %v\nreturn &DivisionByZeroError{Index: %v}\n}\n", value(args[2]), ins.Address, ins.Address)
+		}
+		if args[2] == 0 {
+			// The check above always fails, and the Go compiler would reject a constant division by zero.
+			break
+		}
+		g.write(b, ins, args[0], fmt.Sprintf("%v %% %v", value(args[1]), value(args[2])))
+	case 14: // not
+		if decompiler.IsRegister(args[1]) {
+			g.write(b, ins, args[0], fmt.Sprintf("^%v & 32767", value(args[1])))
+		} else {
+			g.write(b, ins, args[0], fmt.Sprint(^args[1]&32767))
+		}
+	case 15: // rmem
+		g.addressCheck(ins, args[1])
+		g.write(b, ins, args[0], fmt.Sprintf("m.mem[%v]", value(args[1])))
+	case 16: // wmem
+		g.addressCheck(ins, args[0])
+		g.printf("m.write(%v, %v)\n", value(args[0]), value(args[1]))
+		g.staleCheck(b, ins)
+	case 17: // call
+		g.printf("m.stack = append(m.stack, %v)\n", ins.Next())
+		g.transfer(value(args[0]))
+	case 18: // ret
+		g.printf("if len(m.stack) == 0 {\nm.pc = %v\nreturn errEmptyStack\n}\n", ins.Address)
+		g.transfer("m.pop()")
+	case 19: // out
+		g.printf("m.out.WriteRune(rune(%v))\n", value(args[0]))
+	case 20: // in
+		g.printf("if err := m.read(); err != nil {\nm.pc = %v\nreturn err\n}\n", ins.Address)
+		g.write(b, ins, args[0], "m.char")
+	case 21: // noop
+	}
+}
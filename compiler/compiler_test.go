@@ -0,0 +1,271 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Echoes its input shifted by one character, then writes into its own code and jumps through a register, so that
+// both the compiled blocks and the interpreter fallback are exercised.
+var program = []uint16{
+	// 0: in r1
+	20, 32769,
+	// 2: eq r2 r1 10
+	4, 32770, 32769, 10,
+	// 6: jt r2 17
+	7, 32770, 17,
+	// 9: add r1 r1 1
+	9, 32769, 32769, 1,
+	// 13: out r1
+	19, 32769,
+	// 15: jmp 0
+	6, 0,
+	// 17: set r3 31
+	1, 32771, 31,
+	// 20: call 47
+	17, 47,
+	// 22: wmem 48 88, turning the "A" printed at 47 into an "X"
+	16, 48, 88,
+	// 25: call 47
+	17, 47,
+	// 27: jmp r3
+	6, 32771,
+	// 29: halt, skipped by the jump
+	0, 0,
+	// 31: push 5
+	2, 5,
+	// 33: pop r4
+	3, 32772,
+	// 35: mult r5 r4 10000
+	10, 32773, 32772, 10000,
+	// 39: mod r6 r5 26
+	11, 32774, 32773, 26,
+	// 43: jmp 51
+	6, 51,
+	// 45: noop noop
+	21, 21,
+	// 47: out 65
+	19, 65,
+	// 49: ret
+	18,
+	// 50: noop
+	21,
+	// 51: add r6 r6 97
+	9, 32774, 32774, 97,
+	// 55: out r6
+	19, 32774,
+	// 57: not r7 0
+	14, 32775, 0,
+	// 60: gt r0 r7 32766
+	5, 32768, 32775, 32766,
+	// 64: add r0 r0 48
+	9, 32768, 32768, 48,
+	// 68: out r0
+	19, 32768,
+	// 70: out 10
+	19, 10,
+	// 72: halt
+	0,
+}
+
+func TestCompiledProgramMatchesVirtualMachine(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+
+	input := "HAL\n"
+	expected, err := runVirtualMachine(t, program, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := runCompiled(t, goTool, program, input, Options{})
+	if err != nil {
+		t.Fatalf("compiled program failed: %v\n%s", err, actual)
+	}
+
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+// Jumps to the last word of memory, which holds a set whose operands would be past its end.
+var pastEnd = func() []uint16 {
+	memory := make([]uint16, 32768)
+	copy(memory, []uint16{6, 32767})
+	memory[32767] = 1
+	return memory
+}()
+
+func TestCompiledProgramFaultsLikeVirtualMachine(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+
+	for _, test := range []struct {
+		name    string
+		program []uint16
+		fault   interface{}
+	}{
+		// set r0 0; mod r1 5 r0
+		{"mod", []uint16{1, 32768, 0, 11, 32769, 5, 32768, 0}, &VirtualMachine.DivisionByZeroError{}},
+		// mod r1 5 0
+		{"mod literal", []uint16{11, 32769, 5, 0, 0}, &VirtualMachine.DivisionByZeroError{}},
+		// rmem r0 7; rmem r1 r0; halt; data 40000
+		{"rmem", []uint16{15, 32768, 7, 15, 32769, 32768, 0, 40000}, &VirtualMachine.InvalidAddressError{}},
+		// rmem r0 7; wmem r0 1; halt; data 40000
+		{"wmem", []uint16{15, 32768, 7, 16, 32768, 1, 0, 40000}, &VirtualMachine.InvalidAddressError{}},
+		// rmem r0 5; jmp r0; data 40000
+		{"jmp", []uint16{15, 32768, 5, 6, 32768, 40000}, &VirtualMachine.InvalidAddressError{}},
+		// jmp 32767, where a set runs past the end of memory
+		{"end of memory", pastEnd, &VirtualMachine.InvalidAddressError{}},
+		// set 40000 1
+		{"number", []uint16{1, 40000, 1, 0}, &VirtualMachine.InvalidNumberError{}},
+		// out 65; data 22
+		{"operation", []uint16{19, 65, 22}, &VirtualMachine.UnknownOperationError{}},
+	} {
+		_, expected := runVirtualMachine(t, test.program, "")
+		if expected == nil || reflect.TypeOf(expected) != reflect.TypeOf(test.fault) {
+			t.Fatalf("%v: expected the VM to fail with %T, got %v", test.name, test.fault, expected)
+		}
+
+		// Once compiled, and once left entirely to the interpreter.
+		for _, options := range []Options{{}, {From: 1000}} {
+			output, err := runCompiled(t, goTool, test.program, "", options)
+			if err == nil || !strings.Contains(output, expected.Error()) {
+				t.Errorf("%v %+v: expected the compiled program to fail with %q, got %v\n%s", test.name, options,
+					expected, err, output)
+			}
+		}
+	}
+}
+
+// Compiles random program images and runs them on random input. Every image the VM halts or fails on within a limited
+// number of instructions has to print the same and fail in the same way once compiled.
+func FuzzCompiledProgram(f *testing.F) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		f.Skip("go tool not available")
+	}
+
+	f.Add(toBytes(program), []byte("HAL\n"))
+	// rmem r0 5; jmp r0; data 40000
+	f.Add(toBytes([]uint16{15, 32768, 5, 6, 32768, 40000}), []byte{})
+	// in r0; wmem 6 r0; noop; ...
+	f.Add(toBytes([]uint16{20, 32768, 16, 6, 32768, 21, 21, 0}), []byte("\x16\n"))
+
+	f.Fuzz(func(t *testing.T, image []byte, input []byte) {
+		words := toWords(image)
+		if len(words) > 32768 {
+			words = words[:32768]
+		}
+
+		vm := VirtualMachine.New(words)
+		// The compiled program has no hacks, it reads every line.
+		vm.DisableHacks()
+		output := strings.Builder{}
+		vm.SetIO(bytes.NewReader(input), &output)
+		var expected error
+		for steps := 0; ; steps++ {
+			if steps == 10000 {
+				t.Skip("the program runs for too long")
+			}
+			halted, err := vm.Step()
+			if err != nil {
+				expected = err
+				break
+			}
+			if halted {
+				break
+			}
+		}
+
+		actual, err := runCompiled(t, goTool, words, string(input), Options{})
+		if expected == nil {
+			if err != nil || actual != output.String() {
+				t.Fatalf("expected %q, got %v\n%s", output.String(), err, actual)
+			}
+		} else if err == nil || !strings.HasPrefix(actual, output.String()) ||
+			!strings.Contains(actual[output.Len():], expected.Error()) {
+			t.Fatalf("expected %q and then %q, got %v\n%s", output.String(), expected, err, actual)
+		}
+	})
+}
+
+// Compiles program into a standalone Go program, runs it with input and returns what it printed.
+func runCompiled(t *testing.T, goTool string, program []uint16, input string, options Options) (string, error) {
+	memory := make([]uint16, 32768)
+	copy(memory, program)
+	source, err := Compile(memory, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module compiled\n\ngo 1.19\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), source, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func runVirtualMachine(t *testing.T, program []uint16, input string) (string, error) {
+	buffer := bytes.Buffer{}
+	if err := binary.Write(&buffer, binary.LittleEndian, program); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "program.bin")
+	if err := os.WriteFile(path, buffer.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	vm, err := VirtualMachine.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader(input), &output)
+	err = vm.Run()
+	return output.String(), err
+}
+
+func toWords(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return words
+}
+
+func toBytes(words []uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[2*i:], word)
+	}
+	return data
+}
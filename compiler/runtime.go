@@ -0,0 +1,240 @@
+package compiler
+
+// The part of the generated program that does not depend on the image: machine state, helpers and the interpreter
+// used for everything that was not compiled.
+const runtime = `
+type machine struct {
+	mem   [32768]uint16
+	reg   [8]uint16
+	stack []uint16
+	pc    uint16
+	// Set for a compiled block once any of its words has been written to.
+	stale [blockCount]bool
+	in    *bufio.Reader
+	out   *bufio.Writer
+	char  uint16
+}
+
+var errEmptyStack = errors.New("Stack is empty, application should halt")
+
+// The faults of the VM, with the same messages.
+type DivisionByZeroError struct {
+	Index uint16
+}
+
+func (err *DivisionByZeroError) Error() string {
+	return fmt.Sprintf("Division by zero at index %v", err.Index)
+}
+
+type InvalidAddressError struct {
+	Address uint16
+	Index   uint16
+}
+
+func (err *InvalidAddressError) Error() string {
+	return fmt.Sprintf("Invalid address: %v at index %v", err.Address, err.Index)
+}
+
+type InvalidNumberError struct {
+	Value uint16
+	Index uint16
+}
+
+func (err *InvalidNumberError) Error() string {
+	return fmt.Sprintf("Invalid number: %v at index %v", err.Value, err.Index)
+}
+
+type UnknownOperationError struct {
+	Op    uint16
+	Index uint16
+}
+
+func (err *UnknownOperationError) Error() string {
+	return fmt.Sprintf("Unknown operation: %v at index %v", err.Op, err.Index)
+}
+
+func main() {
+	m := &machine{
+		mem: image,
+		in:  bufio.NewReader(os.Stdin),
+		out: bufio.NewWriter(os.Stdout),
+	}
+
+	err := m.run()
+	m.out.Flush()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error occurred during execution at %v: %v\n", m.pc, err)
+		os.Exit(1)
+	}
+}
+
+func flag(condition bool) uint16 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+func (m *machine) value(arg uint16) uint16 {
+	if arg >= 32768 && arg <= 32775 {
+		return m.reg[arg-32768]
+	}
+	return arg
+}
+
+// Writes val to a register or to memory. address is an operand that check accepted, or an address wmem checked, so it
+// is never past the last register.
+func (m *machine) write(address uint16, val uint16) {
+	if address >= 32768 && address <= 32775 {
+		m.reg[address-32768] = val
+		return
+	}
+	m.mem[address] = val
+	for _, id := range coverage[address] {
+		m.stale[id] = true
+	}
+}
+
+func (m *machine) pop() uint16 {
+	val := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return val
+}
+
+// Reads the next character of input into m.char, flushing pending output first so prompts are visible.
+func (m *machine) read() error {
+	m.out.Flush()
+	char, err := m.in.ReadByte()
+	if err != nil {
+		return err
+	}
+	m.char = uint16(char)
+	return nil
+}
+
+// Checks the instruction at m.pc the way the VM does before it runs one: it has to be a known operation that fits in
+// memory, and none of its operands can be above the last register.
+func (m *machine) check() error {
+	if int(m.pc) >= len(m.mem) {
+		return &InvalidAddressError{Address: m.pc, Index: m.pc}
+	}
+
+	op := m.mem[m.pc]
+	if int(op) >= len(opArgs) {
+		return &UnknownOperationError{Op: op, Index: m.pc}
+	}
+	args := opArgs[op]
+	if int(m.pc)+int(args) >= len(m.mem) {
+		return &InvalidAddressError{Address: uint16(len(m.mem)), Index: m.pc}
+	}
+
+	for i := uint16(1); i <= args; i++ {
+		if operand := m.mem[m.pc+i]; operand > 32775 {
+			return &InvalidNumberError{Value: operand, Index: m.pc}
+		}
+	}
+	return nil
+}
+
+// Interprets the instruction at m.pc. Returns true once the program halts.
+func (m *machine) step() (bool, error) {
+	if err := m.check(); err != nil {
+		return false, err
+	}
+	op := m.mem[m.pc]
+	arg := func(i uint16) uint16 {
+		return m.mem[m.pc+i]
+	}
+
+	switch op {
+	case 0:
+		return true, nil
+	case 1:
+		m.write(arg(1), m.value(arg(2)))
+		m.pc += 3
+	case 2:
+		m.stack = append(m.stack, m.value(arg(1)))
+		m.pc += 2
+	case 3:
+		if len(m.stack) == 0 {
+			return false, errEmptyStack
+		}
+		m.write(arg(1), m.pop())
+		m.pc += 2
+	case 4:
+		m.write(arg(1), flag(m.value(arg(2)) == m.value(arg(3))))
+		m.pc += 4
+	case 5:
+		m.write(arg(1), flag(m.value(arg(2)) > m.value(arg(3))))
+		m.pc += 4
+	case 6:
+		m.pc = m.value(arg(1))
+	case 7:
+		if m.value(arg(1)) != 0 {
+			m.pc = m.value(arg(2))
+		} else {
+			m.pc += 3
+		}
+	case 8:
+		if m.value(arg(1)) == 0 {
+			m.pc = m.value(arg(2))
+		} else {
+			m.pc += 3
+		}
+	case 9:
+		m.write(arg(1), (m.value(arg(2))+m.value(arg(3)))%32768)
+		m.pc += 4
+	case 10:
+		m.write(arg(1), (m.value(arg(2))*m.value(arg(3)))%32768)
+		m.pc += 4
+	case 11:
+		if m.value(arg(3)) == 0 {
+			return false, &DivisionByZeroError{Index: m.pc}
+		}
+		m.write(arg(1), m.value(arg(2))%m.value(arg(3)))
+		m.pc += 4
+	case 12:
+		m.write(arg(1), m.value(arg(2))&m.value(arg(3)))
+		m.pc += 4
+	case 13:
+		m.write(arg(1), m.value(arg(2))|m.value(arg(3)))
+		m.pc += 4
+	case 14:
+		m.write(arg(1), ^m.value(arg(2))&32767)
+		m.pc += 3
+	case 15:
+		if m.value(arg(2)) >= 32768 {
+			return false, &InvalidAddressError{Address: m.value(arg(2)), Index: m.pc}
+		}
+		m.write(arg(1), m.mem[m.value(arg(2))])
+		m.pc += 3
+	case 16:
+		if m.value(arg(1)) >= 32768 {
+			return false, &InvalidAddressError{Address: m.value(arg(1)), Index: m.pc}
+		}
+		m.write(m.value(arg(1)), m.value(arg(2)))
+		m.pc += 3
+	case 17:
+		m.stack = append(m.stack, m.pc+2)
+		m.pc = m.value(arg(1))
+	case 18:
+		if len(m.stack) == 0 {
+			return false, errEmptyStack
+		}
+		m.pc = m.pop()
+	case 19:
+		m.out.WriteRune(rune(m.value(arg(1))))
+		m.pc += 2
+	case 20:
+		if err := m.read(); err != nil {
+			return false, err
+		}
+		m.write(arg(1), m.char)
+		m.pc += 2
+	case 21:
+		m.pc++
+	}
+	return false, nil
+}
+`
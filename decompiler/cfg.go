@@ -0,0 +1,157 @@
+package decompiler
+
+import (
+	"sort"
+)
+
+const (
+	opHalt = 0
+	opJmp  = 6
+	opJt   = 7
+	opJf   = 8
+	opCall = 17
+	opRet  = 18
+)
+
+// Block is a basic block: a run of instructions that is only entered at the top and only left at the bottom.
+type Block struct {
+	Start        uint16
+	Instructions []Instruction
+	// For jt/jf the taken branch comes first, followed by the fall through.
+	Succs []*Block
+	Preds []*Block
+}
+
+// Last returns the instruction that ends the block.
+func (block *Block) Last() Instruction {
+	return block.Instructions[len(block.Instructions)-1]
+}
+
+// Function is the control flow graph of everything reachable from Entry without following calls.
+type Function struct {
+	Entry  uint16
+	Blocks []*Block // ordered by address
+	blocks map[uint16]*Block
+}
+
+// Block returns the block starting at address, or nil if there is none.
+func (fn *Function) Block(address uint16) *Block {
+	return fn.blocks[address]
+}
+
+// Calls returns the literal call targets of the function, in address order.
+func (fn *Function) Calls() []uint16 {
+	seen := map[uint16]bool{}
+	var result []uint16
+	for _, block := range fn.Blocks {
+		for _, ins := range block.Instructions {
+			if ins.Op == opCall && !IsRegister(ins.Operands[0]) && !seen[ins.Operands[0]] {
+				seen[ins.Operands[0]] = true
+				result = append(result, ins.Operands[0])
+			}
+		}
+	}
+	return result
+}
+
+// Returns the literal targets control can transfer to after ins, and whether the next instruction is also reached.
+func successors(ins Instruction) ([]uint16, bool) {
+	switch ins.Op {
+	case opHalt, opRet:
+		return nil, false
+	case opJmp:
+		if IsRegister(ins.Operands[0]) {
+			return nil, false
+		}
+		return []uint16{ins.Operands[0]}, false
+	case opJt, opJf:
+		if IsRegister(ins.Operands[1]) {
+			return nil, true
+		}
+		return []uint16{ins.Operands[1]}, true
+	}
+	return nil, true
+}
+
+func endsBlock(ins Instruction) bool {
+	switch ins.Op {
+	case opHalt, opRet, opJmp, opJt, opJf:
+		return true
+	}
+	return false
+}
+
+// BuildFunction decodes everything reachable from entry and splits it into basic blocks.
+func BuildFunction(memory []uint16, entry uint16) (*Function, error) {
+	instructions := map[uint16]Instruction{}
+	leaders := map[uint16]bool{entry: true}
+
+	pending := []uint16{entry}
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for {
+			if _, ok := instructions[address]; ok {
+				break
+			}
+
+			ins, err := Decode(memory, address)
+			if err != nil {
+				return nil, err
+			}
+			instructions[address] = ins
+
+			targets, next := successors(ins)
+			for _, target := range targets {
+				leaders[target] = true
+				pending = append(pending, target)
+			}
+
+			if !next {
+				break
+			}
+			if endsBlock(ins) {
+				leaders[ins.Next()] = true
+			}
+			address = ins.Next()
+		}
+	}
+
+	fn := &Function{Entry: entry, blocks: map[uint16]*Block{}}
+	for address := range leaders {
+		block := &Block{Start: address}
+		for {
+			ins := instructions[address]
+			block.Instructions = append(block.Instructions, ins)
+
+			_, next := successors(ins)
+			if endsBlock(ins) || !next || leaders[ins.Next()] {
+				break
+			}
+			address = ins.Next()
+		}
+		fn.blocks[block.Start] = block
+		fn.Blocks = append(fn.Blocks, block)
+	}
+
+	sort.Slice(fn.Blocks, func(i, j int) bool {
+		return fn.Blocks[i].Start < fn.Blocks[j].Start
+	})
+
+	for _, block := range fn.Blocks {
+		last := block.Last()
+		targets, next := successors(last)
+		for _, target := range targets {
+			block.Succs = append(block.Succs, fn.blocks[target])
+		}
+		if next {
+			block.Succs = append(block.Succs, fn.blocks[last.Next()])
+		}
+		for _, succ := range block.Succs {
+			succ.Preds = append(succ.Preds, block)
+		}
+	}
+
+	return fn, nil
+}
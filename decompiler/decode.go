@@ -0,0 +1,80 @@
+// Package decompiler lifts guest functions into an SSA-style IR and renders them as structured, Go-like pseudocode.
+package decompiler
+
+import (
+	"fmt"
+	"strings"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Instruction is a single decoded operation together with its raw operands.
+type Instruction struct {
+	Address  uint16
+	Op       uint16
+	Operands []uint16
+}
+
+type InvalidInstructionError struct {
+	Address uint16
+	Value   uint16
+}
+
+func (err *InvalidInstructionError) Error() string {
+	return fmt.Sprintf("invalid instruction %v at address %v", err.Value, err.Address)
+}
+
+// Decode reads the instruction starting at address.
+func Decode(memory []uint16, address uint16) (Instruction, error) {
+	if int(address) >= len(memory) {
+		return Instruction{}, &InvalidInstructionError{Address: address}
+	}
+
+	op := memory[address]
+	args, ok := VirtualMachine.OpArgs[op]
+	if !ok {
+		return Instruction{}, &InvalidInstructionError{Address: address, Value: op}
+	}
+
+	end := int(address) + 1 + int(args)
+	if end > len(memory) {
+		return Instruction{}, &InvalidInstructionError{Address: address, Value: op}
+	}
+
+	operands := make([]uint16, args)
+	copy(operands, memory[address+1:end])
+
+	return Instruction{Address: address, Op: op, Operands: operands}, nil
+}
+
+func (ins Instruction) Name() string {
+	return VirtualMachine.OpNames[ins.Op]
+}
+
+// Next returns the address of the instruction that follows this one in memory.
+func (ins Instruction) Next() uint16 {
+	return ins.Address + 1 + uint16(len(ins.Operands))
+}
+
+// String formats the instruction the same way the disassembler does.
+func (ins Instruction) String() string {
+	result := strings.Builder{}
+	result.WriteString(fmt.Sprintf("%v: %v", ins.Address, ins.Name()))
+	for _, operand := range ins.Operands {
+		result.WriteString(fmt.Sprintf(" %v", operand))
+	}
+	return result.String()
+}
+
+// IsRegister reports whether an operand refers to one of the eight registers.
+func IsRegister(operand uint16) bool {
+	return operand >= 32768 && operand <= 32775
+}
+
+// RegisterName returns "r0" to "r7" for register operands, or the literal value otherwise.
+func RegisterName(operand uint16) string {
+	if IsRegister(operand) {
+		return fmt.Sprintf("r%v", operand-32768)
+	}
+	return fmt.Sprintf("%v", operand)
+}
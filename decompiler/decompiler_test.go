@@ -0,0 +1,171 @@
+package decompiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLift(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		program    []uint16
+		params     []uint16
+		ir         string
+		pseudocode string
+	}{
+		{
+			name: "loop",
+			program: []uint16{
+				// 0: set r0 5
+				1, 32768, 5,
+				// 3: add r0 r0 32767
+				9, 32768, 32768, 32767,
+				// 7: jt r0 3
+				7, 32768, 3,
+				// 10: ret
+				18,
+			},
+			ir: `0:
+	r0.1 = 5
+	goto 3
+3:
+	r0.3 = phi(r0.1, r0.2)
+	r0.2 = r0.3 - 1
+	if r0.2 != 0 goto 3 else 10
+10:
+	return
+`,
+			pseudocode: `func sub_0() {
+	r0 = 5
+	for {
+		r0 = r0 - 1
+		if r0 != 0 {
+			continue
+		}
+		break
+	}
+	return
+}
+`,
+		},
+		{
+			name: "diamond",
+			program: []uint16{
+				// 0: jf r0 8
+				8, 32768, 8,
+				// 3: set r1 1
+				1, 32769, 1,
+				// 6: jmp 11
+				6, 11,
+				// 8: set r1 2
+				1, 32769, 2,
+				// 11: out r1
+				19, 32769,
+				// 13: ret
+				18,
+			},
+			params: []uint16{0},
+			ir: `0:
+	if r0.0 == 0 goto 8 else 3
+3:
+	r1.1 = 1
+	goto 11
+8:
+	r1.2 = 2
+	goto 11
+11:
+	r1.3 = phi(r1.1, r1.2)
+	out(r1.3)
+	return
+`,
+			pseudocode: `func sub_0(r0) {
+	if r0 == 0 {
+		r1 = 2
+	} else {
+		r1 = 1
+	}
+	out(r1)
+	return
+}
+`,
+		},
+		{
+			// The call only redefines r0, the one register the function writes, and the version from before the
+			// call meets the one after it at the return.
+			name: "recursion",
+			program: []uint16{
+				// 0: jf r0 9
+				8, 32768, 9,
+				// 3: add r0 r0 32767
+				9, 32768, 32768, 32767,
+				// 7: call 0
+				17, 0,
+				// 9: ret
+				18,
+			},
+			params: []uint16{0},
+			ir: `0:
+	if r0.0 == 0 goto 9 else 3
+3:
+	r0.1 = r0.0 - 1
+	r0.2 = sub_0(r0.1)
+	goto 9
+9:
+	r0.3 = phi(r0.0, r0.2)
+	return
+`,
+			pseudocode: `func sub_0(r0) {
+	if r0 != 0 {
+		r0 = r0 - 1
+		sub_0(r0)
+	}
+	return
+}
+`,
+		},
+	} {
+		lifted, err := New(test.program).Lift(0)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(lifted.Params, test.params) {
+			t.Errorf("%v: expected parameters %v, got %v", test.name, test.params, lifted.Params)
+		}
+		if ir := lifted.IR(); ir != test.ir {
+			t.Errorf("%v: expected IR\n%v\ngot\n%v", test.name, test.ir, ir)
+		}
+		if pseudocode := lifted.Pseudocode(); pseudocode != test.pseudocode {
+			t.Errorf("%v: expected\n%v\ngot\n%v", test.name, test.pseudocode, pseudocode)
+		}
+	}
+}
+
+func TestBuildFunction(t *testing.T) {
+	// Branches end blocks and calls do not, whether they go through a register or not.
+	program := []uint16{
+		// 0: jt r0 8
+		7, 32768, 8,
+		// 3: call r1
+		17, 32769,
+		// 5: call 12
+		17, 12,
+		// 7: ret
+		18,
+		// 8: halt
+		0,
+	}
+	fn, err := BuildFunction(program, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var starts []uint16
+	for _, block := range fn.Blocks {
+		starts = append(starts, block.Start)
+	}
+	if expected := []uint16{0, 3, 8}; !reflect.DeepEqual(starts, expected) {
+		t.Errorf("expected blocks at %v, got %v", expected, starts)
+	}
+	if calls := fn.Calls(); !reflect.DeepEqual(calls, []uint16{12}) {
+		t.Errorf("expected a call to 12, got %v", calls)
+	}
+}
@@ -0,0 +1,215 @@
+package decompiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a value computed by the guest. Registers carry an SSA version: every definition gets a fresh version and
+// version 0 is the value the register held when the function was entered.
+type Expr interface {
+	format(ssa bool) string
+}
+
+type Const uint16
+
+type Reg struct {
+	Register uint16 // 0-7
+	Version  int
+}
+
+type BinOp struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Not is the 15-bit bitwise inverse.
+type Not struct {
+	X Expr
+}
+
+// Load reads a word from memory.
+type Load struct {
+	Address Expr
+}
+
+// Pop takes the top value off the stack.
+type Pop struct{}
+
+// Input reads one character from the terminal.
+type Input struct{}
+
+func (c Const) format(bool) string {
+	return strconv.Itoa(int(c))
+}
+
+func (r Reg) format(ssa bool) string {
+	if ssa {
+		return fmt.Sprintf("r%v.%v", r.Register, r.Version)
+	}
+	return fmt.Sprintf("r%v", r.Register)
+}
+
+func (b BinOp) format(ssa bool) string {
+	// add with a large constant is how the guest subtracts, e.g. "add r0 r0 32767" is r0 - 1.
+	if c, ok := b.Right.(Const); ok && b.Op == "+" && c >= 16384 {
+		return fmt.Sprintf("%v - %v", operand(b.Left, ssa), 32768-int(c))
+	}
+	return fmt.Sprintf("%v %v %v", operand(b.Left, ssa), b.Op, operand(b.Right, ssa))
+}
+
+func (n Not) format(ssa bool) string {
+	return "^" + operand(n.X, ssa)
+}
+
+func (l Load) format(ssa bool) string {
+	return fmt.Sprintf("mem[%v]", l.Address.format(ssa))
+}
+
+func (Pop) format(bool) string {
+	return "pop()"
+}
+
+func (Input) format(bool) string {
+	return "in()"
+}
+
+// Wraps compound expressions in parentheses when they are nested in another expression.
+func operand(expr Expr, ssa bool) string {
+	if _, ok := expr.(BinOp); ok {
+		return "(" + expr.format(ssa) + ")"
+	}
+	return expr.format(ssa)
+}
+
+// Stmt is a single effect in a lifted block.
+type Stmt interface {
+	format(ssa bool) string
+}
+
+// Assign defines a new version of a register.
+type Assign struct {
+	Dst Reg
+	Src Expr
+}
+
+// Store writes to memory, either through wmem or through an instruction whose destination is not a register.
+type Store struct {
+	Address Expr
+	Value   Expr
+}
+
+type Push struct {
+	Value Expr
+}
+
+// Call passes the registers the callee reads, and defines new versions of the ones it may overwrite.
+type Call struct {
+	Target Expr
+	Args   []Reg
+	Defs   []Reg
+}
+
+// Output writes one character to the terminal.
+type Output struct {
+	Value Expr
+}
+
+func (a Assign) format(ssa bool) string {
+	return fmt.Sprintf("%v = %v", a.Dst.format(ssa), a.Src.format(ssa))
+}
+
+func (s Store) format(ssa bool) string {
+	return fmt.Sprintf("mem[%v] = %v", s.Address.format(ssa), s.Value.format(ssa))
+}
+
+func (p Push) format(ssa bool) string {
+	return fmt.Sprintf("push(%v)", p.Value.format(ssa))
+}
+
+func (c Call) format(ssa bool) string {
+	var args []string
+	for _, arg := range c.Args {
+		args = append(args, arg.format(ssa))
+	}
+	call := fmt.Sprintf("call(%v)", c.Target.format(ssa))
+	if target, ok := c.Target.(Const); ok {
+		call = fmt.Sprintf("%v(%v)", FunctionName(uint16(target)), strings.Join(args, ", "))
+	}
+
+	if !ssa || len(c.Defs) == 0 {
+		return call
+	}
+	var defs []string
+	for _, def := range c.Defs {
+		defs = append(defs, def.format(ssa))
+	}
+	return fmt.Sprintf("%v = %v", strings.Join(defs, ", "), call)
+}
+
+func (o Output) format(ssa bool) string {
+	if c, ok := o.Value.(Const); ok && c < 128 {
+		return fmt.Sprintf("out(%q)", rune(c))
+	}
+	return fmt.Sprintf("out(%v)", o.Value.format(ssa))
+}
+
+// Phi merges the versions of a register flowing in from each predecessor, in the order of Block.Preds. The entry block
+// also merges the version the function was called with, which comes last.
+type Phi struct {
+	Dst  Reg
+	Args []Reg
+}
+
+func (p Phi) format(ssa bool) string {
+	var args []string
+	for _, arg := range p.Args {
+		args = append(args, arg.format(ssa))
+	}
+	return fmt.Sprintf("%v = phi(%v)", p.Dst.format(ssa), strings.Join(args, ", "))
+}
+
+type TermKind int
+
+const (
+	// TermFall continues with the single successor, through a literal jmp or by running into the next block.
+	TermFall TermKind = iota
+	// TermBranch goes to Succs[0] when Cond is true and to Succs[1] otherwise. When the destination is a register it
+	// is kept in Target instead, and Succs only holds the fall through.
+	TermBranch
+	TermReturn
+	TermHalt
+	// TermJump is a jmp through a register, which cannot be followed statically.
+	TermJump
+)
+
+// Terminator describes how control leaves a lifted block.
+type Terminator struct {
+	Kind TermKind
+	// Value tested by a branch. IfZero is set for jf.
+	Cond   Expr
+	IfZero bool
+	// Destination of an indirect jump.
+	Target Expr
+}
+
+func (t Terminator) condition(ssa bool, negate bool) string {
+	if t.IfZero != negate {
+		return fmt.Sprintf("%v == 0", operand(t.Cond, ssa))
+	}
+	return fmt.Sprintf("%v != 0", operand(t.Cond, ssa))
+}
+
+// LiftedBlock is a basic block translated into IR.
+type LiftedBlock struct {
+	*Block
+	Phis []Phi
+	Body []Stmt
+	Term Terminator
+}
+
+// FunctionName is how calls to the function at address are shown.
+func FunctionName(address uint16) string {
+	return fmt.Sprintf("sub_%v", address)
+}
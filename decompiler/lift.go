@@ -0,0 +1,387 @@
+package decompiler
+
+var binaryOps = map[uint16]string{
+	4:  "==",
+	5:  ">",
+	9:  "+",
+	10: "*",
+	11: "%",
+	12: "&",
+	13: "|",
+}
+
+// Returns the register written by ins, if any. Instructions that take a destination always have it as the first operand.
+func destination(ins Instruction) (uint16, bool) {
+	switch ins.Op {
+	case 1, 3, 4, 5, 9, 10, 11, 12, 13, 14, 15, 20:
+		if IsRegister(ins.Operands[0]) {
+			return ins.Operands[0] - 32768, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the registers read by ins, not counting the ones read by a called function.
+func uses(ins Instruction) []uint16 {
+	operands := ins.Operands
+	switch ins.Op {
+	case 1, 3, 4, 5, 9, 10, 11, 12, 13, 14, 15, 20:
+		operands = operands[1:]
+	}
+
+	var result []uint16
+	for _, operand := range operands {
+		if IsRegister(operand) {
+			result = append(result, operand-32768)
+		}
+	}
+	return result
+}
+
+// Which registers a function reads before writing them, and which it may overwrite, including through its callees.
+type summary struct {
+	reads  [8]bool
+	writes [8]bool
+}
+
+// Decompiler lifts and structures functions from a single memory image.
+type Decompiler struct {
+	memory    []uint16
+	summaries map[uint16]*summary
+}
+
+func New(memory []uint16) *Decompiler {
+	return &Decompiler{
+		memory:    memory,
+		summaries: map[uint16]*summary{},
+	}
+}
+
+// Returns the summary of the function at entry. Recursive calls see the summary as it is being built.
+func (d *Decompiler) summary(entry uint16) *summary {
+	if sum, ok := d.summaries[entry]; ok {
+		return sum
+	}
+
+	sum := &summary{}
+	d.summaries[entry] = sum
+
+	fn, err := BuildFunction(d.memory, entry)
+	if err != nil {
+		// Unknown code may touch anything.
+		for r := range sum.reads {
+			sum.reads[r] = true
+			sum.writes[r] = true
+		}
+		return sum
+	}
+
+	for _, block := range fn.Blocks {
+		for _, ins := range block.Instructions {
+			if r, ok := destination(ins); ok {
+				sum.writes[r] = true
+			}
+			if ins.Op == opCall {
+				callee := d.callSummary(ins.Operands[0])
+				for r, written := range callee.writes {
+					sum.writes[r] = sum.writes[r] || written
+				}
+			}
+		}
+	}
+
+	sum.reads = d.liveIn(fn)[fn.Block(entry)]
+	return sum
+}
+
+// Returns the summary for a call through operand, assuming the worst for calls through a register.
+func (d *Decompiler) callSummary(operand uint16) *summary {
+	if IsRegister(operand) {
+		everything := &summary{}
+		for r := range everything.reads {
+			everything.reads[r] = true
+			everything.writes[r] = true
+		}
+		return everything
+	}
+	return d.summary(operand)
+}
+
+// Computes the registers that are live on entry to every block.
+func (d *Decompiler) liveIn(fn *Function) map[*Block][8]bool {
+	live := map[*Block][8]bool{}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(fn.Blocks) - 1; i >= 0; i-- {
+			block := fn.Blocks[i]
+
+			var current [8]bool
+			for _, succ := range block.Succs {
+				for r, isLive := range live[succ] {
+					current[r] = current[r] || isLive
+				}
+			}
+
+			for j := len(block.Instructions) - 1; j >= 0; j-- {
+				ins := block.Instructions[j]
+				if r, ok := destination(ins); ok {
+					current[r] = false
+				}
+				for _, r := range uses(ins) {
+					current[r] = true
+				}
+				if ins.Op == opCall {
+					for r, read := range d.callSummary(ins.Operands[0]).reads {
+						current[r] = current[r] || read
+					}
+				}
+			}
+
+			if current != live[block] {
+				live[block] = current
+				changed = true
+			}
+		}
+	}
+
+	return live
+}
+
+// Lifted is a function translated into SSA form.
+type Lifted struct {
+	*Function
+	Blocks []*LiftedBlock // ordered by address
+	// Registers the function reads before writing them.
+	Params []uint16
+	lifted map[*Block]*LiftedBlock
+}
+
+// Lift builds the control flow graph of the function at entry and translates it into IR.
+func (d *Decompiler) Lift(entry uint16) (*Lifted, error) {
+	fn, err := BuildFunction(d.memory, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Lifted{Function: fn, lifted: map[*Block]*LiftedBlock{}}
+	for r, read := range d.summary(entry).reads {
+		if read {
+			result.Params = append(result.Params, uint16(r))
+		}
+	}
+
+	versions := newVersioning(d, fn)
+	for _, block := range fn.Blocks {
+		lifted := versions.lift(block)
+		result.Blocks = append(result.Blocks, lifted)
+		result.lifted[block] = lifted
+	}
+
+	return result, nil
+}
+
+// Assigns SSA versions to every register definition and merge point in a function.
+type versioning struct {
+	d    *Decompiler
+	fn   *Function
+	next [8]int
+	// Version defined by the instruction at an address, per register.
+	defs map[uint16]map[uint16]int
+	// Version of the phi for a register at the top of a block.
+	phis map[*Block]map[uint16]int
+	in   map[*Block][8]int
+	out  map[*Block][8]int
+}
+
+func newVersioning(d *Decompiler, fn *Function) *versioning {
+	v := &versioning{
+		d:    d,
+		fn:   fn,
+		defs: map[uint16]map[uint16]int{},
+		phis: map[*Block]map[uint16]int{},
+		in:   map[*Block][8]int{},
+		out:  map[*Block][8]int{},
+	}
+
+	unknown := [8]int{-1, -1, -1, -1, -1, -1, -1, -1}
+	for _, block := range fn.Blocks {
+		v.out[block] = unknown
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, block := range fn.Blocks {
+			entry := v.merge(block)
+			v.in[block] = entry
+
+			current := entry
+			for _, ins := range block.Instructions {
+				for _, r := range v.defined(ins) {
+					current[r] = v.version(v.defs, ins.Address, r)
+				}
+			}
+
+			if current != v.out[block] {
+				v.out[block] = current
+				changed = true
+			}
+		}
+	}
+
+	return v
+}
+
+// Works out the version of each register at the top of a block, introducing a phi where predecessors disagree.
+func (v *versioning) merge(block *Block) [8]int {
+	var entry [8]int
+	for r := uint16(0); r < 8; r++ {
+		if version, ok := v.phis[block][r]; ok {
+			entry[r] = version
+			continue
+		}
+
+		incoming := map[int]bool{}
+		if block.Start == v.fn.Entry {
+			incoming[0] = true
+		}
+		for _, pred := range block.Preds {
+			if version := v.out[pred][r]; version >= 0 {
+				incoming[version] = true
+			}
+		}
+
+		entry[r] = -1
+		for version := range incoming {
+			entry[r] = version
+		}
+		if len(incoming) > 1 {
+			if v.phis[block] == nil {
+				v.phis[block] = map[uint16]int{}
+			}
+			v.next[r]++
+			v.phis[block][r] = v.next[r]
+			entry[r] = v.next[r]
+		}
+	}
+	return entry
+}
+
+// Returns the registers that get a new version at ins: its destination, or everything a callee may overwrite.
+func (v *versioning) defined(ins Instruction) []uint16 {
+	if r, ok := destination(ins); ok {
+		return []uint16{r}
+	}
+
+	var result []uint16
+	if ins.Op == opCall {
+		for r, written := range v.d.callSummary(ins.Operands[0]).writes {
+			if written {
+				result = append(result, uint16(r))
+			}
+		}
+	}
+	return result
+}
+
+func (v *versioning) version(table map[uint16]map[uint16]int, address uint16, r uint16) int {
+	if table[address] == nil {
+		table[address] = map[uint16]int{}
+	}
+	if version, ok := table[address][r]; ok {
+		return version
+	}
+	v.next[r]++
+	table[address][r] = v.next[r]
+	return v.next[r]
+}
+
+// Translates the instructions of a block into IR using the versions settled on by newVersioning.
+func (v *versioning) lift(block *Block) *LiftedBlock {
+	lifted := &LiftedBlock{Block: block}
+	current := v.in[block]
+
+	for r := uint16(0); r < 8; r++ {
+		version, ok := v.phis[block][r]
+		if !ok {
+			continue
+		}
+		phi := Phi{Dst: Reg{Register: r, Version: version}}
+		for _, pred := range block.Preds {
+			phi.Args = append(phi.Args, Reg{Register: r, Version: v.out[pred][r]})
+		}
+		if block.Start == v.fn.Entry {
+			phi.Args = append(phi.Args, Reg{Register: r})
+		}
+		lifted.Phis = append(lifted.Phis, phi)
+	}
+
+	value := func(operand uint16) Expr {
+		if IsRegister(operand) {
+			return Reg{Register: operand - 32768, Version: current[operand-32768]}
+		}
+		return Const(operand)
+	}
+
+	define := func(ins Instruction, src Expr) {
+		dst := ins.Operands[0]
+		if !IsRegister(dst) {
+			lifted.Body = append(lifted.Body, Store{Address: Const(dst), Value: src})
+			return
+		}
+		r := dst - 32768
+		current[r] = v.defs[ins.Address][r]
+		lifted.Body = append(lifted.Body, Assign{Dst: Reg{Register: r, Version: current[r]}, Src: src})
+	}
+
+	for _, ins := range block.Instructions {
+		args := ins.Operands
+		switch ins.Op {
+		case 0:
+			lifted.Term = Terminator{Kind: TermHalt}
+		case 1:
+			define(ins, value(args[1]))
+		case 2:
+			lifted.Body = append(lifted.Body, Push{Value: value(args[0])})
+		case 3:
+			define(ins, Pop{})
+		case 4, 5, 9, 10, 11, 12, 13:
+			define(ins, BinOp{Op: binaryOps[ins.Op], Left: value(args[1]), Right: value(args[2])})
+		case 6:
+			if IsRegister(args[0]) {
+				lifted.Term = Terminator{Kind: TermJump, Target: value(args[0])}
+			}
+		case 7, 8:
+			lifted.Term = Terminator{Kind: TermBranch, Cond: value(args[0]), IfZero: ins.Op == opJf}
+			if IsRegister(args[1]) {
+				lifted.Term.Target = value(args[1])
+			}
+		case 14:
+			define(ins, Not{X: value(args[1])})
+		case 15:
+			define(ins, Load{Address: value(args[1])})
+		case 16:
+			lifted.Body = append(lifted.Body, Store{Address: value(args[0]), Value: value(args[1])})
+		case 17:
+			call := Call{Target: value(args[0])}
+			for r, read := range v.d.callSummary(args[0]).reads {
+				if read {
+					call.Args = append(call.Args, Reg{Register: uint16(r), Version: current[r]})
+				}
+			}
+			for _, r := range v.defined(ins) {
+				current[r] = v.defs[ins.Address][r]
+				call.Defs = append(call.Defs, Reg{Register: r, Version: current[r]})
+			}
+			lifted.Body = append(lifted.Body, call)
+		case 18:
+			lifted.Term = Terminator{Kind: TermReturn}
+		case 19:
+			lifted.Body = append(lifted.Body, Output{Value: value(args[0])})
+		case 20:
+			define(ins, Input{})
+		}
+	}
+
+	return lifted
+}
@@ -0,0 +1,406 @@
+package decompiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Computes the immediate post-dominator of every block. nil means the paths leaving a block only meet again when the
+// function returns.
+func postDominators(fn *Function) map[*Block]*Block {
+	count := len(fn.Blocks)
+	exit := count
+	index := map[*Block]int{}
+	for i, block := range fn.Blocks {
+		index[block] = i
+	}
+
+	// pdom[i][j] is set when block j (or the exit, for j == count) post-dominates block i.
+	pdom := make([][]bool, count)
+	for i, block := range fn.Blocks {
+		pdom[i] = make([]bool, count+1)
+		for j := range pdom[i] {
+			pdom[i][j] = len(block.Succs) > 0
+		}
+		if len(block.Succs) == 0 {
+			pdom[i][i] = true
+			pdom[i][exit] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := count - 1; i >= 0; i-- {
+			block := fn.Blocks[i]
+			if len(block.Succs) == 0 {
+				continue
+			}
+
+			for j := 0; j <= count; j++ {
+				value := j == i
+				if !value {
+					value = true
+					for _, succ := range block.Succs {
+						value = value && pdom[index[succ]][j]
+					}
+				}
+				if value != pdom[i][j] {
+					pdom[i][j] = value
+					changed = true
+				}
+			}
+		}
+	}
+
+	size := func(set []bool) int {
+		result := 0
+		for _, member := range set {
+			if member {
+				result++
+			}
+		}
+		return result
+	}
+
+	result := map[*Block]*Block{}
+	for i, block := range fn.Blocks {
+		// The closest strict post-dominator is the one that is itself post-dominated by all the others.
+		strict := size(pdom[i]) - 1
+		for j := 0; j < count; j++ {
+			if j != i && pdom[i][j] && size(pdom[j]) == strict {
+				result[block] = fn.Blocks[j]
+			}
+		}
+	}
+	return result
+}
+
+type loop struct {
+	header *Block
+	body   map[*Block]bool
+	// Where a break goes. nil when the loop can only be left by returning.
+	exit *Block
+}
+
+// Finds the natural loops of a function, keyed by their header.
+func findLoops(fn *Function, ipdom map[*Block]*Block) map[*Block]*loop {
+	loops := map[*Block]*loop{}
+	visited := map[*Block]bool{}
+	onStack := map[*Block]bool{}
+
+	var visit func(block *Block)
+	visit = func(block *Block) {
+		visited[block] = true
+		onStack[block] = true
+		for _, succ := range block.Succs {
+			if onStack[succ] {
+				addBackEdge(loops, block, succ)
+			} else if !visited[succ] {
+				visit(succ)
+			}
+		}
+		onStack[block] = false
+	}
+	visit(fn.Block(fn.Entry))
+
+	for _, l := range loops {
+		var candidates []*Block
+		for block := range l.body {
+			for _, succ := range block.Succs {
+				if !l.body[succ] {
+					candidates = append(candidates, succ)
+				}
+			}
+		}
+
+		if next := ipdom[l.header]; next != nil && !l.body[next] {
+			l.exit = next
+			continue
+		}
+		for _, candidate := range candidates {
+			if l.exit == nil || candidate.Start < l.exit.Start {
+				l.exit = candidate
+			}
+		}
+	}
+
+	return loops
+}
+
+// Adds the blocks of the natural loop formed by the edge from tail back to header.
+func addBackEdge(loops map[*Block]*loop, tail *Block, header *Block) {
+	l, ok := loops[header]
+	if !ok {
+		l = &loop{header: header, body: map[*Block]bool{header: true}}
+		loops[header] = l
+	}
+
+	pending := []*Block{tail}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if l.body[block] {
+			continue
+		}
+		l.body[block] = true
+		pending = append(pending, block.Preds...)
+	}
+}
+
+type line struct {
+	depth int
+	text  string
+	// Set on the marker placed in front of each block, which becomes a label if anything jumps there.
+	label *Block
+}
+
+// Turns the control flow graph of a lifted function back into nested ifs and loops, falling back to goto where the
+// graph does not fit.
+type structurer struct {
+	fn      *Lifted
+	ipdom   map[*Block]*Block
+	loops   map[*Block]*loop
+	active  []*loop
+	emitted map[*Block]bool
+	targets map[*Block]bool
+	lines   []line
+}
+
+// Pseudocode renders the function as structured Go-like code. Arithmetic is modulo 32768 and comparisons yield 1 or 0.
+func (fn *Lifted) Pseudocode() string {
+	ipdom := postDominators(fn.Function)
+	s := &structurer{
+		fn:      fn,
+		ipdom:   ipdom,
+		loops:   findLoops(fn.Function, ipdom),
+		emitted: map[*Block]bool{},
+		targets: map[*Block]bool{},
+	}
+
+	s.region(fn.Block(fn.Entry), nil, 1)
+	for _, block := range fn.Function.Blocks {
+		if !s.emitted[block] {
+			s.region(block, nil, 1)
+		}
+	}
+
+	var params []string
+	for _, r := range fn.Params {
+		params = append(params, fmt.Sprintf("r%v", r))
+	}
+
+	result := strings.Builder{}
+	result.WriteString(fmt.Sprintf("func %v(%v) {\n", FunctionName(fn.Entry), strings.Join(params, ", ")))
+	for _, l := range s.lines {
+		if l.label != nil {
+			if s.targets[l.label] {
+				result.WriteString(fmt.Sprintf("%vL%v:\n", strings.Repeat("\t", l.depth-1), l.label.Start))
+			}
+			continue
+		}
+		result.WriteString(strings.Repeat("\t", l.depth) + l.text + "\n")
+	}
+	result.WriteString("}\n")
+	return result.String()
+}
+
+func (s *structurer) add(depth int, format string, args ...interface{}) {
+	s.lines = append(s.lines, line{depth: depth, text: fmt.Sprintf(format, args...)})
+}
+
+func (s *structurer) jump(block *Block, depth int) {
+	s.targets[block] = true
+	s.add(depth, "goto L%v", block.Start)
+}
+
+// Emits everything from block up to, but not including, stop.
+func (s *structurer) region(block *Block, stop *Block, depth int) {
+	for block != nil && block != stop {
+		if s.leave(block, depth) {
+			return
+		}
+		if s.emitted[block] {
+			s.jump(block, depth)
+			return
+		}
+
+		if l, ok := s.loops[block]; ok {
+			s.add(depth, "for {")
+			s.active = append(s.active, l)
+			start := len(s.lines)
+			s.region(s.step(block, depth+1), nil, depth+1)
+			s.active = s.active[:len(s.active)-1]
+
+			// Running off the end of the loop body already continues.
+			if last := len(s.lines) - 1; last >= start && s.lines[last].text == "continue" && s.lines[last].depth == depth+1 {
+				s.lines = s.lines[:last]
+			}
+			s.add(depth, "}")
+
+			block = l.exit
+			continue
+		}
+
+		block = s.step(block, depth)
+	}
+}
+
+// Emits continue, break or goto when block is the header or exit of a loop being emitted.
+func (s *structurer) leave(block *Block, depth int) bool {
+	for i := len(s.active) - 1; i >= 0; i-- {
+		l := s.active[i]
+		if block != l.header && block != l.exit {
+			continue
+		}
+
+		if i < len(s.active)-1 {
+			s.jump(block, depth)
+		} else if block == l.header {
+			s.add(depth, "continue")
+		} else {
+			s.add(depth, "break")
+		}
+		return true
+	}
+	return false
+}
+
+// Emits a single block and returns the block control continues with, or nil if it does not continue.
+func (s *structurer) step(block *Block, depth int) *Block {
+	s.emitted[block] = true
+	s.lines = append(s.lines, line{depth: depth, label: block})
+
+	lifted := s.fn.lifted[block]
+	s.body(lifted.Body, depth)
+
+	term := lifted.Term
+	switch term.Kind {
+	case TermReturn:
+		s.add(depth, "return")
+		return nil
+	case TermHalt:
+		s.add(depth, "halt()")
+		return nil
+	case TermJump:
+		s.add(depth, "jump(%v)", term.Target.format(false))
+		return nil
+	case TermBranch:
+		if term.Target != nil {
+			s.add(depth, "if %v {", term.condition(false, false))
+			s.add(depth+1, "jump(%v)", term.Target.format(false))
+			s.add(depth, "}")
+			return block.Succs[0]
+		}
+
+		join := s.ipdom[block]
+		if join == nil {
+			// Neither side comes back, so one of them can go in the if and the other follows it without nesting.
+			// Prefer the side that ends straight away, like an error message followed by halt.
+			inner, rest, negate := block.Succs[0], block.Succs[1], false
+			if len(rest.Succs) == 0 && len(inner.Succs) > 0 {
+				inner, rest, negate = rest, inner, true
+			}
+			lines := s.branch(inner, nil, depth+1)
+			s.add(depth, "if %v {", term.condition(false, negate))
+			s.lines = append(s.lines, lines...)
+			s.add(depth, "}")
+			return rest
+		}
+
+		taken := s.branch(block.Succs[0], join, depth+1)
+		fall := s.branch(block.Succs[1], join, depth+1)
+
+		switch {
+		case len(taken) == 0 && len(fall) == 0:
+		case len(taken) == 0:
+			s.add(depth, "if %v {", term.condition(false, true))
+			s.lines = append(s.lines, fall...)
+			s.add(depth, "}")
+		default:
+			s.add(depth, "if %v {", term.condition(false, false))
+			s.lines = append(s.lines, taken...)
+			if len(fall) > 0 {
+				s.add(depth, "} else {")
+				s.lines = append(s.lines, fall...)
+			}
+			s.add(depth, "}")
+		}
+		return join
+	}
+
+	if len(block.Succs) == 0 {
+		return nil
+	}
+	return block.Succs[0]
+}
+
+// Emits one side of an if into a separate list of lines.
+func (s *structurer) branch(block *Block, join *Block, depth int) []line {
+	outer := s.lines
+	s.lines = nil
+	s.region(block, join, depth)
+	result := s.lines
+	s.lines = outer
+	return result
+}
+
+// Emits the statements of a block, merging runs of printable characters into a single print.
+func (s *structurer) body(stmts []Stmt, depth int) {
+	text := strings.Builder{}
+	flush := func() {
+		if text.Len() > 0 {
+			s.add(depth, "print(%v)", strconv.Quote(text.String()))
+			text.Reset()
+		}
+	}
+
+	for _, stmt := range stmts {
+		if out, ok := stmt.(Output); ok {
+			if c, ok := out.Value.(Const); ok && (c == '\n' || (c >= 32 && c < 127)) {
+				text.WriteRune(rune(c))
+				continue
+			}
+		}
+		flush()
+		s.add(depth, "%v", stmt.format(false))
+	}
+	flush()
+}
+
+// IR lists every block of the function in SSA form.
+func (fn *Lifted) IR() string {
+	result := strings.Builder{}
+	for _, block := range fn.Blocks {
+		result.WriteString(fmt.Sprintf("%v:\n", block.Start))
+		for _, phi := range block.Phis {
+			result.WriteString("\t" + phi.format(true) + "\n")
+		}
+		for _, stmt := range block.Body {
+			result.WriteString("\t" + stmt.format(true) + "\n")
+		}
+
+		term := block.Term
+		switch term.Kind {
+		case TermReturn:
+			result.WriteString("\treturn\n")
+		case TermHalt:
+			result.WriteString("\thalt\n")
+		case TermJump:
+			result.WriteString(fmt.Sprintf("\tjump %v\n", term.Target.format(true)))
+		case TermBranch:
+			taken := ""
+			if term.Target != nil {
+				taken = term.Target.format(true)
+			} else {
+				taken = strconv.Itoa(int(block.Succs[0].Start))
+			}
+			result.WriteString(fmt.Sprintf("\tif %v goto %v else %v\n", term.condition(true, false), taken, block.Succs[len(block.Succs)-1].Start))
+		default:
+			if len(block.Succs) > 0 {
+				result.WriteString(fmt.Sprintf("\tgoto %v\n", block.Succs[0].Start))
+			}
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,173 @@
+package gameserver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Greets and then echoes what it reads.
+var echo = assembler.MustAssemble(`
+	out 'h'
+	out 'i'
+	out 10
+loop:
+	in r0
+	out r0
+	jmp loop
+`)
+
+// Counts the lines it reads, printing the count after each of them.
+var counter = assembler.MustAssemble(`
+loop:
+	in r0
+	eq r1 r0 10
+	jf r1 loop
+	add r2 r2 1
+	add r3 r2 '0'
+	out r3
+	out 10
+	jmp loop
+`)
+
+// Serves program, telling onSession about sessions if it is not nil.
+func listen(t *testing.T, program []uint16, config Config, onSession func(SessionInfo, bool, error)) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(VirtualMachine.New(program), config)
+	server.OnSession = onSession
+	go server.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+	return server, listener.Addr().String()
+}
+
+type player struct {
+	conn     net.Conn
+	received string
+}
+
+func connect(t *testing.T, address string) *player {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &player{conn: conn}
+}
+
+func (player *player) send(t *testing.T, text string) {
+	if _, err := player.conn.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads until expected arrives, and forgets what came before it.
+func (player *player) expect(t *testing.T, expected string) {
+	t.Helper()
+	buffer := make([]byte, 1024)
+	for !strings.Contains(player.received, expected) {
+		read, err := player.conn.Read(buffer)
+		if err != nil {
+			t.Fatalf("expected %q, got %q and then %v", expected, player.received, err)
+		}
+		player.received += string(buffer[:read])
+	}
+	player.received = player.received[strings.Index(player.received, expected)+len(expected):]
+}
+
+func TestSession(t *testing.T) {
+	server, address := listen(t, echo, Config{}, nil)
+	first, second := connect(t, address), connect(t, address)
+	first.expect(t, "Welcome to session ")
+	first.expect(t, "hi\r\n")
+	second.expect(t, "hi\r\n")
+
+	// Telnet clients end lines with a carriage return and negotiate options.
+	first.send(t, "look\r\n\xff\xfd\x01\xff\xfa\x18\x01\xff\xf0x\n")
+	first.expect(t, "look\r\nx\r\n")
+
+	// The hacks are off, so the game reads these lines.
+	path := filepath.Join(t.TempDir(), "state.json")
+	first.send(t, "set 5\nxsave state "+path+"\n")
+	first.expect(t, "set 5\r\nxsave state "+path+"\r\n")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no state to be saved, got %v", err)
+	}
+
+	second.send(t, "sessions\n")
+	second.expect(t, "1 from 127.0.0.1:")
+	second.expect(t, "2 from 127.0.0.1:")
+	if sessions := server.Sessions(); len(sessions) != 2 || sessions[0].ID != 1 || sessions[1].ID != 2 {
+		t.Errorf("expected sessions 1 and 2, got %v", sessions)
+	}
+
+	first.conn.Close()
+	waitForSessions(t, server, 1)
+}
+
+// Waits for the server to be left with count sessions.
+func waitForSessions(t *testing.T, server *Server, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Sessions()) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v sessions, got %v", count, server.Sessions())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSlots(t *testing.T) {
+	_, address := listen(t, counter, Config{Slots: 1}, nil)
+	first, second := connect(t, address), connect(t, address)
+	first.expect(t, "Welcome to session ")
+
+	for _, step := range []struct{ input, expected string }{
+		{"look", "1\r\n"},
+		{"save a", "Saved to slot a\r\n"},
+		{"save b", "All 1 slots are in use, save to one of a instead\r\n"},
+		{"save state /tmp/synacor", "Usage: save <slot>\r\n"},
+		{"look", "2\r\n"},
+		{"look", "3\r\n"},
+		{"load a", "Loaded slot a\r\n"},
+		{"look", "2\r\n"},
+		{"slots", "a\r\n"},
+	} {
+		first.send(t, step.input+"\n")
+		first.expect(t, step.expected)
+	}
+	second.send(t, "load a\n")
+	second.expect(t, "There is no slot a\r\n")
+}
+
+func TestLimits(t *testing.T) {
+	forever := assembler.MustAssemble(`
+loop:
+	jmp loop
+`)
+	server, address := listen(t, forever, Config{Budget: 100_000}, nil)
+	connect(t, address).expect(t, "This session ran out of instructions, goodbye.\r\n")
+	waitForSessions(t, server, 0)
+
+	ended := make(chan error, 1)
+	_, address = listen(t, echo, Config{IdleTimeout: 50 * time.Millisecond}, func(info SessionInfo, done bool, reason error) {
+		if done {
+			ended <- reason
+		}
+	})
+	player := connect(t, address)
+	player.expect(t, "hi\r\n")
+	player.expect(t, "This session was idle for too long, goodbye.\r\n")
+	if reason := <-ended; reason != ErrIdle {
+		t.Errorf("expected the session to end for being idle, got %v", reason)
+	}
+}
@@ -0,0 +1,255 @@
+// Package gameserver hosts the game on a TCP port. Every connection plays its own copy of the VM, reading what the
+// player types on the socket and printing back to it, so that plain nc or telnet is enough to play. A session ends
+// when the game halts, when the player leaves, when nothing is typed for the idle timeout or when the session has
+// executed its budget of instructions. Players keep their progress in save slots that belong to their session. The
+// hacks of the VM are off in every session, as some of them read and write files on the server.
+package gameserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Config limits what a session can take from the server. Zero values mean no limit.
+type Config struct {
+	// Instructions a session can execute before it is ended.
+	Budget uint64
+	// How long a session can wait for the player to type something.
+	IdleTimeout time.Duration
+	// Save slots a session can keep.
+	Slots int
+}
+
+// Server plays a copy of the same VM on every connection.
+type Server struct {
+	template *VirtualMachine.VirtualMachine
+	config   Config
+	// Called when a session starts and ends, if it is set.
+	OnSession func(info SessionInfo, ended bool, reason error)
+
+	mu       sync.Mutex
+	sessions map[int]*Session
+	next     int
+}
+
+// Session is one connection and its VM.
+type Session struct {
+	ID      int
+	Remote  string
+	Started time.Time
+
+	// Updated by the session as it runs, so that the session list can read them from other goroutines.
+	steps     atomic.Uint64
+	lastInput atomic.Int64
+
+	// Only used by the commands, which run on the session's goroutine.
+	slots map[string][]byte
+}
+
+// SessionInfo describes a running session.
+type SessionInfo struct {
+	ID      int
+	Remote  string
+	Started time.Time
+	Steps   uint64
+	Idle    time.Duration
+}
+
+func (info SessionInfo) String() string {
+	return fmt.Sprintf("%v from %v, up %v, %v instructions, idle %v", info.ID, info.Remote,
+		time.Since(info.Started).Round(time.Second), info.Steps, info.Idle.Round(time.Second))
+}
+
+// Reasons sessions end other than the game halting or the player leaving.
+var (
+	ErrIdle   = errors.New("was idle for too long")
+	ErrBudget = errors.New("ran out of instructions")
+)
+
+// NewServer hosts copies of template, in the state it is in, limited by config. template is only ever copied.
+func NewServer(template *VirtualMachine.VirtualMachine, config Config) *Server {
+	return &Server{template: template, config: config, sessions: map[int]*Session{}, next: 1}
+}
+
+// Serve plays a session on every connection listener accepts, until it is closed.
+func (server *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go server.play(conn)
+	}
+}
+
+// Sessions lists the sessions being played, the oldest first.
+func (server *Server) Sessions() []SessionInfo {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	infos := make([]SessionInfo, 0, len(server.sessions))
+	for _, session := range server.sessions {
+		infos = append(infos, session.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (session *Session) info() SessionInfo {
+	return SessionInfo{
+		ID:      session.ID,
+		Remote:  session.Remote,
+		Started: session.Started,
+		Steps:   session.steps.Load(),
+		Idle:    time.Since(time.Unix(0, session.lastInput.Load())),
+	}
+}
+
+// Registers a session for conn and returns it with its own copy of the template.
+func (server *Server) start(conn net.Conn) (*Session, *VirtualMachine.VirtualMachine) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	session := &Session{ID: server.next, Remote: conn.RemoteAddr().String(), Started: time.Now(), slots: map[string][]byte{}}
+	session.lastInput.Store(session.Started.UnixNano())
+	server.next++
+	server.sessions[session.ID] = session
+	// Cloning gives up the template's pages, so only one session can clone it at a time.
+	vm := server.template.Clone()
+	vm.DisableHacks()
+	return session, vm
+}
+
+func (server *Server) end(session *Session, reason error) {
+	server.mu.Lock()
+	delete(server.sessions, session.ID)
+	server.mu.Unlock()
+	if server.OnSession != nil {
+		server.OnSession(session.info(), true, reason)
+	}
+}
+
+// Plays a session on conn until it ends.
+func (server *Server) play(conn net.Conn) {
+	defer conn.Close()
+	session, vm := server.start(conn)
+	if server.OnSession != nil {
+		server.OnSession(session.info(), false, nil)
+	}
+
+	output := bufio.NewWriter(&telnetWriter{conn: conn})
+	vm.SetIO(&telnetReader{conn: conn, output: output, idle: server.config.IdleTimeout, session: session}, output)
+	server.install(vm, session)
+	fmt.Fprintf(output, "Welcome to session %v. Type save <slot> and load <slot> to keep your progress, slots to list "+
+		"them and sessions to see who else is playing.\n\n", session.ID)
+
+	reason := server.run(vm, session)
+	switch {
+	case errors.Is(reason, ErrIdle), errors.Is(reason, ErrBudget):
+		fmt.Fprintf(output, "\nThis session %v, goodbye.\n", reason)
+	case reason != nil && !errors.Is(reason, io.EOF) && !errors.Is(reason, net.ErrClosed):
+		fmt.Fprintf(output, "\nThis session failed: %v\n", reason)
+	}
+	output.Flush()
+	server.end(session, reason)
+}
+
+// Runs vm until the game halts or the session has to end, and returns why it ended, which is nil for a halt.
+func (server *Server) run(vm *VirtualMachine.VirtualMachine, session *Session) error {
+	engine := VirtualMachine.NewThreaded(vm)
+	start := vm.Steps
+	defer func() {
+		session.steps.Store(vm.Steps - start)
+	}()
+
+	for {
+		halted, err := engine.Step()
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return ErrIdle
+		case err != nil:
+			return err
+		case halted:
+			return nil
+		}
+
+		executed := vm.Steps - start
+		if executed%4096 == 0 {
+			session.steps.Store(executed)
+		}
+		if server.config.Budget != 0 && executed >= server.config.Budget {
+			return ErrBudget
+		}
+	}
+}
+
+// Adds the commands for save slots and the session list to vm. Slots are kept in memory and belong to the session.
+func (server *Server) install(vm *VirtualMachine.VirtualMachine, session *Session) {
+	vm.AddCommand("save", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		if len(args) != 1 {
+			fmt.Fprintln(output, "Usage: save <slot>")
+			return
+		}
+		if _, ok := session.slots[args[0]]; !ok && server.config.Slots != 0 && len(session.slots) >= server.config.Slots {
+			fmt.Fprintf(output, "All %v slots are in use, save to one of %v instead\n", server.config.Slots,
+				strings.Join(session.slotNames(), ", "))
+			return
+		}
+		snapshot, err := vm.Snapshot()
+		if err != nil {
+			fmt.Fprintln(output, "Could not save", err)
+			return
+		}
+		session.slots[args[0]] = snapshot
+		fmt.Fprintln(output, "Saved to slot", args[0])
+	})
+	vm.AddCommand("load", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		if len(args) != 1 {
+			fmt.Fprintln(output, "Usage: load <slot>")
+			return
+		}
+		snapshot, ok := session.slots[args[0]]
+		if !ok {
+			fmt.Fprintf(output, "There is no slot %v\n", args[0])
+			return
+		}
+		if err := vm.Restore(snapshot); err != nil {
+			fmt.Fprintln(output, "Could not load", err)
+			return
+		}
+		fmt.Fprintln(output, "Loaded slot", args[0])
+	})
+	vm.AddCommand("slots", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		if len(session.slots) == 0 {
+			fmt.Fprintln(output, "Nothing saved yet")
+			return
+		}
+		fmt.Fprintln(output, strings.Join(session.slotNames(), "\n"))
+	})
+	vm.AddCommand("sessions", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		for _, info := range server.Sessions() {
+			fmt.Fprintln(output, info)
+		}
+	})
+}
+
+func (session *Session) slotNames() []string {
+	names := make([]string, 0, len(session.slots))
+	for name := range session.slots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
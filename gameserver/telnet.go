@@ -0,0 +1,117 @@
+package gameserver
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"time"
+)
+
+// Telnet bytes the reader has to recognize to drop option negotiation.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWill = 251
+	telnetDont = 254
+	telnetIAC  = 255
+)
+
+// Where telnetReader is in a telnet command.
+type telnetState int
+
+const (
+	telnetData telnetState = iota
+	// After IAC.
+	telnetCommand
+	// After IAC and WILL, WONT, DO or DONT, which an option follows.
+	telnetOption
+	// Between IAC SB and IAC SE.
+	telnetSub
+	// After an IAC in a subnegotiation.
+	telnetSubIAC
+)
+
+// telnetReader reads what the player types from conn without the carriage returns and the telnet commands telnet
+// clients send, so the game gets plain lines. Before waiting for the player it sends the output printed so far, and
+// with an idle timeout it gives up waiting with a timeout error.
+type telnetReader struct {
+	conn    net.Conn
+	output  *bufio.Writer
+	idle    time.Duration
+	session *Session
+	state   telnetState
+}
+
+func (reader *telnetReader) Read(buffer []byte) (int, error) {
+	if err := reader.output.Flush(); err != nil {
+		return 0, err
+	}
+	for {
+		if reader.idle != 0 {
+			reader.conn.SetReadDeadline(time.Now().Add(reader.idle))
+		}
+		read, err := reader.conn.Read(buffer)
+		if read = reader.filter(buffer[:read]); read > 0 {
+			reader.session.lastInput.Store(time.Now().UnixNano())
+			return read, err
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Removes carriage returns, NULs and telnet commands from data in place, and returns how many bytes are left.
+func (reader *telnetReader) filter(data []byte) int {
+	kept := 0
+	for _, char := range data {
+		switch reader.state {
+		case telnetData:
+			switch char {
+			case telnetIAC:
+				reader.state = telnetCommand
+			case '\r', 0:
+			default:
+				data[kept] = char
+				kept++
+			}
+		case telnetCommand:
+			switch {
+			case char == telnetIAC:
+				// An escaped 255, which is no character the game knows.
+				reader.state = telnetData
+			case char == telnetSB:
+				reader.state = telnetSub
+			case char >= telnetWill && char <= telnetDont:
+				reader.state = telnetOption
+			default:
+				reader.state = telnetData
+			}
+		case telnetOption:
+			reader.state = telnetData
+		case telnetSub:
+			if char == telnetIAC {
+				reader.state = telnetSubIAC
+			}
+		case telnetSubIAC:
+			if char == telnetSE {
+				reader.state = telnetData
+			} else {
+				reader.state = telnetSub
+			}
+		}
+	}
+	return kept
+}
+
+// telnetWriter ends the lines the game prints with a carriage return and a line feed, as telnet expects.
+type telnetWriter struct {
+	conn net.Conn
+}
+
+func (writer *telnetWriter) Write(data []byte) (int, error) {
+	if _, err := writer.conn.Write(bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
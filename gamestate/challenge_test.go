@@ -0,0 +1,53 @@
+package gamestate_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gamestate.Install(vm, gamestate.Challenge)
+
+	entries, err := transcript.Parse(strings.NewReader("take tablet\ndoorway\nnorth\ninspect\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := strings.Builder{}
+	if err := transcript.NewPlayer(vm, entries, &output).Play(vm); err != nil {
+		t.Fatal(err)
+	}
+
+	state := gamestate.New(&vm.Memory, gamestate.Challenge)
+	if room := state.CurrentRoom(); room.Name != "Dark cave" || len(room.Exits) != 2 || room.Exits[0].Name != "north" {
+		t.Errorf("expected the second dark cave, got %+v", room)
+	}
+	if inventory := state.Inventory(); len(inventory) != 1 || inventory[0].Name != "tablet" {
+		t.Errorf("expected to carry the tablet, got %+v", inventory)
+	}
+	if lantern, ok := state.Item("empty lantern"); !ok || state.Where(lantern.Location) != "Moss cavern" {
+		t.Errorf("expected the empty lantern in the moss cavern, got %+v", lantern)
+	}
+	if len(state.Rooms()) < 20 {
+		t.Errorf("expected the rooms up to the ruins, got %v", len(state.Rooms()))
+	}
+
+	// The inspect command prints the same state while the game waits for input.
+	if !strings.Contains(output.String(), "Room 2332: Dark cave\n") || !strings.Contains(output.String(), "Inventory:\n  tablet\n") {
+		t.Errorf("the inspect command did not describe the state:\n%v", output.String())
+	}
+}
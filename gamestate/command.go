@@ -0,0 +1,18 @@
+package gamestate
+
+import (
+	"fmt"
+	"io"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Install adds the inspect command to vm, which describes the state of the game as Write does, reading it from where
+// descriptor says the game keeps it.
+func Install(vm *VirtualMachine.VirtualMachine, descriptor Descriptor) {
+	vm.AddCommand("inspect", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		if err := New(&vm.Memory, descriptor).Write(output); err != nil {
+			fmt.Fprintln(output, "Could not inspect the game state", err)
+		}
+	})
+}
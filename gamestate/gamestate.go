@@ -0,0 +1,280 @@
+// Package gamestate reads the state of the game straight out of Memory, where a descriptor says the game keeps it,
+// instead of from what the game prints.
+//
+// Rooms are records of at least four words: the name, the description, the list of exit names and the list of rooms
+// the exits lead to. Items are records of four words: the name, the description, the location and the function called
+// when the item is used. Names and descriptions point at strings that start with their length, lists at arrays that
+// do. The strings are only readable once the game has finished its self-test, which decrypts them.
+//
+// A descriptor file has one setting per line. Blank lines and lines starting with # are skipped:
+//
+//	room <address>          word that holds the address of the room the player is in
+//	items <address> <count> first of count item records
+//	inventory <location>    location of the items the player carries
+//	nowhere <location>      location of the items that are gone from the game
+package gamestate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Descriptor struct {
+	Room      uint16
+	Items     uint16
+	ItemCount uint16
+	Inventory uint16
+	Nowhere   uint16
+}
+
+// Where challenge.bin keeps its state, found by watching which words change as the player moves and picks up items.
+var Challenge = Descriptor{Room: 2732, Items: 2668, ItemCount: 16, Inventory: 0, Nowhere: 32767}
+
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("line %v: %v", err.Line, err.Message)
+}
+
+// LoadDescriptor parses the descriptor file at filePath.
+func LoadDescriptor(filePath string) (Descriptor, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer file.Close()
+
+	return ParseDescriptor(file)
+}
+
+// ParseDescriptor reads a descriptor in the format of a descriptor file. Settings that are left out keep the value
+// they have in Challenge.
+func ParseDescriptor(reader io.Reader) (Descriptor, error) {
+	descriptor := Challenge
+	settings := map[string][]*uint16{
+		"room":      {&descriptor.Room},
+		"items":     {&descriptor.Items, &descriptor.ItemCount},
+		"inventory": {&descriptor.Inventory},
+		"nowhere":   {&descriptor.Nowhere},
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		values, ok := settings[fields[0]]
+		if !ok {
+			return Descriptor{}, &SyntaxError{Line: line, Message: fmt.Sprintf("unknown setting %q", fields[0])}
+		}
+		if len(fields)-1 != len(values) {
+			return Descriptor{}, &SyntaxError{Line: line, Message: fmt.Sprintf("%v takes %v values", fields[0], len(values))}
+		}
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 16)
+			if err != nil || value > 32767 {
+				return Descriptor{}, &SyntaxError{Line: line, Message: fmt.Sprintf("%q is not an address", field)}
+			}
+			*values[i] = uint16(value)
+		}
+	}
+	return descriptor, scanner.Err()
+}
+
+type Exit struct {
+	Name string
+	// Address of the room the exit leads to.
+	To uint16
+}
+
+type Room struct {
+	Address     uint16
+	Name        string
+	Description string
+	Exits       []Exit
+}
+
+type Item struct {
+	Address     uint16
+	Name        string
+	Description string
+	// Address of the room the item is in, or the Inventory or Nowhere location of the descriptor.
+	Location uint16
+}
+
+// Memory is what State reads the game from, like the Memory of a VirtualMachine.
+type Memory interface {
+	Get(address uint16) uint16
+}
+
+// Array is a copy of the whole of Memory, like the one VirtualMachine.DumpMemory returns.
+type Array [32768]uint16
+
+func (array *Array) Get(address uint16) uint16 {
+	return array[address]
+}
+
+// State reads the game state out of memory, which it keeps pointing at so it is always up to date.
+type State struct {
+	memory     Memory
+	descriptor Descriptor
+}
+
+func New(memory Memory, descriptor Descriptor) *State {
+	return &State{memory: memory, descriptor: descriptor}
+}
+
+// CurrentRoom returns the room the player is in.
+func (state *State) CurrentRoom() Room {
+	return state.Room(state.word(state.descriptor.Room))
+}
+
+// Room reads the room record at address.
+func (state *State) Room(address uint16) Room {
+	room := Room{
+		Address:     address,
+		Name:        state.text(state.word(address)),
+		Description: state.text(state.word(address + 1)),
+	}
+
+	names, destinations := state.list(state.word(address+2)), state.list(state.word(address+3))
+	for i, name := range names {
+		exit := Exit{Name: state.text(name)}
+		if i < len(destinations) {
+			exit.To = destinations[i]
+		}
+		room.Exits = append(room.Exits, exit)
+	}
+	return room
+}
+
+// Rooms returns every room that can be reached from the one the player is in by following exits, starting with that
+// room.
+func (state *State) Rooms() []Room {
+	start := state.CurrentRoom()
+	rooms := []Room{start}
+	seen := map[uint16]bool{start.Address: true}
+	for i := 0; i < len(rooms); i++ {
+		for _, exit := range rooms[i].Exits {
+			if !seen[exit.To] {
+				seen[exit.To] = true
+				rooms = append(rooms, state.Room(exit.To))
+			}
+		}
+	}
+	return rooms
+}
+
+// Items returns every item in the item table, wherever it is.
+func (state *State) Items() []Item {
+	items := make([]Item, 0, state.descriptor.ItemCount)
+	for i := uint16(0); i < state.descriptor.ItemCount; i++ {
+		address := state.descriptor.Items + 4*i
+		items = append(items, Item{
+			Address:     address,
+			Name:        state.text(state.word(address)),
+			Description: state.text(state.word(address + 1)),
+			Location:    state.word(address + 2),
+		})
+	}
+	return items
+}
+
+// Inventory returns the items the player carries.
+func (state *State) Inventory() []Item {
+	return state.ItemsAt(state.descriptor.Inventory)
+}
+
+// ItemsAt returns the items at location, a room address or the Inventory or Nowhere location.
+func (state *State) ItemsAt(location uint16) []Item {
+	var items []Item
+	for _, item := range state.Items() {
+		if item.Location == location {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Item returns the item called name, if the item table has one.
+func (state *State) Item(name string) (Item, bool) {
+	for _, item := range state.Items() {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// Where returns the name of location: a room name, "inventory" or "nowhere".
+func (state *State) Where(location uint16) string {
+	switch location {
+	case state.descriptor.Inventory:
+		return "inventory"
+	case state.descriptor.Nowhere:
+		return "nowhere"
+	}
+	return state.Room(location).Name
+}
+
+// Write describes the room the player is in, the inventory and where every other item is.
+func (state *State) Write(writer io.Writer) error {
+	room := state.CurrentRoom()
+	text := strings.Builder{}
+	fmt.Fprintf(&text, "Room %v: %v\n", room.Address, room.Name)
+	for _, exit := range room.Exits {
+		fmt.Fprintf(&text, "  %v -> %v (%v)\n", exit.Name, state.Room(exit.To).Name, exit.To)
+	}
+
+	text.WriteString("Inventory:\n")
+	for _, item := range state.Inventory() {
+		fmt.Fprintf(&text, "  %v\n", item.Name)
+	}
+
+	text.WriteString("Items:\n")
+	for _, item := range state.Items() {
+		if item.Location != state.descriptor.Inventory {
+			fmt.Fprintf(&text, "  %v: %v (%v)\n", item.Name, state.Where(item.Location), item.Location)
+		}
+	}
+
+	_, err := io.WriteString(writer, text.String())
+	return err
+}
+
+// Reads the word at address, or 0 outside of Memory.
+func (state *State) word(address uint16) uint16 {
+	if address >= 32768 {
+		return 0
+	}
+	return state.memory.Get(address)
+}
+
+// Reads the array at address, which starts with its length.
+func (state *State) list(address uint16) []uint16 {
+	length := state.word(address)
+	values := make([]uint16, 0, length)
+	for i := uint16(1); i <= length && int(address)+int(i) < 32768; i++ {
+		values = append(values, state.memory.Get(address+i))
+	}
+	return values
+}
+
+// Reads the string at address, which starts with its length.
+func (state *State) text(address uint16) string {
+	text := strings.Builder{}
+	for _, char := range state.list(address) {
+		text.WriteRune(rune(char))
+	}
+	return text.String()
+}
@@ -0,0 +1,111 @@
+package gamestate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChallengeDescriptor(t *testing.T) {
+	descriptor, err := LoadDescriptor("challenge.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descriptor != Challenge {
+		t.Errorf("challenge.txt describes %+v, expected %+v", descriptor, Challenge)
+	}
+}
+
+func TestParseDescriptor(t *testing.T) {
+	descriptor, err := ParseDescriptor(strings.NewReader("# moved\nroom 100\n\nitems 200 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Descriptor{Room: 100, Items: 200, ItemCount: 3, Inventory: 0, Nowhere: 32767}); descriptor != expected {
+		t.Errorf("expected %+v, got %+v", expected, descriptor)
+	}
+
+	for _, text := range []string{"rooms 100", "room", "items 200", "room 32768", "room x"} {
+		var syntaxError *SyntaxError
+		if _, err := ParseDescriptor(strings.NewReader(text)); !errors.As(err, &syntaxError) {
+			t.Errorf("%q: expected a syntax error, got %v", text, err)
+		}
+	}
+}
+
+// Lays out memory the way challenge.bin does, with a word for the current room, two rooms that lead to each other
+// and an item table.
+type layout struct {
+	memory [32768]uint16
+	free   uint16
+}
+
+func (layout *layout) list(values ...uint16) uint16 {
+	address := layout.free
+	layout.memory[address] = uint16(len(values))
+	copy(layout.memory[address+1:], values)
+	layout.free += uint16(len(values)) + 1
+	return address
+}
+
+func (layout *layout) text(text string) uint16 {
+	var values []uint16
+	for _, char := range text {
+		values = append(values, uint16(char))
+	}
+	return layout.list(values...)
+}
+
+func testState() *State {
+	layout := &layout{free: 1000}
+	descriptor := Descriptor{Room: 10, Items: 30, ItemCount: 3, Inventory: 0, Nowhere: 32767}
+
+	copy(layout.memory[100:], []uint16{layout.text("Hall"), layout.text("A long hall."), layout.list(layout.text("north")), layout.list(105)})
+	copy(layout.memory[105:], []uint16{layout.text("Cellar"), layout.text("It is dark."), layout.list(layout.text("up")), layout.list(100)})
+	copy(layout.memory[30:], []uint16{layout.text("lamp"), layout.text("A lamp."), 0, 0})
+	copy(layout.memory[34:], []uint16{layout.text("key"), layout.text("A key."), 105, 0})
+	copy(layout.memory[38:], []uint16{layout.text("note"), layout.text("A note."), 32767, 0})
+	layout.memory[10] = 100
+
+	return New((*Array)(&layout.memory), descriptor)
+}
+
+func TestRooms(t *testing.T) {
+	state := testState()
+
+	expected := []Room{
+		{Address: 100, Name: "Hall", Description: "A long hall.", Exits: []Exit{{Name: "north", To: 105}}},
+		{Address: 105, Name: "Cellar", Description: "It is dark.", Exits: []Exit{{Name: "up", To: 100}}},
+	}
+	if room := state.CurrentRoom(); !reflect.DeepEqual(room, expected[0]) {
+		t.Errorf("expected %+v, got %+v", expected[0], room)
+	}
+	if rooms := state.Rooms(); !reflect.DeepEqual(rooms, expected) {
+		t.Errorf("expected %+v, got %+v", expected, rooms)
+	}
+}
+
+func TestItems(t *testing.T) {
+	state := testState()
+
+	if inventory := state.Inventory(); len(inventory) != 1 || inventory[0].Name != "lamp" {
+		t.Errorf("expected to carry the lamp, got %+v", inventory)
+	}
+	key, ok := state.Item("key")
+	if expected := (Item{Address: 34, Name: "key", Description: "A key.", Location: 105}); !ok || key != expected {
+		t.Errorf("expected %+v, got %+v", expected, key)
+	}
+	if _, ok := state.Item("sword"); ok {
+		t.Error("found an item that is not in the table")
+	}
+
+	written := strings.Builder{}
+	if err := state.Write(&written); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Room 100: Hall\n  north -> Cellar (105)\nInventory:\n  lamp\nItems:\n  key: Cellar (105)\n  note: nowhere (32767)\n"
+	if written.String() != expected {
+		t.Errorf("expected %q, got %q", expected, written.String())
+	}
+}
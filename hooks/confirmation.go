@@ -0,0 +1,73 @@
+// Package hooks holds native replacements for known functions in challenge.bin.
+package hooks
+
+import (
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// ConfirmationAddress is where challenge.bin keeps the teleporter confirmation function, see notes/teleporter.txt.
+const ConfirmationAddress = 6027
+
+// Install registers every known hook on vm.
+func Install(vm *VirtualMachine.VirtualMachine) {
+	vm.SetHook(ConfirmationAddress, ConfirmationHook)
+}
+
+// ConfirmationHook computes the confirmation function for r0 and r1 with r7 as the constant. Like the guest code, it
+// leaves the result in r0 and one less than the result in r1, which is what the innermost f(0, b) call leaves behind.
+func ConfirmationHook(vm *VirtualMachine.VirtualMachine) error {
+	result := Confirmation(vm.Register[0], vm.Register[1], vm.Register[7])
+	vm.Register[0] = result
+	vm.Register[1] = (result + 32767) % 32768
+	return nil
+}
+
+// Confirmation evaluates the recursive function at 6027, modulo 32768:
+//
+//	f(0, b) = b + 1
+//	f(a, 0) = f(a - 1, c)
+//	f(a, b) = f(a - 1, f(a, b - 1))
+func Confirmation(a uint16, b uint16, c uint16) uint16 {
+	return NewConfirmationTable(32768).Evaluate(a, b, c)
+}
+
+// ConfirmationTable evaluates the confirmation function with its arithmetic done modulo a number other than 32768, and
+// keeps its rows between evaluations so evaluating it for many values of c does not allocate.
+type ConfirmationTable struct {
+	modulus   int
+	row, next []uint16
+}
+
+// NewConfirmationTable creates a table for a modulus from 1 to 32768.
+func NewConfirmationTable(modulus int) *ConfirmationTable {
+	return &ConfirmationTable{modulus: modulus, row: make([]uint16, modulus), next: make([]uint16, modulus)}
+}
+
+// Evaluate returns f(a, b) for c, with b and c taken modulo the modulus of the table.
+//
+// Every row f(a, *) only depends on the row before it, so it is filled in one row at a time instead of recursing. Of
+// the last row only the values up to b are needed.
+func (table *ConfirmationTable) Evaluate(a uint16, b uint16, c uint16) uint16 {
+	modulus := table.modulus
+	b, c = uint16(int(b)%modulus), uint16(int(c)%modulus)
+
+	row, next := table.row, table.next
+	for i := range row {
+		row[i] = uint16((i + 1) % modulus)
+	}
+
+	for level := uint16(1); level <= a; level++ {
+		length := len(next)
+		if level == a {
+			length = int(b) + 1
+		}
+
+		next[0] = row[c]
+		for i := 1; i < length; i++ {
+			next[i] = row[next[i-1]]
+		}
+		row, next = next, row
+	}
+
+	return row[b]
+}
@@ -0,0 +1,91 @@
+package hooks
+
+import (
+	"testing"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// The guest code of the confirmation function from notes/teleporter.txt, moved to address 0.
+var confirmation = []uint16{
+	// 0: jt r0 8
+	7, 32768, 8,
+	// 3: add r0 r1 1
+	9, 32768, 32769, 1,
+	// 7: ret
+	18,
+	// 8: jt r1 21
+	7, 32769, 21,
+	// 11: add r0 r0 32767
+	9, 32768, 32768, 32767,
+	// 15: set r1 r7
+	1, 32769, 32775,
+	// 18: call 0
+	17, 0,
+	// 20: ret
+	18,
+	// 21: push r0
+	2, 32768,
+	// 23: add r1 r1 32767
+	9, 32769, 32769, 32767,
+	// 27: call 0
+	17, 0,
+	// 29: set r1 r0
+	1, 32769, 32768,
+	// 32: pop r0
+	3, 32768,
+	// 34: add r0 r0 32767
+	9, 32768, 32768, 32767,
+	// 38: call 0
+	17, 0,
+	// 40: ret
+	18,
+}
+
+func TestConfirmationHookMatchesGuestCode(t *testing.T) {
+	for a := uint16(0); a <= 3; a++ {
+		for b := uint16(0); b <= 3; b++ {
+			for _, c := range []uint16{0, 1, 2, 5} {
+				registers := [8]uint16{a, b, 0, 0, 0, 0, 0, c}
+				if err := VirtualMachine.VerifyHook(confirmation, 0, registers, ConfirmationHook); err != nil {
+					t.Errorf("f(%v, %v) with c = %v: %v", a, b, c, err)
+				}
+			}
+		}
+	}
+}
+
+func TestConfirmationTableModulus(t *testing.T) {
+	for _, modulus := range []int{1, 7, 100} {
+		// The recursion as written, with a cache, which is still fast enough for a small modulus.
+		for c := 0; c < modulus; c++ {
+			cache := map[[2]int]int{}
+			var f func(a int, b int) int
+			f = func(a int, b int) int {
+				if result, ok := cache[[2]int{a, b}]; ok {
+					return result
+				}
+				result := 0
+				switch {
+				case a == 0:
+					result = (b + 1) % modulus
+				case b == 0:
+					result = f(a-1, c)
+				default:
+					result = f(a-1, f(a, b-1))
+				}
+				cache[[2]int{a, b}] = result
+				return result
+			}
+
+			table := NewConfirmationTable(modulus)
+			for a := 0; a <= 3; a++ {
+				for b := 0; b < modulus; b += 1 + modulus/10 {
+					if expected, got := f(a, b), table.Evaluate(uint16(a), uint16(b), uint16(c)); int(got) != expected {
+						t.Errorf("f(%v, %v) with c = %v modulo %v: expected %v, got %v", a, b, c, modulus, expected, got)
+					}
+				}
+			}
+		}
+	}
+}
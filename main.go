@@ -1,13 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"github.com/ckyong/synacor/gamestate"
 	"github.com/ckyong/synacor/vm"
+	"github.com/ckyong/synacor/web"
+	"net/http"
 	"os"
 	"path/filepath"
 )
 
 func main() {
+	record := flag.String("record", "", "record everything read from the input into this session file")
+	descriptor := flag.String("descriptor", "", "descriptor file of where the inspect command finds the game state")
+	serve := flag.String("serve", "", "instead of playing here, serve sessions of the game to browsers on this address, such as 127.0.0.1:8080")
+	flag.Parse()
+
 	filePath := filepath.Join("./resources/challenge.bin")
 
 	file, err := os.Open(filePath)
@@ -27,8 +36,43 @@ func main() {
 		panic(err)
 	}
 
+	addresses := gamestate.Challenge
+	if *descriptor != "" {
+		addresses, err = gamestate.LoadDescriptor(*descriptor)
+		if err != nil {
+			panic(err)
+		}
+	}
+	gamestate.Install(vm, addresses)
+
+	if *serve != "" {
+		// Whoever reaches the server can play with the VM, so it is only offered on this machine.
+		if !web.Loopback(*serve) {
+			panic(fmt.Sprintf("-serve takes a loopback address such as 127.0.0.1:8080, not %v", *serve))
+		}
+		server := web.NewServer(vm)
+		server.Setup = func(vm *VirtualMachine.VirtualMachine) {
+			gamestate.Install(vm, addresses)
+		}
+		server.NewSession()
+		fmt.Printf("Serving on http://%v\n", *serve)
+		panic(http.ListenAndServe(*serve, server))
+	}
+
+	if *record != "" {
+		if err := vm.StartRecording(); err != nil {
+			panic(err)
+		}
+	}
+
 	err = vm.Run()
 
+	if *record != "" {
+		if err := vm.StopRecording().Save(*record); err != nil {
+			fmt.Printf("Could not save session: %v\n", err)
+		}
+	}
+
 	if err != nil {
 		panic("Error occurred during execution" + err.Error())
 	}
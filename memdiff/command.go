@@ -0,0 +1,85 @@
+package memdiff
+
+import (
+	"fmt"
+	"io"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Candidates listed after a search step, the rest are only counted.
+const shownCandidates = 50
+
+// WriteChanges lists changes one per line, with context if it is not nil.
+func WriteChanges(output io.Writer, changes []Change, context *Context) {
+	for _, change := range changes {
+		fmt.Fprintf(output, "%v: %v -> %v", change.Address, change.Before, change.After)
+		writeContext(output, change.Address, context)
+	}
+	fmt.Fprintf(output, "%v words changed\n", len(changes))
+}
+
+// WriteCandidates lists up to limit candidates of search with the value they hold, with context if it is not nil.
+func WriteCandidates(output io.Writer, search *Search, context *Context, limit int) {
+	candidates := search.Candidates()
+	for i, address := range candidates {
+		if i == limit {
+			fmt.Fprintf(output, "and %v more\n", len(candidates)-limit)
+			break
+		}
+		fmt.Fprintf(output, "%v: %v", address, search.Value(address))
+		writeContext(output, address, context)
+	}
+}
+
+func writeContext(output io.Writer, address uint16, context *Context) {
+	if context != nil {
+		if description := context.Describe(address); description != "" {
+			fmt.Fprintf(output, "  ; %v", description)
+		}
+	}
+	fmt.Fprintln(output)
+}
+
+// Install adds commands to compare the live memory of vm with snapshots and search it, to type at the game prompt:
+//
+//	memdiff synacor_1          lists the words that changed since the state saved as synacor_1
+//	memsearch start            makes every address a candidate
+//	memsearch changed          keeps the candidates that changed since the last step, or with unchanged, increased,
+//	                           decreased or =value the ones that did not change, went up, went down or hold value
+func Install(vm *VirtualMachine.VirtualMachine) {
+	vm.AddCommand("memdiff", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		if len(args) != 1 {
+			fmt.Fprintln(output, "Usage: memdiff <saved state>")
+			return
+		}
+		before, err := Load(args[0])
+		if err != nil {
+			fmt.Fprintln(output, "Could not load state", err)
+			return
+		}
+		after := vm.DumpMemory()
+		WriteChanges(output, Diff(&before, &after), NewContext(&after))
+	})
+
+	var search *Search
+	vm.AddCommand("memsearch", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		memory := vm.DumpMemory()
+		if len(args) == 1 && args[0] == "start" {
+			search = NewSearch(&memory)
+			fmt.Fprintf(output, "%v candidates\n", len(search.Candidates()))
+			return
+		}
+		if search == nil || len(args) != 1 {
+			fmt.Fprintln(output, "Usage: memsearch start, then memsearch unchanged, changed, increased, decreased or =value")
+			return
+		}
+		filter, err := ParseFilter(args[0])
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return
+		}
+		fmt.Fprintf(output, "%v candidates left\n", search.Filter(&memory, filter))
+		WriteCandidates(output, search, NewContext(&memory), shownCandidates)
+	})
+}
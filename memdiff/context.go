@@ -0,0 +1,103 @@
+package memdiff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ckyong/synacor/analysis"
+	"github.com/ckyong/synacor/decompiler"
+)
+
+const (
+	opRmem = 15
+	opWmem = 16
+)
+
+// Context describes where words of memory sit among the code: the instruction a linear disassembly puts them in, and
+// the instructions that read or write them, either with the address as an operand or through a register the data-flow
+// analysis knows the address of.
+type Context struct {
+	covering map[uint16]decompiler.Instruction
+	readers  map[uint16][]uint16
+	writers  map[uint16][]uint16
+}
+
+// NewContext disassembles and analyses memory.
+func NewContext(memory *Image) *Context {
+	context := &Context{
+		covering: map[uint16]decompiler.Instruction{},
+		readers:  map[uint16][]uint16{},
+		writers:  map[uint16][]uint16{},
+	}
+	access := func(op uint16, address uint16, by uint16) {
+		switch op {
+		case opRmem:
+			context.readers[address] = append(context.readers[address], by)
+		case opWmem:
+			context.writers[address] = append(context.writers[address], by)
+		}
+	}
+
+	for address := 0; address < len(memory); {
+		ins, err := decompiler.Decode(memory[:], uint16(address))
+		if err != nil {
+			address++
+			continue
+		}
+		for i := 0; i <= len(ins.Operands); i++ {
+			context.covering[ins.Address+uint16(i)] = ins
+		}
+		switch {
+		case ins.Op == opRmem && !decompiler.IsRegister(ins.Operands[1]):
+			access(ins.Op, ins.Operands[1], ins.Address)
+		case ins.Op == opWmem && !decompiler.IsRegister(ins.Operands[0]):
+			access(ins.Op, ins.Operands[0], ins.Address)
+		}
+		address += 1 + len(ins.Operands)
+	}
+
+	program := analysis.Analyze(memory[:], analysis.Entries(memory[:])...)
+	for _, function := range program.Functions {
+		for _, ins := range function.Instructions {
+			if ins.Memory != nil {
+				access(memory[ins.Address], *ins.Memory, ins.Address)
+			}
+		}
+	}
+	for _, accesses := range []map[uint16][]uint16{context.readers, context.writers} {
+		for address, by := range accesses {
+			sort.Slice(by, func(i, j int) bool { return by[i] < by[j] })
+			accesses[address] = by
+		}
+	}
+	return context
+}
+
+// Describe returns the instruction address is part of and the ones that read or write it, or an empty string if there
+// are none.
+func (context *Context) Describe(address uint16) string {
+	var parts []string
+	if ins, ok := context.covering[address]; ok {
+		text := ins.String()
+		for _, operand := range ins.Operands {
+			if decompiler.IsRegister(operand) {
+				text = strings.Replace(text, fmt.Sprint(operand), decompiler.RegisterName(operand), 1)
+			}
+		}
+		parts = append(parts, "in "+text)
+	}
+	for _, access := range []struct {
+		name      string
+		addresses []uint16
+	}{{"read by", context.readers[address]}, {"written by", context.writers[address]}} {
+		if len(access.addresses) > 0 {
+			addresses := make([]string, len(access.addresses))
+			for i, by := range access.addresses {
+				addresses[i] = fmt.Sprint(by)
+			}
+			parts = append(parts, access.name+" "+strings.Join(addresses, ","))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
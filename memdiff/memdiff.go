@@ -0,0 +1,117 @@
+// Package memdiff finds where a program keeps its state by comparing memory between snapshots: it lists the words
+// that changed, and narrows down candidate addresses over successive snapshots the way a cheat engine does, keeping
+// only the ones that changed, stayed the same, went up or down or hold a given value.
+package memdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Image is the whole of memory, as VirtualMachine.DumpMemory returns it.
+type Image = [VirtualMachine.MemorySize]uint16
+
+// Load returns the memory of a state written by save state.
+func Load(filePath string) (Image, error) {
+	vm := VirtualMachine.New(nil)
+	if err := vm.LoadState(filePath); err != nil {
+		return Image{}, err
+	}
+	return vm.DumpMemory(), nil
+}
+
+// Change is a word of memory that holds After now and held Before.
+type Change struct {
+	Address uint16
+	Before  uint16
+	After   uint16
+}
+
+// Diff returns the words that differ between before and after, in order of address.
+func Diff(before, after *Image) []Change {
+	var changes []Change
+	for address := range before {
+		if before[address] != after[address] {
+			changes = append(changes, Change{Address: uint16(address), Before: before[address], After: after[address]})
+		}
+	}
+	return changes
+}
+
+// Filter decides whether a candidate that held before and holds after now is kept.
+type Filter func(before, after uint16) bool
+
+var (
+	Unchanged Filter = func(before, after uint16) bool { return before == after }
+	Changed   Filter = func(before, after uint16) bool { return before != after }
+	Increased Filter = func(before, after uint16) bool { return after > before }
+	Decreased Filter = func(before, after uint16) bool { return after < before }
+)
+
+// Holds keeps the candidates that hold value now.
+func Holds(value uint16) Filter {
+	return func(_, after uint16) bool { return after == value }
+}
+
+// ParseFilter reads a filter written as unchanged, changed, increased, decreased or =value.
+func ParseFilter(text string) (Filter, error) {
+	switch text {
+	case "unchanged", "same":
+		return Unchanged, nil
+	case "changed":
+		return Changed, nil
+	case "increased":
+		return Increased, nil
+	case "decreased":
+		return Decreased, nil
+	}
+	if strings.HasPrefix(text, "=") {
+		parsed, err := strconv.ParseUint(text[1:], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in filter %q: %w", text, err)
+		}
+		return Holds(uint16(parsed)), nil
+	}
+	return nil, fmt.Errorf("unknown filter %q, expected unchanged, changed, increased, decreased or =value", text)
+}
+
+// Search narrows down the addresses that may hold a value by filtering them against successive images of memory.
+type Search struct {
+	candidates []uint16
+	last       Image
+}
+
+// NewSearch starts a search with every address of memory as a candidate.
+func NewSearch(memory *Image) *Search {
+	search := &Search{last: *memory, candidates: make([]uint16, len(memory))}
+	for address := range search.candidates {
+		search.candidates[address] = uint16(address)
+	}
+	return search
+}
+
+// Filter keeps the candidates that filter accepts between the image the search last saw and memory, which it sees from
+// now on, and returns how many are left.
+func (search *Search) Filter(memory *Image, filter Filter) int {
+	kept := search.candidates[:0]
+	for _, address := range search.candidates {
+		if filter(search.last[address], memory[address]) {
+			kept = append(kept, address)
+		}
+	}
+	search.candidates, search.last = kept, *memory
+	return len(kept)
+}
+
+// Candidates returns the addresses left, in order.
+func (search *Search) Candidates() []uint16 {
+	return append([]uint16{}, search.candidates...)
+}
+
+// Value returns what address held in the image the search last saw.
+func (search *Search) Value(address uint16) uint16 {
+	return search.last[address]
+}
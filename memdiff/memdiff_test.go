@@ -0,0 +1,112 @@
+package memdiff
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestDiff(t *testing.T) {
+	before, after := Image{}, Image{}
+	before[3], after[3] = 1, 2
+	after[100] = 7
+	expected := []Change{{Address: 3, Before: 1, After: 2}, {Address: 100, Before: 0, After: 7}}
+	if changes := Diff(&before, &after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	images := make([]Image, 4)
+	for i := range images {
+		// A counter going down at 10, one going up at 20 and a word that changes back and forth at 30.
+		images[i][10], images[i][20], images[i][30] = uint16(10-i), uint16(i), uint16(i%2)
+	}
+
+	search := NewSearch(&images[0])
+	for i, step := range []struct {
+		filter string
+		left   []uint16
+	}{
+		{"changed", []uint16{10, 20, 30}},
+		{"decreased", []uint16{10, 30}},
+		{"=7", []uint16{10}},
+	} {
+		filter, err := ParseFilter(step.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left := search.Filter(&images[i+1], filter); left != len(step.left) || !reflect.DeepEqual(search.Candidates(), step.left) {
+			t.Errorf("%v: expected %v, got %v", step.filter, step.left, search.Candidates())
+		}
+	}
+	if search.Value(10) != 7 {
+		t.Errorf("expected the value in the last image, got %v", search.Value(10))
+	}
+
+	for _, text := range []string{"bigger", "=70000", "="} {
+		if _, err := ParseFilter(text); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+// Counts the lines it reads in memory, from 1000 so that the count is not mistaken for an instruction.
+var counter = assembler.MustAssemble(`
+loop:
+	in r0
+	eq r1 r0 10
+	jf r1 loop
+	rmem r2 count
+	add r2 r2 1
+	wmem count r2
+	jmp loop
+count:
+	data 1000
+`)
+
+const count = 21
+
+func TestCommands(t *testing.T) {
+	saved := filepath.Join(t.TempDir(), "state.json")
+	input := strings.Join([]string{
+		"a",
+		"memsearch start",
+		"b",
+		"memsearch increased",
+		"save state " + saved,
+		"c",
+		"memdiff " + saved,
+	}, "\n") + "\n"
+
+	vm := VirtualMachine.New(counter)
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader(input), &output)
+	Install(vm)
+	for {
+		if _, err := vm.Step(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{
+		"32768 candidates\n",
+		"1 candidates left\n21: 1002  ; read by 9; written by 16\n",
+		"21: 1002 -> 1003  ; read by 9; written by 16\n1 words changed\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output.String())
+		}
+	}
+	if vm.Memory.Get(count) != 1003 {
+		t.Errorf("expected the commands not to reach the program, got %v lines", vm.Memory.Get(count)-1000)
+	}
+}
@@ -0,0 +1,317 @@
+package symbolic
+
+import (
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Why a path stopped.
+type End string
+
+const (
+	Reached End = "reached"
+	Halted  End = "halted"
+	TooLong End = "too long"
+	NoInput End = "out of input"
+	// The path jumps to, or reads or writes memory at, an address that depends on the symbols.
+	Jump    End = "symbolic jump"
+	Address End = "symbolic address"
+	// The next instruction has been written with a value that depends on the symbols.
+	Code  End = "symbolic code"
+	Fault End = "fault"
+)
+
+// State is where a path has got to: the registers, stack and memory written so far as expressions, and the
+// constraints the symbols have to meet to get there.
+type State struct {
+	Index       uint16
+	Register    [8]*Expr
+	Stack       []*Expr
+	Constraints []Constraint
+	// What the path printed.
+	Output []*Expr
+	Steps  int
+	// Input characters read so far.
+	Read int
+
+	memory  *[32768]uint16
+	written map[uint16]*Expr
+}
+
+// NewState starts from the registers, stack, memory and Index of vm, all of them constant.
+func NewState(vm *VirtualMachine.VirtualMachine) *State {
+	memory := vm.DumpMemory()
+	state := &State{Index: vm.Index, memory: &memory, written: map[uint16]*Expr{}}
+	for i, value := range vm.Register {
+		state.Register[i] = Const(value)
+	}
+	for _, value := range vm.Stack.Values() {
+		state.Stack = append(state.Stack, Const(value))
+	}
+	return state
+}
+
+// Word returns the word of memory at address.
+func (state *State) Word(address uint16) *Expr {
+	if value, ok := state.written[address]; ok {
+		return value
+	}
+	return Const(state.memory[address])
+}
+
+// SetWord replaces the word of memory at address, which has to be below 32768, with value.
+func (state *State) SetWord(address uint16, value *Expr) {
+	state.written[address] = value
+}
+
+// Returns the word at address if it does not depend on any symbol.
+func (state *State) concrete(address uint16) (uint16, bool) {
+	word := state.Word(address)
+	return word.Value, word.Kind == Constant
+}
+
+func (state *State) fork() *State {
+	fork := *state
+	fork.Stack = append([]*Expr{}, state.Stack...)
+	fork.Constraints = append([]Constraint{}, state.Constraints...)
+	fork.Output = append([]*Expr{}, state.Output...)
+	fork.written = make(map[uint16]*Expr, len(state.written))
+	for address, value := range state.written {
+		fork.written[address] = value
+	}
+	return &fork
+}
+
+// Writes value to the register or memory address an operand names.
+func (state *State) store(destination uint16, value *Expr) {
+	if destination >= 32768 {
+		state.Register[destination-32768] = value
+	} else {
+		state.written[destination] = value
+	}
+}
+
+// Path is a way through the code that ended, with the values of the symbols that take it once it reached the target.
+type Path struct {
+	End   End
+	State *State
+	// The error of a fault.
+	Err    error
+	Model  map[string]uint16
+	Result Result
+}
+
+// Executor explores the paths code can take from a state.
+type Executor struct {
+	Solver Solver
+	// What the in instruction reads, one character at a time. A path that reads past the end stops.
+	Input []*Expr
+	// Instructions a path may execute.
+	Budget int
+	// Paths to follow to their end before giving up on the rest, 1000 if 0.
+	MaxPaths int
+}
+
+// Explore follows every path from start, depth first with the fall through side of a branch first, until it reaches
+// target or stops, and returns the paths in the order they ended. Paths that reach target come with values of the
+// symbols that take them. Where the code branches on the symbols, the ways the solver proves impossible are dropped.
+func (executor *Executor) Explore(start *State, target uint16) []Path {
+	maxPaths := executor.MaxPaths
+	if maxPaths == 0 {
+		maxPaths = 1000
+	}
+
+	var paths []Path
+	pending := []*State{start.fork()}
+	for len(pending) > 0 && len(paths) < maxPaths {
+		state := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		path := Path{State: state}
+		for path.End == "" {
+			switch {
+			case state.Index == target:
+				path.End = Reached
+				path.Model, path.Result = executor.Solver.Solve(state.Constraints)
+			case state.Steps >= executor.Budget:
+				path.End = TooLong
+			default:
+				var fork *State
+				fork, path.End, path.Err = executor.step(state)
+				if fork != nil {
+					pending = append(pending, fork)
+				}
+			}
+		}
+		if path.End != Reached || path.Result != Unsatisfiable {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Reports whether some values of the symbols may meet every constraint.
+func (executor *Executor) feasible(constraints []Constraint) bool {
+	_, result := executor.Solver.Solve(constraints)
+	return result != Unsatisfiable
+}
+
+// Executes the instruction at Index. Returns the state of the other side of a branch both sides of which can be taken,
+// or why the path stops here.
+func (executor *Executor) step(state *State) (*State, End, error) {
+	op, ok := state.concrete(state.Index)
+	if !ok {
+		return nil, Code, nil
+	}
+	args, known := VirtualMachine.OpArgs[op]
+	if !known {
+		return nil, Fault, &VirtualMachine.UnknownOperationError{Op: op, Index: state.Index}
+	}
+	if int(state.Index)+int(args) >= 32768 {
+		return nil, Fault, &VirtualMachine.InvalidAddressError{Address: 32768, Index: state.Index}
+	}
+	operands := make([]uint16, args)
+	for i := range operands {
+		raw, ok := state.concrete(state.Index + 1 + uint16(i))
+		if !ok {
+			return nil, Code, nil
+		}
+		if raw > 32775 {
+			return nil, Fault, &VirtualMachine.InvalidNumberError{Value: raw, Index: state.Index}
+		}
+		operands[i] = raw
+	}
+	value := func(i int) *Expr {
+		if operands[i] >= 32768 {
+			return state.Register[operands[i]-32768]
+		}
+		return Const(operands[i])
+	}
+
+	var fork *State
+	next := state.Index + 1 + args
+	switch op {
+	case 0:
+		return nil, Halted, nil
+	case 1:
+		state.store(operands[0], value(1))
+	case 2:
+		state.Stack = append(state.Stack, value(0))
+	case 3:
+		if len(state.Stack) == 0 {
+			return nil, Fault, &VirtualMachine.EmptyStackError{}
+		}
+		state.store(operands[0], state.Stack[len(state.Stack)-1])
+		state.Stack = state.Stack[:len(state.Stack)-1]
+	case 4:
+		state.store(operands[0], Apply(Eq, value(1), value(2)))
+	case 5:
+		state.store(operands[0], Apply(Gt, value(1), value(2)))
+	case 6:
+		if value(0).Kind != Constant {
+			return nil, Jump, nil
+		}
+		next = value(0).Value
+	case 7, 8:
+		// jt jumps if its condition is nonzero, jf if it is zero.
+		condition, jumps := value(0), op == 7
+		if value(1).Kind != Constant {
+			return nil, Jump, nil
+		}
+		if condition.Kind == Constant {
+			if (condition.Value != 0) == jumps {
+				next = value(1).Value
+			}
+			break
+		}
+
+		jump := state.fork()
+		jump.Constraints = append(jump.Constraints, Constraint{Expr: condition, True: jumps})
+		jump.Index, jump.Steps = value(1).Value, jump.Steps+1
+		state.Constraints = append(state.Constraints, Constraint{Expr: condition, True: !jumps})
+		switch fallsThrough := executor.feasible(state.Constraints); {
+		case !executor.feasible(jump.Constraints):
+		case !fallsThrough:
+			*state = *jump
+			return nil, "", nil
+		default:
+			fork = jump
+		}
+	case 9:
+		state.store(operands[0], Apply(Add, value(1), value(2)))
+	case 10:
+		state.store(operands[0], Apply(Mult, value(1), value(2)))
+	case 11:
+		divisor := value(2)
+		if divisor.Kind == Constant && divisor.Value == 0 {
+			return nil, Fault, &VirtualMachine.DivisionByZeroError{Index: state.Index}
+		}
+		if divisor.Kind != Constant {
+			state.Constraints = append(state.Constraints, Constraint{Expr: divisor, True: true})
+		}
+		state.store(operands[0], Apply(Mod, value(1), divisor))
+	case 12:
+		state.store(operands[0], Apply(And, value(1), value(2)))
+	case 13:
+		state.store(operands[0], Apply(Or, value(1), value(2)))
+	case 14:
+		state.store(operands[0], Apply(Not, value(1)))
+	case 15:
+		address := value(1)
+		if address.Kind != Constant {
+			return nil, Address, nil
+		}
+		if address.Value >= 32768 {
+			return nil, Fault, &VirtualMachine.InvalidAddressError{Address: address.Value, Index: state.Index}
+		}
+		state.store(operands[0], state.Word(address.Value))
+	case 16:
+		address := value(0)
+		if address.Kind != Constant {
+			return nil, Address, nil
+		}
+		if address.Value >= 32768 {
+			return nil, Fault, &VirtualMachine.InvalidAddressError{Address: address.Value, Index: state.Index}
+		}
+		state.written[address.Value] = value(1)
+	case 17:
+		if value(0).Kind != Constant {
+			return nil, Jump, nil
+		}
+		state.Stack = append(state.Stack, Const(next))
+		next = value(0).Value
+	case 18:
+		if len(state.Stack) == 0 {
+			return nil, Fault, &VirtualMachine.EmptyStackError{}
+		}
+		destination := state.Stack[len(state.Stack)-1]
+		if destination.Kind != Constant {
+			return nil, Jump, nil
+		}
+		state.Stack = state.Stack[:len(state.Stack)-1]
+		next = destination.Value
+	case 19:
+		state.Output = append(state.Output, value(0))
+	case 20:
+		if state.Read >= len(executor.Input) {
+			return nil, NoInput, nil
+		}
+		state.store(operands[0], executor.Input[state.Read])
+		state.Read++
+	}
+
+	state.Index = next
+	state.Steps++
+	return fork, "", nil
+}
+
+// Text returns what the path printed, with a ? for every character that depends on the symbols.
+func (state *State) Text() string {
+	text := make([]rune, len(state.Output))
+	for i, char := range state.Output {
+		text[i] = '?'
+		if char.Kind == Constant {
+			text[i] = rune(char.Value)
+		}
+	}
+	return string(text)
+}
@@ -0,0 +1,134 @@
+package symbolic
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Accepts three characters a, b and c with a + b = 200 and a * c % 97 = 13.
+var password = assembler.MustAssemble(`
+	in r0
+	in r1
+	in r2
+	add r3 r0 r1
+	eq r4 r3 200
+	jf r4 wrong
+	mult r5 r2 r0
+	mod r5 r5 97
+	eq r4 r5 13
+	jf r4 wrong
+right:
+	halt
+wrong:
+	out 'n'
+	halt
+`)
+
+const right = 32
+
+func reached(paths []Path) []Path {
+	var reached []Path
+	for _, path := range paths {
+		if path.End == Reached {
+			reached = append(reached, path)
+		}
+	}
+	return reached
+}
+
+func TestExplorePassword(t *testing.T) {
+	start := NewState(VirtualMachine.New(password))
+	executor := Executor{Input: []*Expr{Sym("a"), Sym("b"), Sym("c")}, Budget: 100}
+	for _, name := range []string{"a", "b", "c"} {
+		// Lower case letters only.
+		start.Constraints = append(start.Constraints, Constraint{Expr: Apply(Gt, Sym(name), Const('a'-1)), True: true})
+		start.Constraints = append(start.Constraints, Constraint{Expr: Apply(Gt, Sym(name), Const('z')), True: false})
+	}
+
+	paths := executor.Explore(start, right)
+	if len(paths) != 3 {
+		t.Errorf("expected the right path and two wrong ones, got %v", paths)
+	}
+	found := reached(paths)
+	if len(found) != 1 || found[0].Result != Satisfiable {
+		t.Fatalf("expected one way to the right address, got %v", found)
+	}
+	if constraints := found[0].State.Constraints; constraints[len(constraints)-2].String() != "(a + b) == 200" {
+		t.Errorf("unexpected constraints %v", constraints)
+	}
+
+	// The password the solver found works on the VM.
+	model := found[0].Model
+	input := string([]byte{byte(model["a"]), byte(model["b"]), byte(model["c"])})
+	vm := VirtualMachine.New(password)
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader(input+"\n"), &output)
+	if err := vm.Run(); err != nil || vm.Index != right {
+		t.Errorf("%q: expected to halt at %v, got %v with %q: %v", input, right, vm.Index, output.String(), err)
+	}
+
+	for _, path := range paths {
+		if path.End == Halted && path.State.Text() != "n" {
+			t.Errorf("expected the wrong paths to print n, got %q", path.State.Text())
+		}
+	}
+}
+
+func TestExploreEnds(t *testing.T) {
+	program := assembler.MustAssemble(`
+	jt r0 symbolic
+	in r1
+loop:
+	jmp loop
+symbolic:
+	jmp r1
+`)
+	start := NewState(VirtualMachine.New(program))
+	start.Register[0], start.Register[1] = Sym("x"), Sym("y")
+	paths := (&Executor{Budget: 20}).Explore(start, 1000)
+	if len(paths) != 2 || paths[0].End != NoInput || paths[1].End != Jump {
+		t.Errorf("expected to run out of input and to jump to a symbol, got %v", paths)
+	}
+
+	paths = (&Executor{Budget: 20, Input: []*Expr{Const('a')}}).Explore(start, 1000)
+	if len(paths) != 2 || paths[0].End != TooLong || paths[0].State.Steps != 20 || paths[0].State.Register[1].Value != 'a' {
+		t.Errorf("expected the loop to run out of budget, got %v", paths)
+	}
+
+	start.SetWord(0, Sym("z"))
+	if paths := (&Executor{Budget: 20}).Explore(start, 1000); len(paths) != 1 || paths[0].End != Code {
+		t.Errorf("expected code that depends on a symbol to stop the path, got %v", paths)
+	}
+
+	start = NewState(VirtualMachine.New([]uint16{3, 32768}))
+	var empty *VirtualMachine.EmptyStackError
+	if paths := (&Executor{Budget: 20}).Explore(start, 1000); len(paths) != 1 || paths[0].End != Fault || !errors.As(paths[0].Err, &empty) {
+		t.Errorf("expected popping an empty stack to fault, got %v", paths)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Right after the confirmation function returns to the teleporter, see teleporter.CallSite.
+	vm.Index = 5491
+	start := NewState(vm)
+	start.Register[0] = Sym("r0")
+	found := reached((&Executor{Budget: 10}).Explore(start, 5498))
+	if len(found) != 1 || found[0].Model["r0"] != 6 || found[0].State.Constraints[0].String() != "r0 == 6" {
+		t.Errorf("expected the teleporter to need r0 == 6, got %v", found)
+	}
+}
@@ -0,0 +1,208 @@
+// Package symbolic runs Synacor code with some registers, words of memory or input characters left as symbols, and
+// works out what they have to be for the code to reach an address.
+//
+// Values are expressions over the arithmetic of the VM. Where the code branches on an expression, both ways are
+// explored, each with a constraint on the expression, and the built-in solver drops the ways no values of the symbols
+// can take. The solver turns expressions into a boolean circuit over their bits and looks for an assignment with a
+// small SAT solver, so it needs no external dependency but is only meant for bounded problems.
+package symbolic
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Kind int
+
+const (
+	Constant Kind = iota
+	Symbol
+	Add
+	Mult
+	Mod
+	And
+	Or
+	Not
+	Eq
+	Gt
+)
+
+var operators = map[Kind]string{Add: "+", Mult: "*", Mod: "%", And: "&", Or: "|", Eq: "==", Gt: ">"}
+
+// Expr is a value computed the way the VM computes it: add and mult modulo 32768, not within 15 bits, and eq and gt
+// as 1 or 0. Constants may use all 16 bits, like raw words of memory.
+type Expr struct {
+	Kind  Kind
+	Value uint16
+	Name  string
+	Args  []*Expr
+}
+
+func Const(value uint16) *Expr {
+	return &Expr{Kind: Constant, Value: value}
+}
+
+func Sym(name string) *Expr {
+	return &Expr{Kind: Symbol, Name: name}
+}
+
+// Apply returns the expression for an operation, folding it into a constant when every argument is one and dropping
+// operations that leave a value as it is.
+func Apply(kind Kind, args ...*Expr) *Expr {
+	constant := true
+	values := make([]uint16, len(args))
+	for i, arg := range args {
+		values[i], constant = arg.Value, constant && arg.Kind == Constant
+	}
+	if constant {
+		if value, ok := evaluate(kind, values); ok {
+			return Const(value)
+		}
+	}
+
+	isConstant := func(arg *Expr, value uint16) bool {
+		return arg.Kind == Constant && arg.Value == value
+	}
+	switch {
+	case kind == Add && isConstant(args[1], 0) && args[0].fits():
+		return args[0]
+	case kind == Add && isConstant(args[0], 0) && args[1].fits():
+		return args[1]
+	case kind == Mult && (isConstant(args[0], 0) || isConstant(args[1], 0)):
+		return Const(0)
+	case (kind == And || kind == Or) && args[0] == args[1]:
+		return args[0]
+	case kind == Eq && args[0] == args[1]:
+		return Const(1)
+	}
+	return &Expr{Kind: kind, Args: args}
+}
+
+// Reports whether every value of the expression is below 32768, so that adding 0 leaves it alone.
+func (expr *Expr) fits() bool {
+	switch expr.Kind {
+	case Constant:
+		return expr.Value < 32768
+	case Symbol, Add, Mult, Not, Eq, Gt:
+		return true
+	}
+	return false
+}
+
+func evaluate(kind Kind, values []uint16) (uint16, bool) {
+	switch kind {
+	case Add:
+		return (values[0] + values[1]) % 32768, true
+	case Mult:
+		return (values[0] * values[1]) % 32768, true
+	case Mod:
+		if values[1] == 0 {
+			return 0, false
+		}
+		return values[0] % values[1], true
+	case And:
+		return values[0] & values[1], true
+	case Or:
+		return values[0] | values[1], true
+	case Not:
+		return ^values[0] & 32767, true
+	case Eq:
+		if values[0] == values[1] {
+			return 1, true
+		}
+		return 0, true
+	case Gt:
+		if values[0] > values[1] {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Eval returns the value of the expression with the given values for its symbols, which default to 0. Returns false
+// if it divides by zero.
+func (expr *Expr) Eval(values map[string]uint16) (uint16, bool) {
+	switch expr.Kind {
+	case Constant:
+		return expr.Value, true
+	case Symbol:
+		return values[expr.Name], true
+	}
+
+	args := make([]uint16, len(expr.Args))
+	for i, arg := range expr.Args {
+		value, ok := arg.Eval(values)
+		if !ok {
+			return 0, false
+		}
+		args[i] = value
+	}
+	return evaluate(expr.Kind, args)
+}
+
+// Symbols returns the names of the symbols in the expression, in order.
+func (expr *Expr) Symbols() []string {
+	names := map[string]bool{}
+	expr.symbols(names)
+	return sortedNames(names)
+}
+
+func (expr *Expr) symbols(names map[string]bool) {
+	if expr.Kind == Symbol {
+		names[expr.Name] = true
+	}
+	for _, arg := range expr.Args {
+		arg.symbols(names)
+	}
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (expr *Expr) String() string {
+	switch expr.Kind {
+	case Constant:
+		return fmt.Sprint(expr.Value)
+	case Symbol:
+		return expr.Name
+	case Not:
+		return fmt.Sprintf("~%v", expr.Args[0])
+	}
+	return fmt.Sprintf("(%v %v %v)", expr.Args[0], operators[expr.Kind], expr.Args[1])
+}
+
+// Constraint requires an expression to be nonzero, if True, or zero.
+type Constraint struct {
+	Expr *Expr
+	True bool
+}
+
+// Holds reports whether the constraint holds with the given values for the symbols.
+func (constraint Constraint) Holds(values map[string]uint16) bool {
+	value, ok := constraint.Expr.Eval(values)
+	return ok && (value != 0) == constraint.True
+}
+
+func (constraint Constraint) String() string {
+	expr := constraint.Expr
+	switch {
+	case expr.Kind == Eq && constraint.True:
+		return fmt.Sprintf("%v == %v", expr.Args[0], expr.Args[1])
+	case expr.Kind == Eq:
+		return fmt.Sprintf("%v != %v", expr.Args[0], expr.Args[1])
+	case expr.Kind == Gt && constraint.True:
+		return fmt.Sprintf("%v > %v", expr.Args[0], expr.Args[1])
+	case expr.Kind == Gt:
+		return fmt.Sprintf("%v <= %v", expr.Args[0], expr.Args[1])
+	case constraint.True:
+		return fmt.Sprintf("%v != 0", expr)
+	}
+	return fmt.Sprintf("%v == 0", expr)
+}
@@ -0,0 +1,364 @@
+package symbolic
+
+// A variable of the SAT solver, or its negation: the variable times two, plus one if negated.
+type literal int
+
+func positive(variable int) literal {
+	return literal(variable << 1)
+}
+
+func (lit literal) variable() int {
+	return int(lit >> 1)
+}
+
+func (lit literal) not() literal {
+	return lit ^ 1
+}
+
+// A CDCL SAT solver over clauses of literals: it propagates units through two watched literals per clause, learns a
+// clause from the first unique implication point of every conflict, decides on the most active variable with its last
+// value and restarts every now and then.
+type sat struct {
+	clauses [][]literal
+	// Clauses by the literals they watch, which are their first two.
+	watches [][]int
+	// Per variable: 1 for true, -1 for false and 0 while unassigned.
+	values []int8
+	levels []int
+	// The clause that implied the value of a variable, or -1 for decisions and facts.
+	reasons []int
+	phases  []bool
+	// Assigned literals in order, and where every decision level starts in it.
+	trail  []literal
+	starts []int
+	// Next literal of the trail to propagate.
+	head int
+
+	activity  []float64
+	increment float64
+	order     variableHeap
+	seen      []bool
+	// False once a clause contradicts the facts, which makes every later solve fail.
+	ok bool
+}
+
+func newSat() *sat {
+	solver := &sat{increment: 1, ok: true}
+	solver.order.activity = &solver.activity
+	return solver
+}
+
+func (solver *sat) newVariable() int {
+	variable := len(solver.values)
+	solver.watches = append(solver.watches, nil, nil)
+	solver.values = append(solver.values, 0)
+	solver.levels = append(solver.levels, 0)
+	solver.reasons = append(solver.reasons, -1)
+	solver.phases = append(solver.phases, false)
+	solver.activity = append(solver.activity, 0)
+	solver.seen = append(solver.seen, false)
+	solver.order.push(variable)
+	return variable
+}
+
+func (solver *sat) value(lit literal) int8 {
+	value := solver.values[lit.variable()]
+	if lit&1 == 1 {
+		return -value
+	}
+	return value
+}
+
+// Adds a clause before solving, leaving out literals that are already false.
+func (solver *sat) addClause(lits ...literal) {
+	if !solver.ok {
+		return
+	}
+	clause := make([]literal, 0, len(lits))
+	present := map[literal]bool{}
+	for _, lit := range lits {
+		switch {
+		case solver.value(lit) == 1 || present[lit.not()]:
+			return
+		case solver.value(lit) == -1 || present[lit]:
+			continue
+		}
+		present[lit] = true
+		clause = append(clause, lit)
+	}
+
+	switch len(clause) {
+	case 0:
+		solver.ok = false
+	case 1:
+		solver.assign(clause[0], -1)
+		solver.ok = solver.propagate() < 0
+	default:
+		solver.watch(clause)
+	}
+}
+
+// Adds a clause and watches its first two literals, returning its index.
+func (solver *sat) watch(clause []literal) int {
+	index := len(solver.clauses)
+	solver.clauses = append(solver.clauses, clause)
+	solver.watches[clause[0]] = append(solver.watches[clause[0]], index)
+	solver.watches[clause[1]] = append(solver.watches[clause[1]], index)
+	return index
+}
+
+func (solver *sat) assign(lit literal, reason int) {
+	variable := lit.variable()
+	solver.values[variable] = 1
+	if lit&1 == 1 {
+		solver.values[variable] = -1
+	}
+	solver.levels[variable] = len(solver.starts)
+	solver.reasons[variable] = reason
+	solver.trail = append(solver.trail, lit)
+}
+
+// Assigns every literal the trail implies. Returns the clause that has become false, or -1.
+func (solver *sat) propagate() int {
+	for solver.head < len(solver.trail) {
+		falsified := solver.trail[solver.head].not()
+		solver.head++
+
+		watchers := solver.watches[falsified]
+		kept := watchers[:0]
+		for i := 0; i < len(watchers); i++ {
+			index := watchers[i]
+			clause := solver.clauses[index]
+			if clause[0] == falsified {
+				clause[0], clause[1] = clause[1], clause[0]
+			}
+			if solver.value(clause[0]) == 1 {
+				kept = append(kept, index)
+				continue
+			}
+
+			moved := false
+			for k := 2; k < len(clause); k++ {
+				if solver.value(clause[k]) != -1 {
+					clause[1], clause[k] = clause[k], clause[1]
+					solver.watches[clause[1]] = append(solver.watches[clause[1]], index)
+					moved = true
+					break
+				}
+			}
+			if moved {
+				continue
+			}
+
+			kept = append(kept, index)
+			if solver.value(clause[0]) == -1 {
+				solver.watches[falsified] = append(kept, watchers[i+1:]...)
+				solver.head = len(solver.trail)
+				return index
+			}
+			solver.assign(clause[0], index)
+		}
+		solver.watches[falsified] = kept
+	}
+	return -1
+}
+
+// Returns the clause learnt from a conflict, with the literal it asserts first and the literal of the highest other
+// level second, and the level to go back to.
+func (solver *sat) analyze(conflict int) ([]literal, int) {
+	learnt := []literal{0}
+	level := len(solver.starts)
+	pending := 0
+	implied := literal(-1)
+	index := len(solver.trail) - 1
+	for clause := conflict; ; clause = solver.reasons[implied.variable()] {
+		for _, lit := range solver.clauses[clause] {
+			variable := lit.variable()
+			if lit == implied || solver.seen[variable] || solver.levels[variable] == 0 {
+				continue
+			}
+			solver.seen[variable] = true
+			solver.bump(variable)
+			if solver.levels[variable] == level {
+				pending++
+			} else {
+				learnt = append(learnt, lit)
+			}
+		}
+
+		for !solver.seen[solver.trail[index].variable()] {
+			index--
+		}
+		implied = solver.trail[index]
+		index--
+		solver.seen[implied.variable()] = false
+		pending--
+		if pending == 0 {
+			break
+		}
+	}
+	learnt[0] = implied.not()
+
+	back := 0
+	for i := 1; i < len(learnt); i++ {
+		solver.seen[learnt[i].variable()] = false
+		if solver.levels[learnt[i].variable()] > back {
+			back = solver.levels[learnt[i].variable()]
+			learnt[1], learnt[i] = learnt[i], learnt[1]
+		}
+	}
+	return learnt, back
+}
+
+func (solver *sat) bump(variable int) {
+	solver.activity[variable] += solver.increment
+	if solver.activity[variable] > 1e100 {
+		for i := range solver.activity {
+			solver.activity[i] *= 1e-100
+		}
+		solver.increment *= 1e-100
+	}
+	solver.order.update(variable)
+}
+
+// Undoes every assignment above level.
+func (solver *sat) backtrack(level int) {
+	if len(solver.starts) <= level {
+		return
+	}
+	for i := len(solver.trail) - 1; i >= solver.starts[level]; i-- {
+		variable := solver.trail[i].variable()
+		solver.phases[variable] = solver.values[variable] == 1
+		solver.values[variable] = 0
+		solver.reasons[variable] = -1
+		solver.order.push(variable)
+	}
+	solver.trail = solver.trail[:solver.starts[level]]
+	solver.starts = solver.starts[:level]
+	solver.head = len(solver.trail)
+}
+
+// Looks for an assignment that satisfies every clause, giving up after maxConflicts conflicts. Returns whether one
+// exists and whether the search finished.
+func (solver *sat) solve(maxConflicts int) (bool, bool) {
+	if !solver.ok {
+		return false, true
+	}
+	conflicts, restart := 0, 100
+	for {
+		if conflict := solver.propagate(); conflict >= 0 {
+			conflicts++
+			if len(solver.starts) == 0 {
+				solver.ok = false
+				return false, true
+			}
+			if conflicts >= maxConflicts {
+				solver.backtrack(0)
+				return false, false
+			}
+
+			learnt, level := solver.analyze(conflict)
+			solver.backtrack(level)
+			if len(learnt) == 1 {
+				solver.assign(learnt[0], -1)
+			} else {
+				solver.assign(learnt[0], solver.watch(learnt))
+			}
+			solver.increment *= 1.05
+			continue
+		}
+
+		if conflicts >= restart {
+			restart = conflicts + restart*3/2
+			solver.backtrack(0)
+			continue
+		}
+
+		variable := solver.order.pop(solver.values)
+		if variable < 0 {
+			return true, true
+		}
+		solver.starts = append(solver.starts, len(solver.trail))
+		lit := positive(variable)
+		if !solver.phases[variable] {
+			lit = lit.not()
+		}
+		solver.assign(lit, -1)
+	}
+}
+
+// A heap of variables by activity, most active first, which may still hold variables that have been assigned since
+// they were pushed.
+type variableHeap struct {
+	activity *[]float64
+	heap     []int
+	// Position of every variable in heap, or -1.
+	positions []int
+}
+
+func (order *variableHeap) less(i int, j int) bool {
+	return (*order.activity)[order.heap[i]] > (*order.activity)[order.heap[j]]
+}
+
+func (order *variableHeap) swap(i int, j int) {
+	order.heap[i], order.heap[j] = order.heap[j], order.heap[i]
+	order.positions[order.heap[i]] = i
+	order.positions[order.heap[j]] = j
+}
+
+func (order *variableHeap) up(i int) {
+	for i > 0 && order.less(i, (i-1)/2) {
+		order.swap(i, (i-1)/2)
+		i = (i - 1) / 2
+	}
+}
+
+func (order *variableHeap) down(i int) {
+	for {
+		child := 2*i + 1
+		if child >= len(order.heap) {
+			return
+		}
+		if child+1 < len(order.heap) && order.less(child+1, child) {
+			child++
+		}
+		if !order.less(child, i) {
+			return
+		}
+		order.swap(i, child)
+		i = child
+	}
+}
+
+func (order *variableHeap) push(variable int) {
+	for len(order.positions) <= variable {
+		order.positions = append(order.positions, -1)
+	}
+	if order.positions[variable] >= 0 {
+		return
+	}
+	order.heap = append(order.heap, variable)
+	order.positions[variable] = len(order.heap) - 1
+	order.up(len(order.heap) - 1)
+}
+
+func (order *variableHeap) update(variable int) {
+	if position := order.positions[variable]; position >= 0 {
+		order.up(position)
+	}
+}
+
+// Removes and returns the most active unassigned variable, or -1 once every variable is assigned.
+func (order *variableHeap) pop(values []int8) int {
+	for len(order.heap) > 0 {
+		variable := order.heap[0]
+		order.swap(0, len(order.heap)-1)
+		order.heap = order.heap[:len(order.heap)-1]
+		order.positions[variable] = -1
+		order.down(0)
+		if values[variable] == 0 {
+			return variable
+		}
+	}
+	return -1
+}
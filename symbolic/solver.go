@@ -0,0 +1,279 @@
+package symbolic
+
+// Expressions are 16 bits wide, the lowest bit first, so that raw words of memory fit.
+const width = 16
+
+type Result int
+
+const (
+	Unsatisfiable Result = iota
+	Satisfiable
+	// The solver gave up before it found values or proved there are none.
+	Unknown
+)
+
+func (result Result) String() string {
+	return [...]string{"unsatisfiable", "satisfiable", "unknown"}[result]
+}
+
+// Solver looks for values of symbols that satisfy constraints. Symbols are 15 bit values like the registers.
+type Solver struct {
+	// Largest value of a symbol, 32767 for the symbols not listed, like 127 for an input character.
+	Maxima map[string]uint16
+	// Conflicts the SAT solver may run into before it gives up, 100000 if 0.
+	Conflicts int
+}
+
+// Solve returns values for every symbol in constraints that satisfy all of them, if the solver finds some.
+func (solver Solver) Solve(constraints []Constraint) (map[string]uint16, Result) {
+	circuit := newCircuit()
+	for _, constraint := range constraints {
+		bits := circuit.blast(constraint.Expr)
+		if constraint.True {
+			circuit.sat.addClause(bits...)
+		} else {
+			for _, bit := range bits {
+				circuit.sat.addClause(bit.not())
+			}
+		}
+	}
+	for name, bits := range circuit.symbols {
+		maximum, ok := solver.Maxima[name]
+		if !ok || maximum > 32767 {
+			maximum = 32767
+		}
+		circuit.sat.addClause(circuit.less(circuit.constant(maximum), bits).not())
+	}
+
+	conflicts := solver.Conflicts
+	if conflicts == 0 {
+		conflicts = 100000
+	}
+	satisfiable, finished := circuit.sat.solve(conflicts)
+	switch {
+	case !finished:
+		return nil, Unknown
+	case !satisfiable:
+		return nil, Unsatisfiable
+	}
+
+	values := map[string]uint16{}
+	for name, bits := range circuit.symbols {
+		for i, bit := range bits {
+			if circuit.sat.value(bit) == 1 {
+				values[name] |= 1 << i
+			}
+		}
+	}
+	return values, Satisfiable
+}
+
+// Turns expressions into clauses over their bits, one gate at a time. Gates with constant inputs are folded away.
+type circuit struct {
+	sat         *sat
+	true, false literal
+	blasted     map[*Expr][]literal
+	symbols     map[string][]literal
+}
+
+func newCircuit() *circuit {
+	solver := newSat()
+	truth := positive(solver.newVariable())
+	solver.addClause(truth)
+	return &circuit{sat: solver, true: truth, false: truth.not(), blasted: map[*Expr][]literal{}, symbols: map[string][]literal{}}
+}
+
+func (circuit *circuit) fresh() literal {
+	return positive(circuit.sat.newVariable())
+}
+
+func (circuit *circuit) constant(value uint16) []literal {
+	bits := make([]literal, width)
+	for i := range bits {
+		bits[i] = circuit.false
+		if value&(1<<i) != 0 {
+			bits[i] = circuit.true
+		}
+	}
+	return bits
+}
+
+func (circuit *circuit) variables(count int) []literal {
+	bits := make([]literal, count)
+	for i := range bits {
+		bits[i] = circuit.fresh()
+	}
+	return bits
+}
+
+func (circuit *circuit) and(a literal, b literal) literal {
+	switch {
+	case a == circuit.false || b == circuit.false || a == b.not():
+		return circuit.false
+	case a == circuit.true || a == b:
+		return b
+	case b == circuit.true:
+		return a
+	}
+	gate := circuit.fresh()
+	circuit.sat.addClause(gate.not(), a)
+	circuit.sat.addClause(gate.not(), b)
+	circuit.sat.addClause(gate, a.not(), b.not())
+	return gate
+}
+
+func (circuit *circuit) or(a literal, b literal) literal {
+	return circuit.and(a.not(), b.not()).not()
+}
+
+func (circuit *circuit) xor(a literal, b literal) literal {
+	switch {
+	case a == circuit.false:
+		return b
+	case b == circuit.false:
+		return a
+	case a == circuit.true:
+		return b.not()
+	case b == circuit.true:
+		return a.not()
+	case a == b:
+		return circuit.false
+	case a == b.not():
+		return circuit.true
+	}
+	gate := circuit.fresh()
+	circuit.sat.addClause(gate.not(), a, b)
+	circuit.sat.addClause(gate.not(), a.not(), b.not())
+	circuit.sat.addClause(gate, a.not(), b)
+	circuit.sat.addClause(gate, a, b.not())
+	return gate
+}
+
+// Adds two numbers of the same width, dropping the carry out of the top bit.
+func (circuit *circuit) add(a []literal, b []literal) []literal {
+	sum := make([]literal, len(a))
+	carry := circuit.false
+	for i := range a {
+		half := circuit.xor(a[i], b[i])
+		sum[i] = circuit.xor(half, carry)
+		carry = circuit.or(circuit.and(a[i], b[i]), circuit.and(carry, half))
+	}
+	return sum
+}
+
+// Multiplies two numbers into a product of the given width, by adding shifted copies of a.
+func (circuit *circuit) multiply(a []literal, b []literal, size int) []literal {
+	product := make([]literal, size)
+	for i := range product {
+		product[i] = circuit.false
+	}
+	for i := 0; i < len(b) && i < size; i++ {
+		partial := make([]literal, size)
+		for j := range partial {
+			partial[j] = circuit.false
+			if j >= i && j-i < len(a) {
+				partial[j] = circuit.and(a[j-i], b[i])
+			}
+		}
+		product = circuit.add(product, partial)
+	}
+	return product
+}
+
+// Returns whether a is below b, with both unsigned.
+func (circuit *circuit) less(a []literal, b []literal) literal {
+	below := circuit.false
+	for i := range a {
+		same := circuit.xor(a[i], b[i]).not()
+		below = circuit.or(circuit.and(a[i].not(), b[i]), circuit.and(same, below))
+	}
+	return below
+}
+
+func (circuit *circuit) equal(a []literal, b []literal) literal {
+	equal := circuit.true
+	for i := range a {
+		equal = circuit.and(equal, circuit.xor(a[i], b[i]).not())
+	}
+	return equal
+}
+
+func (circuit *circuit) extend(bits []literal, size int) []literal {
+	extended := append([]literal{}, bits...)
+	for len(extended) < size {
+		extended = append(extended, circuit.false)
+	}
+	return extended
+}
+
+// Returns the bits of a value that is 1 if condition holds and 0 otherwise.
+func (circuit *circuit) flag(condition literal) []literal {
+	bits := circuit.constant(0)
+	bits[0] = condition
+	return bits
+}
+
+// Returns the bits of the value of expr.
+func (circuit *circuit) blast(expr *Expr) []literal {
+	if bits, ok := circuit.blasted[expr]; ok {
+		return bits
+	}
+
+	var bits []literal
+	switch expr.Kind {
+	case Constant:
+		bits = circuit.constant(expr.Value)
+	case Symbol:
+		if bits = circuit.symbols[expr.Name]; bits == nil {
+			bits = circuit.variables(width)
+			circuit.symbols[expr.Name] = bits
+		}
+	case Not:
+		a := circuit.blast(expr.Args[0])
+		bits = make([]literal, width)
+		for i := range bits {
+			bits[i] = a[i].not()
+		}
+		bits[width-1] = circuit.false
+	default:
+		a, b := circuit.blast(expr.Args[0]), circuit.blast(expr.Args[1])
+		bits = circuit.operation(expr.Kind, a, b)
+	}
+
+	circuit.blasted[expr] = bits
+	return bits
+}
+
+func (circuit *circuit) operation(kind Kind, a []literal, b []literal) []literal {
+	bits := make([]literal, width)
+	switch kind {
+	case Add:
+		bits = circuit.add(a, b)
+		bits[width-1] = circuit.false
+	case Mult:
+		bits = circuit.multiply(a, b, width)
+		bits[width-1] = circuit.false
+	case Mod:
+		// a = quotient * b + remainder with remainder < b, which also rules out b = 0. Twice the width keeps the
+		// product from overflowing.
+		quotient, remainder := circuit.variables(width), circuit.variables(width)
+		product := circuit.multiply(quotient, b, 2*width)
+		total := circuit.add(product, circuit.extend(remainder, 2*width))
+		circuit.sat.addClause(circuit.equal(total, circuit.extend(a, 2*width)))
+		circuit.sat.addClause(circuit.less(remainder, b))
+		bits = remainder
+	case And:
+		for i := range bits {
+			bits[i] = circuit.and(a[i], b[i])
+		}
+	case Or:
+		for i := range bits {
+			bits[i] = circuit.or(a[i], b[i])
+		}
+	case Eq:
+		bits = circuit.flag(circuit.equal(a, b))
+	case Gt:
+		bits = circuit.flag(circuit.less(b, a))
+	}
+	return bits
+}
@@ -0,0 +1,104 @@
+package symbolic
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	x := Sym("x")
+	for expr, expected := range map[*Expr]string{
+		Apply(Add, Const(32767), Const(2)):           "1",
+		Apply(Mult, Const(200), Const(200)):          "7232",
+		Apply(Not, Const(0)):                         "32767",
+		Apply(Mod, Const(7), Const(0)):               "(7 % 0)",
+		Apply(Add, x, Const(0)):                      "x",
+		Apply(Add, Apply(Or, x, Const(0)), Const(0)): "((x | 0) + 0)",
+		Apply(Mult, x, Const(0)):                     "0",
+		Apply(Eq, x, x):                              "1",
+		Apply(Gt, Apply(Not, x), Const(3)):           "(~x > 3)",
+	} {
+		if expr.String() != expected {
+			t.Errorf("expected %v, got %v", expected, expr)
+		}
+	}
+
+	expr := Apply(Mod, Apply(Mult, Sym("b"), Sym("a")), Const(97))
+	if value, ok := expr.Eval(map[string]uint16{"a": 300, "b": 200}); !ok || value != (60000%32768)%97 {
+		t.Errorf("expected %v, got %v", (60000%32768)%97, value)
+	}
+	if names := expr.Symbols(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("expected the symbols a and b, got %v", names)
+	}
+}
+
+func TestSolve(t *testing.T) {
+	x, y := Sym("x"), Sym("y")
+	constraints := []Constraint{
+		{Expr: Apply(Eq, Apply(Mod, Apply(Mult, x, Const(3)), Const(7)), Const(5)), True: true},
+		{Expr: Apply(Gt, x, Const(100)), True: true},
+		{Expr: Apply(Gt, x, Const(110)), True: false},
+		{Expr: Apply(Eq, Apply(Add, x, y), Const(3)), True: true},
+	}
+	values, result := Solver{}.Solve(constraints)
+	if result != Satisfiable {
+		t.Fatalf("expected values, got %v", result)
+	}
+	for _, constraint := range constraints {
+		if !constraint.Holds(values) {
+			t.Errorf("%v does not hold with %v", constraint, values)
+		}
+	}
+
+	solver := Solver{Maxima: map[string]uint16{"x": 127}}
+	if values, result := solver.Solve(constraints[1:2]); result != Satisfiable || values["x"] <= 100 || values["x"] > 127 {
+		t.Errorf("expected x from 101 to 127, got %v (%v)", values, result)
+	}
+	if _, result := solver.Solve([]Constraint{{Expr: Apply(Gt, x, Const(127)), True: true}}); result != Unsatisfiable {
+		t.Errorf("expected no x above its maximum, got %v", result)
+	}
+	// A symbol divided by cannot be zero.
+	if _, result := solver.Solve([]Constraint{{Expr: Apply(Eq, Apply(Mod, y, x), Const(0)), True: true}, {Expr: x, True: false}}); result != Unsatisfiable {
+		t.Errorf("expected no division by zero, got %v", result)
+	}
+}
+
+// Random expression over the symbols a and b.
+func randomExpr(random *rand.Rand, depth int) *Expr {
+	if depth == 0 || random.Intn(4) == 0 {
+		switch random.Intn(3) {
+		case 0:
+			return Sym("a")
+		case 1:
+			return Sym("b")
+		}
+		return Const(uint16(random.Intn(65536)))
+	}
+	kind := []Kind{Add, Mult, Mod, And, Or, Not, Eq, Gt}[random.Intn(8)]
+	if kind == Not {
+		return Apply(Not, randomExpr(random, depth-1))
+	}
+	return Apply(kind, randomExpr(random, depth-1), randomExpr(random, depth-1))
+}
+
+// The solver has to agree with Eval: whatever values it finds satisfy the constraints, and it finds values whenever a
+// known assignment does.
+func TestSolveAgreesWithEval(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		expr := randomExpr(random, 3)
+		known := map[string]uint16{"a": uint16(random.Intn(32768)), "b": uint16(random.Intn(32768))}
+		value, ok := expr.Eval(known)
+		if !ok {
+			continue
+		}
+		constraint := Constraint{Expr: Apply(Eq, expr, Const(value)), True: true}
+
+		values, result := Solver{}.Solve([]Constraint{constraint})
+		if result != Satisfiable {
+			t.Errorf("%v: expected values as %v has some, got %v", constraint, known, result)
+		} else if !constraint.Holds(values) {
+			t.Errorf("%v does not hold with %v", constraint, values)
+		}
+	}
+}
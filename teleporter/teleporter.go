@@ -0,0 +1,176 @@
+// Package teleporter finds the values of r7 the teleporter confirmation accepts, reading how the confirmation function
+// is called and what it has to return from the code around the call.
+package teleporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ckyong/synacor/hooks"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+const (
+	r0 = 32768
+	r1 = 32769
+)
+
+// CallSite is a call of a recursive function, like the confirmation function, whose result is checked right away:
+//
+//	set r0 <A>
+//	set r1 <B>
+//	call <Function>
+//	eq <register> r0 <Expected>
+type CallSite struct {
+	// Address of the call instruction.
+	Address  uint16
+	Function uint16
+	A, B     uint16
+	Expected uint16
+}
+
+// FindCallSites returns every call in memory that is set up and checked like a CallSite, in order of address. A function
+// counts as recursive if it calls itself within its first 64 words.
+func FindCallSites(memory []uint16) []CallSite {
+	var sites []CallSite
+	for call := 6; call+5 < len(memory); call++ {
+		if memory[call] != 17 {
+			continue
+		}
+
+		site := CallSite{Address: uint16(call), Function: memory[call+1]}
+		if !recursive(memory, site.Function) {
+			continue
+		}
+		found := map[uint16]bool{}
+		for _, set := range []int{call - 6, call - 3} {
+			if memory[set] != 1 || (memory[set+1] != r0 && memory[set+1] != r1) || memory[set+2] >= 32768 {
+				break
+			}
+			if memory[set+1] == r0 {
+				site.A = memory[set+2]
+			} else {
+				site.B = memory[set+2]
+			}
+			found[memory[set+1]] = true
+		}
+		if !found[r0] || !found[r1] {
+			continue
+		}
+
+		eq := memory[call+2 : call+6]
+		switch {
+		case eq[0] != 4 || eq[1] < 32768 || eq[1] > 32775:
+			continue
+		case eq[2] == r0 && eq[3] < 32768:
+			site.Expected = eq[3]
+		case eq[3] == r0 && eq[2] < 32768:
+			site.Expected = eq[2]
+		default:
+			continue
+		}
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+func recursive(memory []uint16, function uint16) bool {
+	for address := int(function); address < int(function)+64 && address+1 < len(memory); address++ {
+		if memory[address] == 17 && memory[address+1] == function {
+			return true
+		}
+	}
+	return false
+}
+
+func (site CallSite) String() string {
+	return fmt.Sprintf("call %v at %v with r0 = %v and r1 = %v, expecting %v", site.Function, site.Address, site.A, site.B, site.Expected)
+}
+
+// Verify checks that the function of the call site is the confirmation function the search evaluates, by running the
+// guest code for small arguments and comparing the r0 it returns with hooks.ConfirmationTable. Every call may take up
+// to budget instructions.
+func Verify(memory []uint16, site CallSite, budget int) error {
+	table := hooks.NewConfirmationTable(32768)
+	for a := uint16(0); a <= 3; a++ {
+		for b := uint16(0); b <= 3; b++ {
+			for _, c := range []uint16{1, 2, 3} {
+				vm := VirtualMachine.New(memory)
+				vm.SetIO(strings.NewReader(""), io.Discard)
+				vm.Register = [8]uint16{a, b, 0, 0, 0, 0, 0, c}
+				// Return to a halt in the last word of Memory.
+				vm.Memory.Set(VirtualMachine.MemorySize-1, 0)
+				vm.Stack.Push(VirtualMachine.MemorySize - 1)
+				vm.Index = site.Function
+
+				engine := VirtualMachine.NewThreaded(vm)
+				for steps := 0; ; steps++ {
+					if steps == budget {
+						return fmt.Errorf("f(%v, %v) with r7 = %v did not return within %v instructions", a, b, c, budget)
+					}
+					halted, err := engine.Step()
+					if err != nil {
+						return fmt.Errorf("f(%v, %v) with r7 = %v: %w", a, b, c, err)
+					}
+					if halted {
+						break
+					}
+				}
+
+				if expected := table.Evaluate(a, b, c); vm.Register[0] != expected {
+					return fmt.Errorf("f(%v, %v) with r7 = %v returned %v instead of %v", a, b, c, vm.Register[0], expected)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Search evaluates the confirmation function for the arguments of site with every r7 from first to last, modulo
+// modulus, on workers goroutines, and returns the values of r7 for which it returns the expected result, in order.
+// progress is called with the number of values evaluated so far, from one worker at a time, if it is not nil.
+func Search(site CallSite, modulus int, first uint16, last uint16, workers int, progress func(done int)) []uint16 {
+	if workers < 1 {
+		workers = 1
+	}
+
+	candidates := make(chan uint16, workers)
+	go func() {
+		for c := int(first); c <= int(last); c++ {
+			candidates <- uint16(c)
+		}
+		close(candidates)
+	}()
+
+	var lock sync.Mutex
+	var matches []uint16
+	done := 0
+	var group sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			table := hooks.NewConfirmationTable(modulus)
+			for c := range candidates {
+				match := table.Evaluate(site.A, site.B, c) == site.Expected
+
+				lock.Lock()
+				if match {
+					matches = append(matches, c)
+				}
+				done++
+				if progress != nil {
+					progress(done)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i] < matches[j] })
+	return matches
+}
@@ -0,0 +1,127 @@
+package teleporter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// A call site at 10 of the confirmation function from notes/teleporter.txt, moved to 100.
+func program() []uint16 {
+	memory := make([]uint16, 200)
+	copy(memory[10:], []uint16{
+		// 10: set r1 1
+		1, r1, 1,
+		// 13: set r0 4
+		1, r0, 4,
+		// 16: call 100
+		17, 100,
+		// 18: eq r1 r0 6
+		4, r1, r0, 6,
+		// 22: halt
+		0,
+	})
+	copy(memory[100:], []uint16{
+		// 100: jt r0 108
+		7, r0, 108,
+		// 103: add r0 r1 1
+		9, r0, r1, 1,
+		// 107: ret
+		18,
+		// 108: jt r1 121
+		7, r1, 121,
+		// 111: add r0 r0 32767
+		9, r0, r0, 32767,
+		// 115: set r1 r7
+		1, r1, 32775,
+		// 118: call 100
+		17, 100,
+		// 120: ret
+		18,
+		// 121: push r0
+		2, r0,
+		// 123: add r1 r1 32767
+		9, r1, r1, 32767,
+		// 127: call 100
+		17, 100,
+		// 129: set r1 r0
+		1, r1, r0,
+		// 132: pop r0
+		3, r0,
+		// 134: add r0 r0 32767
+		9, r0, r0, 32767,
+		// 138: call 100
+		17, 100,
+		// 140: ret
+		18,
+	})
+	return memory
+}
+
+func TestFindCallSites(t *testing.T) {
+	sites := FindCallSites(program())
+	expected := []CallSite{{Address: 16, Function: 100, A: 4, B: 1, Expected: 6}}
+	if !reflect.DeepEqual(sites, expected) {
+		t.Errorf("expected %v, got %v", expected, sites)
+	}
+
+	// A call of a function that does not call itself does not count.
+	memory := program()
+	memory[17] = 108
+	if sites := FindCallSites(memory); len(sites) != 0 {
+		t.Errorf("expected no call sites, got %v", sites)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	memory := program()
+	if err := Verify(memory, CallSite{Function: 100}, 10_000_000); err != nil {
+		t.Error(err)
+	}
+
+	// f(0, b) = b + 2 instead.
+	memory[106] = 2
+	if err := Verify(memory, CallSite{Function: 100}, 10_000_000); err == nil {
+		t.Error("expected a function that adds 2 not to verify")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	site := CallSite{A: 4, B: 1, Expected: 6}
+	if matches := Search(site, 32768, 25700, 25800, 3, nil); !reflect.DeepEqual(matches, []uint16{25734}) {
+		t.Errorf("expected 25734, got %v", matches)
+	}
+
+	// Every value of r7 makes f(0, 5) return 6, and the progress counts all of them.
+	calls := 0
+	matches := Search(CallSite{A: 0, B: 5, Expected: 6}, 100, 1, 99, 4, func(done int) { calls++ })
+	if len(matches) != 99 || matches[0] != 1 || matches[98] != 99 || calls != 99 {
+		t.Errorf("expected every value from 1 to 99 and 99 progress calls, got %v and %v calls", matches, calls)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := vm.DumpMemory()
+
+	var confirmations []CallSite
+	for _, site := range FindCallSites(memory[:]) {
+		if Verify(memory[:], site, 10_000_000) == nil {
+			confirmations = append(confirmations, site)
+		}
+	}
+	expected := []CallSite{{Address: 5489, Function: 6027, A: 4, B: 1, Expected: 6}}
+	if !reflect.DeepEqual(confirmations, expected) {
+		t.Errorf("expected %v, got %v", expected, confirmations)
+	}
+}
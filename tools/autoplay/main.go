@@ -1,66 +1,102 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
-	expect "github.com/Netflix/go-expect"
-	"log"
 	"os"
-	"os/exec"
-	_ "os/exec"
-	"path/filepath"
-	"time"
+
+	"github.com/ckyong/synacor/codes"
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
 )
 
+// Plays a transcript against the game and exits with status 1 if one of its expectations is not met.
 func main() {
-	console, err := expect.NewConsole(expect.WithStdout(os.Stdout))
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	transcriptPath := flag.String("transcript", "./tools/autoplay/autopath.txt", "transcript to play")
+	interactive := flag.Bool("interactive", false, "keep playing from stdin once the transcript is done")
+	record := flag.String("record", "", "record everything read from the input into this session file")
+	codesPath := flag.String("codes", "", "write the codes found in the output to this file")
+	descriptorPath := flag.String("descriptor", "", "descriptor file of where the inspect command finds the game state")
+	flag.Parse()
 
+	entries, err := transcript.Load(*transcriptPath)
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
-	defer console.Close()
-
-	cmd := exec.Command("synacorvm_linux")
-	cmd.Stdin = console.Tty()
-	cmd.Stdout = console.Tty()
-	cmd.Stderr = console.Tty()
-
-	go func() {
-		console.ExpectEOF()
-	}()
 
-	err = cmd.Start()
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 
-	filePath := filepath.Join("./tools/autoplay/autopath.txt")
+	descriptor := gamestate.Challenge
+	if *descriptorPath != "" {
+		if descriptor, err = gamestate.LoadDescriptor(*descriptorPath); err != nil {
+			fail(err)
+		}
+	}
+	gamestate.Install(vm, descriptor)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
+	player := transcript.NewPlayer(vm, entries, os.Stdout)
+	detector := &codes.Detector{}
+	vm.AddObserver(detector)
+	if *interactive {
+		player.Interactive = os.Stdin
 	}
 
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			fmt.Printf("Could not close file: %v", err)
+	if *record != "" {
+		if err := vm.StartRecording(); err != nil {
+			fail(err)
 		}
-	}(file)
+	}
 
-	scanner := bufio.NewScanner(file)
+	err = player.Play(VirtualMachine.NewThreaded(vm))
+	if *record != "" {
+		if err := vm.StopRecording().Save(*record); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not save session:", err)
+		}
+	}
 
-	for scanner.Scan() {
-		time.Sleep(time.Millisecond)
-		console.SendLine(scanner.Text())
+	summarize(detector)
+	if *codesPath != "" {
+		if err := detector.Save(*codesPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not save codes:", err)
+		}
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		var expectation *transcript.ExpectationError
+		if errors.As(err, &expectation) {
+			fmt.Fprintf(os.Stderr, "\nExpectation failed on line %v: %q was not printed\n", expectation.Line, expectation.Expected)
+			os.Exit(1)
+		}
+		fail(err)
 	}
+}
 
-	input := bufio.NewScanner(os.Stdin)
-	for input.Scan() {
-		console.SendLine(input.Text())
+func summarize(detector *codes.Detector) {
+	fmt.Printf("\n\nFound %v codes:\n", len(detector.Codes))
+	for _, code := range detector.Codes {
+		room := code.Room
+		if room == "" {
+			room = "before the first room"
+		}
+		fmt.Printf("  %v  at step %v, %v\n", code.Code, code.Step, room)
+		if code.Mirrored != "" {
+			fmt.Printf("  %v  as seen in the mirror\n", code.Mirrored)
+		}
 	}
 }
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
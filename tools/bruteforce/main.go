@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/ckyong/synacor/bruteforce"
+	"github.com/ckyong/synacor/hooks"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Tries every value in a range for a register or a word of memory, starting from where a transcript or saved state
+// leaves the game, and prints the values that make the game reach an address or print a text. Interrupting it prints
+// what has been found so far. For example, to find the energy level of the teleporter once it has been taken:
+//
+//	bruteforce -transcript before_teleporter.txt -vary r7 -from 1 -to 32767 -input "use teleporter" -reach 5498
+func main() {
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	prefixPath := flag.String("transcript", "", "transcript to play before the search")
+	statePath := flag.String("state", "", "state saved with save state to search from instead")
+	vary := flag.String("vary", "r7", "register, r0 to r7, or address of the word to vary")
+	from := flag.Uint("from", 1, "first value to try")
+	to := flag.Uint("to", 32767, "last value to try")
+	input := flag.String("input", "", "command every candidate is given")
+	reach := flag.Int("reach", -1, "a candidate matches once it reaches this address")
+	prints := flag.String("prints", "", "a candidate matches once it prints this text")
+	budget := flag.Uint64("budget", 10_000_000, "instructions a candidate may take before it is given up on")
+	workers := flag.Int("workers", runtime.NumCPU(), "candidates to run at the same time")
+	native := flag.Bool("hooks", true, "run known functions natively, see package hooks")
+	first := flag.Bool("first", false, "stop at the first match")
+	flag.Parse()
+
+	location, err := bruteforce.ParseLocation(*vary)
+	if err != nil {
+		fail(err)
+	}
+	if *from > *to || *to > 32767 {
+		fail(fmt.Errorf("%v to %v is not a range of values", *from, *to))
+	}
+	var goal bruteforce.Goal
+	switch {
+	case *reach >= 0 && *prints != "":
+		fail(fmt.Errorf("only one of -reach and -prints can be given"))
+	case *reach >= 0:
+		goal = bruteforce.Reaches(uint16(*reach))
+	case *prints != "":
+		goal = bruteforce.Prints(*prints)
+	default:
+		fail(fmt.Errorf("one of -reach and -prints has to be given"))
+	}
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+	if *prefixPath != "" {
+		prefix, err := transcript.Load(*prefixPath)
+		if err != nil {
+			fail(err)
+		}
+		if err := transcript.NewPlayer(vm, prefix, io.Discard).Play(vm); err != nil {
+			fail(err)
+		}
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			fail(err)
+		}
+	}
+	snapshot, err := vm.Snapshot()
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	search := bruteforce.Search{
+		Snapshot: snapshot,
+		Location: location,
+		From:     uint16(*from),
+		To:       uint16(*to),
+		Budget:   *budget,
+		Goal:     goal,
+		Workers:  *workers,
+		Progress: progress(),
+		Found: func(match bruteforce.Match) {
+			fmt.Printf("\r%v = %v after %v instructions\n", location, match.Value, match.Steps)
+			if *first {
+				cancel()
+			}
+		},
+	}
+	if *input != "" {
+		search.Input = *input + "\n"
+	}
+	if *native {
+		search.Prepare = hooks.Install
+	}
+
+	start := time.Now()
+	matches, err := search.Run(ctx)
+	fmt.Fprintln(os.Stderr)
+	if err != nil && !(*first && len(matches) > 0) {
+		fmt.Fprintln(os.Stderr, "Stopped:", err)
+	}
+	fmt.Printf("Found %v matches in %v\n", len(matches), time.Since(start).Round(time.Millisecond))
+}
+
+// Returns a progress function that reports to stderr whenever another percent of the candidates is done.
+func progress() func(done int, total int) {
+	reported := -1
+	return func(done int, total int) {
+		if percent := done * 100 / total; percent != reported {
+			reported = percent
+			fmt.Fprintf(os.Stderr, "\r%v%% of %v values", percent, total)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ckyong/synacor/coins"
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+	"github.com/ckyong/synacor/world"
+)
+
+// Solves the monument in the ruins for the game left in front of it by a transcript or a saved state, places the
+// coins in the game to check that the north door opens, and prints the commands that place them, one per line.
+func main() {
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	transcriptPath := flag.String("transcript", "./tools/coin_solver/coins.txt", "transcript that collects the coins and goes to the monument")
+	statePath := flag.String("state", "", "state saved in front of the monument to start from instead")
+	fromMemory := flag.Bool("memory", false, "read the equation and the coins from memory instead of from the game output")
+	descriptorPath := flag.String("descriptor", "", "descriptor file of where the game keeps its rooms and items, with -memory")
+	budget := flag.Uint64("budget", 10_000_000, "instructions a command may take before it is given up on")
+	flag.Parse()
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+
+	var entries []transcript.Entry
+	if *statePath == "" {
+		if entries, err = transcript.Load(*transcriptPath); err != nil {
+			fail(err)
+		}
+	}
+	if err := transcript.NewPlayer(vm, entries, io.Discard).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+		fail(err)
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			fail(err)
+		}
+	}
+
+	var equation coins.Equation
+	var values map[string]int
+	if *fromMemory {
+		descriptor := gamestate.Challenge
+		if *descriptorPath != "" {
+			if descriptor, err = gamestate.LoadDescriptor(*descriptorPath); err != nil {
+				fail(err)
+			}
+		}
+		equation, values, err = coins.FromMemory(gamestate.New(&vm.Memory, descriptor))
+	} else {
+		equation, values, err = coins.FromOutput(vm, *budget)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%v with %v\n", equation.Text, values)
+	order, ok := equation.Solve(values)
+	if !ok {
+		fail(fmt.Errorf("no order of the coins makes %v hold", equation.Text))
+	}
+
+	output := strings.Builder{}
+	for _, command := range coins.Commands(order) {
+		printed, outcome, err := world.Send(vm, command, *budget)
+		if err != nil {
+			fail(err)
+		}
+		if outcome != world.Waiting {
+			fail(fmt.Errorf("%v: the game did not ask for the next command (%v)", command, outcome))
+		}
+		output.WriteString(printed)
+	}
+	if !strings.Contains(output.String(), coins.DoorOpen) {
+		fail(fmt.Errorf("the door did not open, the game printed %q", output.String()))
+	}
+
+	fmt.Fprintln(os.Stderr, "The north door opens")
+	fmt.Println(strings.Join(coins.Commands(order), "\n"))
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
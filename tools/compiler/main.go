@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ckyong/synacor/compiler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func main() {
+	output := flag.String("o", "./compiled/main.go", "file to write the generated program to")
+	entries := flag.String("entries", "0", "comma separated addresses of the functions to compile, along with what they call")
+	from := flag.Uint("from", 0, "only compile blocks starting at or after this address")
+	to := flag.Uint("to", 0, "only compile blocks starting at or before this address, 0 for no limit")
+	sweep := flag.Bool("sweep", true, "also compile every function that is the target of a literal call anywhere in memory")
+	flag.Parse()
+
+	filePath := filepath.Join("./resources/challenge.bin")
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			fmt.Printf("Could not close file: %v", err)
+		}
+	}(file)
+
+	vm, err := VirtualMachine.Load(file)
+	if err != nil {
+		panic(err)
+	}
+
+	options := compiler.Options{From: uint16(*from), To: uint16(*to), Sweep: *sweep}
+	for _, entry := range strings.Split(*entries, ",") {
+		address, err := strconv.ParseUint(strings.TrimSpace(entry), 10, 15)
+		if err != nil {
+			panic(err)
+		}
+		options.Entries = append(options.Entries, uint16(address))
+	}
+
+	memory := vm.DumpMemory()
+	source, err := compiler.Compile(memory[:], options)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*output), 0777); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(*output, source, 0666); err != nil {
+		panic(err)
+	}
+	fmt.Println("Compiled to", *output)
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/memdiff"
 	VirtualMachine "github.com/ckyong/synacor/vm"
 	"os"
 	"path/filepath"
 )
 
 func main() {
+	descriptor := flag.String("descriptor", "", "descriptor file of where the inspect command finds the game state")
+	flag.Parse()
+
 	filePath := filepath.Join("./resources/challenge.bin")
 
 	file, err := os.Open(filePath)
@@ -22,11 +28,24 @@ func main() {
 		}
 	}(file)
 
-	vm, err := VirtualMachine.LoadDebugger(file)
+	game, err := VirtualMachine.Load(file)
 	if err != nil {
 		panic(err)
 	}
 
+	addresses := gamestate.Challenge
+	if *descriptor != "" {
+		addresses, err = gamestate.LoadDescriptor(*descriptor)
+		if err != nil {
+			panic(err)
+		}
+	}
+	gamestate.Install(game, addresses)
+
+	// memdiff and memsearch compare the live memory with saved states and search it.
+	memdiff.Install(game)
+	vm := VirtualMachine.NewDebugger(game)
+
 	err = vm.Run()
 
 	if err != nil {
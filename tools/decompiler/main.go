@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ckyong/synacor/decompiler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func main() {
+	entry := flag.Uint("addr", 0, "address of the function to decompile")
+	follow := flag.Bool("follow", false, "also decompile every function it calls")
+	ir := flag.Bool("ir", false, "print the SSA form instead of pseudocode")
+	flag.Parse()
+
+	filePath := filepath.Join("./resources/challenge.bin")
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			fmt.Printf("Could not close file: %v", err)
+		}
+	}(file)
+
+	vm, err := VirtualMachine.Load(file)
+	if err != nil {
+		panic(err)
+	}
+
+	memory := vm.DumpMemory()
+	d := decompiler.New(memory[:])
+
+	pending := []uint16{uint16(*entry)}
+	seen := map[uint16]bool{}
+	for len(pending) > 0 {
+		address := pending[0]
+		pending = pending[1:]
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		fn, err := d.Lift(address)
+		if err != nil {
+			fmt.Printf("// %v: %v\n\n", decompiler.FunctionName(address), err)
+			continue
+		}
+
+		if *ir {
+			fmt.Printf("%v:\n%v\n", decompiler.FunctionName(address), fn.IR())
+		} else {
+			fmt.Println(fn.Pseudocode())
+		}
+
+		if *follow {
+			pending = append(pending, fn.Calls()...)
+		}
+	}
+}
@@ -1,16 +1,37 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/ckyong/synacor/vm"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
+
+	"github.com/ckyong/synacor/analysis"
+	"github.com/ckyong/synacor/transcript"
+	"github.com/ckyong/synacor/vm"
 )
 
+// Prints a listing of memory, as the program is loaded or as a transcript or saved state and -steps more instructions
+// leave it, so that code the program decrypts or patches at runtime is listed the way it runs. -image writes that
+// memory to a file -program can load again. With -codemap every line says whether the program executed or wrote it on
+// the way, and every self-modification is printed to stderr. With -analyze every instruction of the functions found in
+// memory is annotated with what the data-flow analysis knows about the registers it reads, and -json writes the whole
+// analysis to a file.
 func main() {
-	filePath := filepath.Join("./resources/challenge.bin")
+	programPath := flag.String("program", "./resources/challenge.bin", "program to disassemble")
+	prefixPath := flag.String("transcript", "", "transcript to play before disassembling")
+	statePath := flag.String("state", "", "state saved with save state to disassemble instead")
+	steps := flag.Int("steps", 0, "instructions to run before disassembling, stopping early when the program wants input")
+	imagePath := flag.String("image", "", "file to write memory to as a program")
+	tracked := flag.Bool("codemap", false, "annotate the listing with what the program executed and wrote")
+	annotate := flag.Bool("analyze", false, "annotate the listing with the data-flow analysis")
+	jsonPath := flag.String("json", "", "file to write the data-flow analysis to as JSON")
+	flag.Parse()
 
-	file, err := os.Open(filePath)
+	file, err := os.Open(*programPath)
 	if err != nil {
 		panic(err)
 	}
@@ -23,83 +44,131 @@ func main() {
 	}(file)
 
 	vm, err := VirtualMachine.Load(file)
+	if err != nil {
+		panic(err)
+	}
+	var codeMap *VirtualMachine.CodeMap
+	if *tracked {
+		codeMap = &VirtualMachine.CodeMap{OnModification: func(modification VirtualMachine.SelfModification) {
+			fmt.Fprintln(os.Stderr, modification)
+		}}
+		vm.TrackCode(codeMap)
+	}
+	if *prefixPath != "" {
+		prefix, err := transcript.Load(*prefixPath)
+		if err != nil {
+			panic(err)
+		}
+		if err := transcript.NewPlayer(vm, prefix, io.Discard).Play(vm); err != nil {
+			panic(err)
+		}
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			panic(err)
+		}
+	}
+	vm.SetIO(strings.NewReader(""), io.Discard)
+	for i := 0; i < *steps; i++ {
+		halted, err := vm.Step()
+		if errors.Is(err, io.EOF) || halted {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	opArgs := map[uint16]uint16{
-		0:  0,
-		1:  2,
-		2:  1,
-		3:  1,
-		4:  3,
-		5:  3,
-		6:  1,
-		7:  2,
-		8:  2,
-		9:  3,
-		10: 3,
-		11: 3,
-		12: 3,
-		13: 3,
-		14: 2,
-		15: 2,
-		16: 2,
-		17: 1,
-		18: 0,
-		19: 1,
-		20: 1,
-		21: 0,
+	if *imagePath != "" {
+		image, err := os.Create(*imagePath)
+		if err != nil {
+			panic(err)
+		}
+		err = vm.WriteImage(image)
+		if closeErr := image.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	opName := map[uint16]string{
-		0:  "halt",
-		1:  "set",
-		2:  "push",
-		3:  "pop",
-		4:  "eq",
-		5:  "gt",
-		6:  "jmp",
-		7:  "jt",
-		8:  "jf",
-		9:  "add",
-		10: "mult",
-		11: "mod",
-		12: "and",
-		13: "or",
-		14: "not",
-		15: "rmem",
-		16: "wmem",
-		17: "call",
-		18: "ret",
-		19: "out",
-		20: "in",
-		21: "noop",
+	memory := vm.DumpMemory()
+	var notes map[uint16]string
+	if *annotate || *jsonPath != "" {
+		program := analysis.Analyze(memory[:], analysis.Entries(memory[:])...)
+		if *annotate {
+			notes = program.Notes()
+		}
+		if *jsonPath != "" {
+			encoded, err := json.MarshalIndent(program, "", "  ")
+			if err != nil {
+				panic(err)
+			}
+			if err := os.WriteFile(*jsonPath, encoded, 0644); err != nil {
+				panic(err)
+			}
+		}
 	}
 
-	for {
-		if int(vm.Index) == len(vm.Memory) {
+	disassemble(memory[:], func(address uint16, length uint16) string {
+		var parts []string
+		if codeMap != nil {
+			executed, written := false, false
+			for i := address; i < address+length; i++ {
+				executed, written = executed || codeMap.Executed(i), written || codeMap.Written(i)
+			}
+			switch {
+			case executed && written:
+				parts = append(parts, "executed and written")
+			case executed:
+				parts = append(parts, "executed")
+			case written:
+				parts = append(parts, "written")
+			}
+		}
+		if note, ok := notes[address]; ok {
+			parts = append(parts, note)
+		}
+		return strings.Join(parts, "; ")
+	}, os.Stdout)
+}
+
+// Prints every instruction in memory on its own line. Words that are not an operation, and instructions whose operands
+// would run past the end of memory, are printed as plain values. Lines that note, if given, has something to say
+// about get it as a comment. It is passed the address and the number of words of the line.
+func disassemble(memory []uint16, note func(address uint16, length uint16) string, output io.Writer) {
+	comment := func(index int, length int) {
+		if note == nil {
 			return
 		}
+		if text := note(uint16(index), uint16(length)); text != "" {
+			fmt.Fprintf(output, " ; %v", text)
+		}
+	}
 
-		op := vm.Memory[vm.Index]
+	for index := 0; index < len(memory); {
+		op := memory[index]
+		args, ok := VirtualMachine.OpArgs[op]
 
-		if op > 21 {
-			fmt.Printf("%v: %v\n", vm.Index, op)
-			vm.Index++
+		if !ok || index+int(args) >= len(memory) {
+			fmt.Fprintf(output, "%v: %v", index, op)
+			comment(index, 1)
+			fmt.Fprintln(output)
+			index++
 			continue
 		}
 
-		fmt.Printf("%v: %v ", vm.Index, opName[op])
+		fmt.Fprintf(output, "%v: %v ", index, VirtualMachine.OpNames[op])
 
-		var operands []uint16
-		if opArgs[op] > 0 {
-			operands = vm.Memory[vm.Index+1 : vm.Index+opArgs[op]+1]
-
-			for i := uint16(0); i < opArgs[op]; i++ {
-				fmt.Printf("%v ", operands[i])
-			}
+		operands := memory[index+1 : index+int(args)+1]
+		for _, operand := range operands {
+			fmt.Fprintf(output, "%v ", operand)
 		}
+		comment(index, int(args)+1)
 
-		fmt.Println()
+		fmt.Fprintln(output)
 
-		vm.Index += opArgs[op] + 1
+		index += int(args) + 1
 	}
 }
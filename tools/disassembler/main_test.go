@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/ckyong/synacor/vm"
+)
+
+// Disassembles random memory images. Every word has to end up in exactly one line of the listing.
+func FuzzDisassemble(f *testing.F) {
+	f.Add([]byte{9, 0, 0, 128, 1, 128, 2, 0, 0, 0})
+	f.Add([]byte{22, 0, 19, 0})
+
+	f.Fuzz(func(t *testing.T, image []byte) {
+		memory := make([]uint16, len(image)/2)
+		for i := range memory {
+			memory[i] = binary.LittleEndian.Uint16(image[2*i:])
+		}
+
+		listing := bytes.Buffer{}
+		disassemble(memory, nil, &listing)
+
+		expected := 0
+		scanner := bufio.NewScanner(&listing)
+		for scanner.Scan() {
+			var index int
+			if _, err := fmt.Sscanf(scanner.Text(), "%d:", &index); err != nil {
+				t.Fatalf("unexpected line %q: %v", scanner.Text(), err)
+			}
+			if index != expected {
+				t.Fatalf("expected a line for %v, got %q", expected, scanner.Text())
+			}
+
+			op := memory[index]
+			if length, ok := VirtualMachine.OpArgs[op]; ok && index+int(length) < len(memory) {
+				expected += int(length) + 1
+			} else {
+				expected++
+			}
+		}
+		if expected != len(memory) {
+			t.Errorf("the listing stops at %v of %v words", expected, len(memory))
+		}
+	})
+}
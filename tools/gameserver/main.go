@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ckyong/synacor/gameserver"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Hosts the game on a TCP port, a session of its own for every connection:
+//
+//	gameserver -address 127.0.0.1:2323 -idle 10m
+//	nc 127.0.0.1 2323
+//
+// Pressing enter here lists the sessions being played.
+func main() {
+	address := flag.String("address", "127.0.0.1:2323", "address to listen on")
+	programPath := flag.String("program", "./resources/challenge.bin", "program to host")
+	statePath := flag.String("state", "", "state saved with save state for every session to start from instead")
+	budget := flag.Uint64("budget", 2_000_000_000, "instructions a session can execute, 0 for no limit")
+	idle := flag.Duration("idle", 15*time.Minute, "how long a session can wait for input, 0 for no limit")
+	slots := flag.Int("slots", 10, "save slots for every session, 0 for no limit")
+	flag.Parse()
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	server := gameserver.NewServer(vm, gameserver.Config{Budget: *budget, IdleTimeout: *idle, Slots: *slots})
+	server.OnSession = func(info gameserver.SessionInfo, ended bool, reason error) {
+		switch {
+		case !ended:
+			log.Printf("session %v from %v started", info.ID, info.Remote)
+		case reason != nil:
+			log.Printf("session %v ended after %v instructions: %v", info.ID, info.Steps, reason)
+		default:
+			log.Printf("session %v ended after %v instructions", info.ID, info.Steps)
+		}
+	}
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %v", listener.Addr())
+	go func() {
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			sessions := server.Sessions()
+			fmt.Printf("%v sessions\n", len(sessions))
+			for _, info := range sessions {
+				fmt.Println(info)
+			}
+		}
+	}()
+	log.Fatal(server.Serve(listener))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+	"github.com/ckyong/synacor/world"
+)
+
+// Maps every room that can be walked to from where the game starts, or from where a transcript or saved state leaves
+// it, and writes the map as JSON and DOT. With -to it also writes the shortest route between two rooms as a
+// transcript, which starts with the prefix transcript when the route starts where the exploration did.
+func main() {
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	prefixPath := flag.String("transcript", "", "transcript to play before exploring")
+	statePath := flag.String("state", "", "state saved with save state to explore from instead")
+	roomAddress := flag.Uint("room", uint(gamestate.Challenge.Room), "address of the word that holds the current room")
+	budget := flag.Uint64("budget", 10_000_000, "instructions a move may take before it is given up on")
+	jsonPath := flag.String("json", "map.json", "write the map as JSON to this file")
+	dotPath := flag.String("dot", "map.dot", "write the map as a Graphviz graph to this file")
+	from := flag.Uint("from", 0, "room the route starts in, the room the exploration started in by default")
+	to := flag.Uint("to", 0, "room the route leads to")
+	routePath := flag.String("route", "route.txt", "write the route to this transcript")
+	flag.Parse()
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+
+	var prefix []transcript.Entry
+	if *prefixPath != "" {
+		if prefix, err = transcript.Load(*prefixPath); err != nil {
+			fail(err)
+		}
+	}
+	if err := transcript.NewPlayer(vm, prefix, io.Discard).Play(vm); err != nil {
+		fail(err)
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			fail(err)
+		}
+	}
+
+	worldMap, err := world.Explore(vm, uint16(*roomAddress), *budget)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Found %v rooms\n", len(worldMap.Rooms))
+
+	data, err := json.MarshalIndent(worldMap, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(*jsonPath, data, 0644); err != nil {
+		fail(err)
+	}
+	if err := writeDot(worldMap, *dotPath); err != nil {
+		fail(err)
+	}
+
+	if *to == 0 {
+		return
+	}
+	start := uint16(*from)
+	if start == 0 {
+		start = worldMap.Start
+	}
+	path, ok := worldMap.Path(start, uint16(*to))
+	if !ok {
+		fail(fmt.Errorf("there is no way from room %v to room %v", start, *to))
+	}
+
+	var route []transcript.Entry
+	if start == worldMap.Start && *statePath == "" {
+		route = append(route, prefix...)
+	}
+	route = append(route, worldMap.Route(path)...)
+
+	text := strings.Builder{}
+	fmt.Fprintf(&text, "# Route from room %v to room %v, written by tools/mapper.\n", start, *to)
+	for _, entry := range route {
+		fmt.Fprintln(&text, entry)
+	}
+	if err := os.WriteFile(*routePath, []byte(text.String()), 0644); err != nil {
+		fail(err)
+	}
+	fmt.Printf("Wrote a route of %v moves to %v\n", len(path), *routePath)
+}
+
+func writeDot(worldMap *world.Map, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := worldMap.WriteDot(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
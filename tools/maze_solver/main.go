@@ -1,180 +1,148 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
-)
-
-/*
-Illustration of the grid
-  * ─── 8 ─── - ─── 1		3
-  │     │     │     │
-  │     │     │     │
-  4 ─── + ───11 ─── *		2
-  │     │     │     │
-  │     │     │     │
-  + ─── 4 ─── - ───18		1
-  │     │     │     │
-  │     │     │     │
- 22 ─── - ─── 9 ─── *		0
 
-  0		1	  2     3
-Constraints:
-- The weight cannot be lower than 0
-- The weight cannot be higher than 32768
-- If we arrive at 22, the orb needs to be picked up again
-- If we arrive at 1, the orb shatters
-- We need to find the shortest route that allows for this
-*/
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	"github.com/ckyong/synacor/vault"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
 
+// Finds the shortest walk through the vault grid that opens the door and prints it as one compass direction per line,
+// ready to be pasted into a transcript. The grid comes from a grid file, or with -state from the room table of a saved
+// game, or of the game once -transcript has been played.
 func main() {
-	/*
-		We can create a path by determining whether we increase the x coordinate or y coordinate by 1.
-		For the shortest route, we need to have a path that in total increases x by 3, and y by 3 (otherwise we can't reach the end)
-		Generate a base route, evaluate whether it adds up to 30, and if not, permute the steps and try it.
-
-		todo: Is there operator precedence??
-	*/
-
-	grid := [][]string{ // Mirror the grid so we make it a bit easier to use the coordinates.
-		{"22", "-", "9", "*"},
-		{"+", "4", "-", "18"},
-		{"4", "+", "11", "*"},
-		{"*", "8", "-", "1"},
+	gridPath := flag.String("grid", "./tools/maze_solver/vault.txt", "grid file to solve")
+	programPath := flag.String("program", "./resources/challenge.bin", "program to read the grid from with -state or -transcript")
+	statePath := flag.String("state", "", "read the grid from the memory of this saved state")
+	transcriptPath := flag.String("transcript", "", "read the grid from the memory of the game once this transcript is played")
+	descriptorPath := flag.String("descriptor", "", "descriptor file of where the game keeps its rooms and items")
+	start := flag.String("start", "", "row,column of the antechamber, the bottom left room by default")
+	target := flag.String("target", "", "row,column of the door room, the top right room by default")
+	weight := flag.Int("weight", -1, "weight of the orb on the pedestal, the number in the antechamber by default")
+	goal := flag.Int("goal", 30, "weight that opens the door")
+	minimum := flag.Int("min", 0, "lowest weight the orb survives")
+	maximum := flag.Int("max", 32767, "highest weight the orb survives")
+	flag.Parse()
+
+	var puzzle *vault.Puzzle
+	var err error
+	if *statePath != "" || *transcriptPath != "" {
+		puzzle, err = fromGame(*programPath, *statePath, *transcriptPath, *descriptorPath)
+	} else {
+		puzzle, err = fromFile(*gridPath)
+	}
+	if err != nil {
+		fail(err)
 	}
 
-	// base
-	steps := []step{{1, 0}, {1, 0}, {1, 0}, {0, 1}, {0, 1}, {0, 1}, {1, 0}, {-1, 0}, {0, 1}, {0, -1}}
-	// Step in X direction added
-
-	// populate this array with permutations
-	permutations := [][]step{steps}
-	permute(&permutations, steps, len(steps))
-
-	//addedX := false
-	//addedY := false
-
-	cache := map[string]int{}
-
-	//for
-	{
-		for _, route := range permutations {
-			weight := traverse(cache, route, grid)
-			if weight == 30 {
-				fmt.Printf("Found a valid route %v\n", route)
-				os.Exit(0)
-			} else {
-				fmt.Printf("%v: %v\n", route, weight)
-			}
+	if *start != "" {
+		if puzzle.Start, err = parsePosition(*start); err != nil {
+			fail(fmt.Errorf("-start: %w", err))
 		}
-
-		// todo: generate search tree and traverse it
 	}
-}
-
-func permute(permutations *[][]step, steps []step, index int) {
-	// Use Heap's algorithm to generate permutations
-	if index == 1 {
-		*permutations = append(*permutations, clone(steps))
-	} else {
-		permute(permutations, clone(steps), index-1)
-		for i := 0; i < index-1; i++ {
-			var swapped []step
-			if index%2 == 0 { // even
-				swapped = swap(clone(steps), i, index-1)
-			} else {
-				clone(steps)
-				swapped = swap(clone(steps), 0, index-1)
-			}
-			permute(permutations, swapped, index-1)
+	if *target != "" {
+		if puzzle.Target, err = parsePosition(*target); err != nil {
+			fail(fmt.Errorf("-target: %w", err))
 		}
 	}
-}
+	if *weight >= 0 {
+		puzzle.Weight = *weight
+	}
+	// The goal and the bounds only replace those read from the game when they are given.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "goal":
+			puzzle.Goal = *goal
+		case "min":
+			puzzle.Min = *minimum
+		case "max":
+			puzzle.Max = *maximum
+		}
+	})
 
-func clone(array []step) []step {
-	newArray := make([]step, len(array))
-	copy(newArray, array)
-	return newArray
+	fmt.Fprint(os.Stderr, puzzle.Grid)
+	path, err := puzzle.Solve()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Found a walk of %v steps\n", len(path))
+	fmt.Println(strings.Join(path, "\n"))
 }
 
-func swap(array []step, a int, b int) []step {
-	clone := array
-	temp := clone[a]
-	clone[a] = clone[b]
-	clone[b] = temp
-	return clone
-}
+func fromFile(filePath string) (*vault.Puzzle, error) {
+	grid, err := vault.LoadGrid(filePath)
+	if err != nil {
+		return nil, err
+	}
 
-type step struct {
-	x int
-	y int
+	puzzle := &vault.Puzzle{Grid: grid, Goal: 30, Min: 0, Max: 32767}
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("%v has no rooms", filePath)
+	}
+	puzzle.Start = vault.Position{Row: len(grid) - 1, Column: 0}
+	puzzle.Target = vault.Position{Row: 0, Column: len(grid[0]) - 1}
+	puzzle.Weight, _ = strconv.Atoi(grid[puzzle.Start.Row][puzzle.Start.Column])
+	return puzzle, nil
 }
 
-func traverse(cache map[string]int, steps []step, grid [][]string) int {
-	weight := 22
-	operation := ""
-	loc := step{0, 0}
-
-	if val, ok := cache[serialize(steps)]; ok {
-		return val
+func fromGame(programPath string, statePath string, transcriptPath string, descriptorPath string) (*vault.Puzzle, error) {
+	file, err := os.Open(programPath)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, change := range steps {
-		loc.x += change.x
-		loc.y += change.y
-
-		if loc.x < 0 || loc.x > 3 || loc.y < 0 || loc.y > 3 {
-			cache[serialize(steps)] = -1
-			return -1 // out of bounds
-		}
-
-		tile := grid[loc.y][loc.x]
-		if tile == "+" || tile == "-" || tile == "*" {
-			operation = tile
-			continue
-		}
-
-		val, _ := strconv.Atoi(tile)
-
-		switch operation {
-		case "+":
-			weight += val
-			break
-		case "-":
-			weight -= val
-			break
-		case "*":
-			weight *= val
-			break
+	if statePath != "" {
+		if err := vm.LoadState(statePath); err != nil {
+			return nil, err
 		}
-
-		if weight <= 0 || weight > 32768 {
-			// The orb breaks
-			cache[serialize(steps)] = -1
-			return -1
+	} else {
+		entries, err := transcript.Load(transcriptPath)
+		if err != nil {
+			return nil, err
 		}
-
-		if loc.x == 3 && loc.y == 3 {
-			cache[serialize(steps)] = weight
-			return weight // finished
+		if err := transcript.NewPlayer(vm, entries, io.Discard).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+			return nil, err
 		}
+	}
 
-		if loc.x == 0 && loc.y == 0 {
-			cache[serialize(steps)] = -1
-			return -1 // orb shattered
+	descriptor := gamestate.Challenge
+	if descriptorPath != "" {
+		if descriptor, err = gamestate.LoadDescriptor(descriptorPath); err != nil {
+			return nil, err
 		}
 	}
-
-	return weight
+	return vault.FromMemory(gamestate.New(&vm.Memory, descriptor))
 }
 
-func serialize(steps []step) string {
-	result := strings.Builder{}
-	for _, item := range steps {
-		result.WriteByte(byte(item.x))
-		result.WriteByte(byte(item.y))
+func parsePosition(text string) (vault.Position, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 2 {
+		return vault.Position{}, fmt.Errorf("%q is not row,column", text)
 	}
-	return result.String()
+	row, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return vault.Position{}, err
+	}
+	column, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return vault.Position{}, err
+	}
+	return vault.Position{Row: row, Column: column}, nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ckyong/synacor/memdiff"
+)
+
+// Compares the memory of states saved with save state. Given two states it lists the words that changed from the
+// first to the second, with the instructions they are part of or that read and write them:
+//
+//	memdiff before.json after.json
+//
+// With -filters it searches instead, starting from every address of the first state and keeping, between every state
+// and the next, the addresses that pass the next filter. For example, to find a counter that went down and then
+// reached 5:
+//
+//	memdiff -filters decreased,=5 first.json second.json third.json
+//
+// The debugger and replay tools offer the same on the live VM with the memdiff and memsearch commands.
+func main() {
+	filters := flag.String("filters", "", "unchanged, changed, increased, decreased or =value for each state after the first, separated by commas")
+	limit := flag.Int("limit", 50, "candidates to list once the search is done")
+	bare := flag.Bool("bare", false, "leave out the disassembly context")
+	flag.Parse()
+
+	paths := flag.Args()
+	images := make([]memdiff.Image, len(paths))
+	for i, path := range paths {
+		image, err := memdiff.Load(path)
+		if err != nil {
+			fail(err)
+		}
+		images[i] = image
+	}
+	last := len(images) - 1
+	var context *memdiff.Context
+	if !*bare && last >= 0 {
+		context = memdiff.NewContext(&images[last])
+	}
+
+	if *filters == "" {
+		if len(images) != 2 {
+			fail(fmt.Errorf("expected two saved states to compare, got %v", len(images)))
+		}
+		memdiff.WriteChanges(os.Stdout, memdiff.Diff(&images[0], &images[1]), context)
+		return
+	}
+
+	steps := strings.Split(*filters, ",")
+	if len(steps) != last {
+		fail(fmt.Errorf("expected a filter for each of the %v states after the first, got %v", last, len(steps)))
+	}
+	search := memdiff.NewSearch(&images[0])
+	for i, step := range steps {
+		filter, err := memdiff.ParseFilter(strings.TrimSpace(step))
+		if err != nil {
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "%v: %v candidates left\n", step, search.Filter(&images[i+1], filter))
+	}
+	memdiff.WriteCandidates(os.Stdout, search, context, *limit)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
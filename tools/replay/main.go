@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/memdiff"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Replays a session recorded with -record. With -stop the replay ends after that many instructions and the debugger
+// takes over, with the inspect, memdiff and memsearch commands, otherwise the game continues from stdin once the
+// session is done.
+func main() {
+	sessionPath := flag.String("session", "session.json", "session to replay")
+	stop := flag.Uint64("stop", 0, "hand over to the debugger after this many instructions")
+	save := flag.String("save", "", "save the state of the VM to this file when it stops")
+	flag.Parse()
+
+	session, err := VirtualMachine.LoadSession(*sessionPath)
+	if err != nil {
+		fail(err)
+	}
+
+	vm := VirtualMachine.New(nil)
+	if err := vm.Replay(session); err != nil {
+		fail(err)
+	}
+
+	engine := VirtualMachine.NewThreaded(vm)
+	for *stop == 0 || vm.Steps < *stop {
+		halted, err := engine.Step()
+		if halted || errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	if *stop != 0 && vm.Steps == *stop {
+		fmt.Printf("\nStopped after %v instructions at index %v\n", vm.Steps, vm.Index)
+		vm.StopReplay()
+		gamestate.Install(vm, gamestate.Challenge)
+		memdiff.Install(vm)
+		if err := VirtualMachine.NewDebugger(vm).Run(); err != nil && !errors.Is(err, io.EOF) {
+			fail(err)
+		}
+	}
+
+	if *save != "" {
+		if err := vm.SaveState(*save); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ckyong/synacor/bruteforce"
+	"github.com/ckyong/synacor/symbolic"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Runs the program symbolically from where a transcript or saved state leaves it, or from -start, with the registers
+// and words of memory given to -symbols and the characters given to -chars left open, and prints the constraints on
+// them of every path that reaches -target together with values that meet them. For example, to see what the
+// teleporter checks the confirmation function returned:
+//
+//	symbolic -start 5491 -symbols r0 -target 5498
+func main() {
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	prefixPath := flag.String("transcript", "", "transcript to play before running symbolically")
+	statePath := flag.String("state", "", "state saved with save state to run from instead")
+	start := flag.Int("start", -1, "address to start at instead of where the program is")
+	symbols := flag.String("symbols", "", "comma separated registers, r0 to r7, and addresses of words to leave open")
+	input := flag.String("input", "", "text to read before the open characters, with \\n for a new line")
+	chars := flag.Int("chars", 0, "open characters, c0 and on, to read after the input")
+	maximum := flag.Uint("max-char", 127, "largest value of an open character")
+	target := flag.Uint("target", 0, "address to reach")
+	budget := flag.Int("budget", 100_000, "instructions a path may take")
+	maxPaths := flag.Int("paths", 1000, "paths to follow before giving up on the rest")
+	conflicts := flag.Int("conflicts", 100_000, "conflicts the solver may run into before it gives up")
+	flag.Parse()
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+	if *prefixPath != "" {
+		prefix, err := transcript.Load(*prefixPath)
+		if err != nil {
+			fail(err)
+		}
+		if err := transcript.NewPlayer(vm, prefix, io.Discard).Play(vm); err != nil {
+			fail(err)
+		}
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			fail(err)
+		}
+	}
+	if *start >= 0 {
+		vm.Index = uint16(*start)
+	}
+
+	state := symbolic.NewState(vm)
+	if *symbols != "" {
+		for _, name := range strings.Split(*symbols, ",") {
+			location, err := bruteforce.ParseLocation(strings.TrimSpace(name))
+			if err != nil {
+				fail(err)
+			}
+			if location.Register {
+				state.Register[location.Index] = symbolic.Sym(location.String())
+			} else {
+				state.SetWord(location.Index, symbolic.Sym(location.String()))
+			}
+		}
+	}
+
+	executor := symbolic.Executor{
+		Solver:   symbolic.Solver{Maxima: map[string]uint16{}, Conflicts: *conflicts},
+		Budget:   *budget,
+		MaxPaths: *maxPaths,
+	}
+	for _, char := range []byte(strings.ReplaceAll(*input, `\n`, "\n")) {
+		executor.Input = append(executor.Input, symbolic.Const(uint16(char)))
+	}
+	for i := 0; i < *chars; i++ {
+		name := fmt.Sprintf("c%v", i)
+		executor.Input = append(executor.Input, symbolic.Sym(name))
+		executor.Solver.Maxima[name] = uint16(*maximum)
+	}
+
+	paths := executor.Explore(state, uint16(*target))
+	ends := map[symbolic.End]int{}
+	reached := 0
+	for _, path := range paths {
+		ends[path.End]++
+		if path.End != symbolic.Reached {
+			continue
+		}
+		reached++
+		fmt.Printf("Path %v reaches %v after %v instructions (%v):\n", reached, *target, path.State.Steps, path.Result)
+		for _, constraint := range path.State.Constraints {
+			fmt.Printf("  %v\n", constraint)
+		}
+		names := make([]string, 0, len(path.Model))
+		for name := range path.Model {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  with %v = %v\n", name, path.Model[name])
+		}
+	}
+
+	fmt.Printf("Followed %v paths:", len(paths))
+	for _, end := range []symbolic.End{symbolic.Reached, symbolic.Halted, symbolic.TooLong, symbolic.NoInput, symbolic.Jump, symbolic.Address, symbolic.Code, symbolic.Fault} {
+		if ends[end] > 0 {
+			fmt.Printf(" %v %v", ends[end], end)
+		}
+	}
+	fmt.Println()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
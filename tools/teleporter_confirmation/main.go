@@ -79,46 +79,91 @@ f(3,b) = f(3, b - 1)(c + 1) + (2c + 1) // Add this value to the array, plug it i
 f(4,1) = f(3, f(3,c)) // After adding f(3,b) to the array, check if this calculated value equals 6
 ```
 This was not much faster than just replacing f2 as the more efficient function. Rough runtime was (~6 seconds)
+
+The closed forms only hold for this binary, so the tool now evaluates the recursion itself with the row tables of
+hooks.ConfirmationTable, which needs no induction, for every r7 on all cores. The arguments and the expected result are
+read from the call site instead of being written down here.
 */
 
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"time"
+
+	"github.com/ckyong/synacor/teleporter"
+	VirtualMachine "github.com/ckyong/synacor/vm"
 )
 
+// Finds the call of the teleporter confirmation in the program and prints every value of r7 that makes it return the
+// result the caller expects.
 func main() {
-	start := time.Now()
-	// Start with c = 1, as 0 is already the default teleporter state
-	cache := make([]uint16, 32768)
-	for c := uint16(1); c < 32768; c++ {
-		// Add f(3,0) = f(2,c) as the base case
-		cache[0] = f2(c, c)
-
-		// f(4,1) = f(3, f(3,c))
-		// calculate f(3,b) for every value of b
-		for b := uint16(1); b < 32768; b++ {
-			// f(3,b) = f(3, b - 1)(c + 1) + (2c + 1)
-			cache[b] = (cache[b-1]*(c+1) + 2*c + 1) % 32768
-		}
+	programPath := flag.String("program", "./resources/challenge.bin", "program to search")
+	address := flag.Uint("site", 0, "address of the call to use when the program has more than one")
+	modulus := flag.Int("modulus", 32768, "modulus of the arithmetic of the confirmation function, from 1 to 32768")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of values of r7 to evaluate at the same time")
+	budget := flag.Int("budget", 10_000_000, "instructions the guest code may take to confirm small arguments")
+	flag.Parse()
 
-		// f(4,1) = f(3, f(3,c))
-		// The result is the f(3,c)-th spot
-		result := cache[cache[c]]
+	if *modulus < 1 || *modulus > 32768 {
+		fail(fmt.Errorf("the modulus has to be from 1 to 32768, not %v", *modulus))
+	}
 
-		fmt.Printf("(4, 1, %v) = %v\n", c, result)
-		if result == 6 {
-			fmt.Printf("Register 7: %v.\n", c)
-			break
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+	memory := vm.DumpMemory()
+
+	// Only keep the calls of functions that compute the same as the confirmation function for small arguments.
+	var sites []teleporter.CallSite
+	for _, candidate := range teleporter.FindCallSites(memory[:]) {
+		if *address != 0 && uint(candidate.Address) != *address {
+			continue
+		}
+		if err := teleporter.Verify(memory[:], candidate, *budget); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v: %v\n", candidate, err)
+			continue
 		}
+		sites = append(sites, candidate)
+	}
+	if len(sites) == 0 {
+		fail(fmt.Errorf("there is no call of the confirmation function that sets r0 and r1 and checks r0 afterwards"))
+	}
+	if len(sites) > 1 {
+		for _, site := range sites {
+			fmt.Fprintln(os.Stderr, site)
+		}
+		fail(fmt.Errorf("found %v calls of the confirmation function, pick one with -site", len(sites)))
+	}
+	site := sites[0]
+	fmt.Println("Found", site)
+
+	start := time.Now()
+	last := *modulus - 1
+	// r7 = 0 is the default teleporter state, which skips the confirmation.
+	matches := teleporter.Search(site, *modulus, 1, uint16(last), *workers, func(done int) {
+		if done%4096 == 0 {
+			fmt.Fprintf(os.Stderr, "\r%v of %v", done, last)
+		}
+	})
+	fmt.Fprintln(os.Stderr)
+
+	for _, match := range matches {
+		fmt.Printf("r7 = %v\n", match)
 	}
-	fmt.Printf("Finished in %s.", time.Since(start))
-	os.Exit(0)
+	fmt.Printf("Found %v of %v values of r7 in %v with %v workers\n", len(matches), last, time.Since(start), *workers)
 }
 
-// f(2,b) = (2c + 1) + b * (c + 1)
-func f2(b uint16, c uint16) uint16 {
-	return (2*c + 1 + b*(c+1)) % 32768
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/memdiff"
+	"github.com/ckyong/synacor/tui"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Plays the game in a full-screen terminal UI that shows the registers, the stack, the code around the program counter
+// and memory next to the game. The VM starts paused: F5 or ctrl-p runs it, F10 or ctrl-n steps one instruction and F9
+// or ctrl-b sets a breakpoint on the instruction marked in the code pane. Lines starting with a colon are for the TUI:
+//
+//	:b 5451    toggles a breakpoint at 5451
+//	:d 5445    shows the code from 5445
+//	:m 2732    shows memory from 2732
+//
+// The usual commands, such as save state, inspect and memdiff, can be typed as lines for the game.
+func main() {
+	programPath := flag.String("program", "./resources/challenge.bin", "program to run")
+	statePath := flag.String("state", "", "state saved with save state to start from instead")
+	flag.Parse()
+
+	file, err := os.Open(*programPath)
+	if err != nil {
+		fail(err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+	if *statePath != "" {
+		if err := vm.LoadState(*statePath); err != nil {
+			fail(err)
+		}
+	}
+	gamestate.Install(vm, gamestate.Challenge)
+	memdiff.Install(vm)
+
+	if err := tui.NewApp(vm).Run(os.Stdin); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
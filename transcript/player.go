@@ -0,0 +1,130 @@
+package transcript
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+type ExpectationError struct {
+	Line     int
+	Expected string
+	// What the game printed since the previous command.
+	Output string
+}
+
+func (err *ExpectationError) Error() string {
+	return fmt.Sprintf("line %v: expected %q in the output since the last command, got %q", err.Line, err.Expected, err.Output)
+}
+
+// Player is the terminal of a VM that plays a transcript. The game reads the next command from it whenever it asks for
+// input, which is also when the expectations and meta-commands before that command are checked and run.
+type Player struct {
+	vm      *VirtualMachine.VirtualMachine
+	entries []Entry
+	next    int
+	output  io.Writer
+	// Output since the last command was sent.
+	recent strings.Builder
+	// Part of a command that did not fit in the buffer passed to Read.
+	pending string
+	// Interactive is read from once the transcript is done. If it is nil the game runs out of input instead.
+	Interactive io.Reader
+}
+
+// NewPlayer connects a Player for entries to vm. The game output, with the commands from the transcript echoed as if
+// they were typed, goes to output.
+func NewPlayer(vm *VirtualMachine.VirtualMachine, entries []Entry, output io.Writer) *Player {
+	player := &Player{vm: vm, entries: entries, output: output}
+	vm.SetIO(player, player)
+	return player
+}
+
+func (player *Player) Write(data []byte) (int, error) {
+	player.recent.Write(data)
+	return player.output.Write(data)
+}
+
+func (player *Player) Read(buffer []byte) (int, error) {
+	if player.pending != "" {
+		n := copy(buffer, player.pending)
+		player.pending = player.pending[n:]
+		return n, nil
+	}
+
+	for player.next < len(player.entries) {
+		entry := player.entries[player.next]
+		player.next++
+
+		if entry.Kind == Command {
+			fmt.Fprintln(player.output, entry.Text)
+			player.recent.Reset()
+
+			line := entry.Text + "\n"
+			n := copy(buffer, line)
+			player.pending = line[n:]
+			return n, nil
+		}
+
+		if err := player.run(entry); err != nil {
+			return 0, err
+		}
+	}
+
+	if player.Interactive == nil {
+		return 0, io.EOF
+	}
+	player.recent.Reset()
+	return player.Interactive.Read(buffer)
+}
+
+// Runs an entry other than a command.
+func (player *Player) run(entry Entry) error {
+	switch entry.Kind {
+	case Expect:
+		if !strings.Contains(player.recent.String(), entry.Text) {
+			return &ExpectationError{Line: entry.Line, Expected: entry.Text, Output: player.recent.String()}
+		}
+	case Save:
+		if err := player.vm.SaveState(entry.Text); err != nil {
+			return fmt.Errorf("line %v: %w", entry.Line, err)
+		}
+	case SetRegister:
+		player.vm.Register[entry.Register] = entry.Values[0]
+		player.vm.RecordCommand(entry.String())
+	case Patch:
+		player.vm.Patch(entry.Address, entry.Values)
+		player.vm.RecordCommand(entry.String())
+	}
+	return nil
+}
+
+// Play executes the game with engine until it halts or runs out of input, both of which count as finishing.
+func (player *Player) Play(engine VirtualMachine.Stepper) error {
+	for {
+		halted, err := engine.Step()
+		if halted || errors.Is(err, io.EOF) {
+			return player.finish()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Checks the entries left once the game has stopped reading input, of which only expectations can still be met.
+func (player *Player) finish() error {
+	for ; player.next < len(player.entries); player.next++ {
+		entry := player.entries[player.next]
+		if entry.Kind != Expect {
+			return fmt.Errorf("line %v: the game ended before this line", entry.Line)
+		}
+		if err := player.run(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package transcript
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/codes"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the playthrough tests")
+
+// Transcripts played against challenge.bin. The output of each is compared to testdata/<name>.golden and the codes it
+// printed, with the step they were printed at and the room they belong to, to testdata/<name>.codes.
+var playthroughs = []struct {
+	name       string
+	transcript string
+}{
+	{"autopath", "../tools/autoplay/autopath.txt"},
+}
+
+func TestPlaythroughs(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	program, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := program.DumpMemory()
+
+	for _, playthrough := range playthroughs {
+		t.Run(playthrough.name, func(t *testing.T) {
+			entries, err := Load(playthrough.transcript)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vm := VirtualMachine.New(memory[:])
+			output := strings.Builder{}
+			detector := &codes.Detector{}
+			vm.AddObserver(detector)
+			if err := NewPlayer(vm, entries, &output).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+				t.Fatal(err)
+			}
+
+			found := strings.Builder{}
+			if err := detector.Write(&found); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", playthrough.name)
+			compareGolden(t, golden+".golden", output.String())
+			compareGolden(t, golden+".codes", found.String())
+		})
+	}
+}
+
+func compareGolden(t *testing.T, path string, actual string) {
+	if *update {
+		if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the test with -update to create it", err)
+	}
+	if string(expected) != actual {
+		t.Errorf("%v differs, run the test with -update if this is expected:\n%v", path, diff(string(expected), actual))
+	}
+}
+
+// Returns the lines that differ between expected and actual, marked - and + like a unified diff, with two lines of
+// context around every change.
+func diff(expected string, actual string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+
+	// lengths[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		mark byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lengths[i+1][j] >= lengths[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	result := strings.Builder{}
+	lastShown := -1
+	for k, l := range lines {
+		near := false
+		for c := k - 2; c <= k+2; c++ {
+			if c >= 0 && c < len(lines) && lines[c].mark != ' ' {
+				near = true
+			}
+		}
+		if !near {
+			continue
+		}
+		if lastShown >= 0 && k > lastShown+1 {
+			result.WriteString("...\n")
+		}
+		fmt.Fprintf(&result, "%c %v\n", l.mark, l.text)
+		lastShown = k
+	}
+	return result.String()
+}
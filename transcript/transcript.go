@@ -0,0 +1,169 @@
+// Package transcript plays scripted command transcripts against the game running in a VirtualMachine.
+//
+// A transcript holds one entry per line. Blank lines and lines starting with # are skipped. expect "<text>" checks that
+// the game printed text since the previous command was sent, with text quoted like a Go string. Lines starting with !
+// are meta-commands, which act on the VM itself while the game waits for input:
+//
+//	!save <file>                  writes a snapshot of the VM to file
+//	!set <register> <value>       sets one of r0 to r7
+//	!patch <address> <value>...   writes the values to Memory, starting at address
+//
+// Every other line is sent to the game as a command.
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Command Kind = iota
+	Expect
+	Save
+	SetRegister
+	Patch
+)
+
+type Entry struct {
+	// Line number in the transcript, starting at 1.
+	Line int
+	Kind Kind
+	// The command, the expected text or the file to save to.
+	Text     string
+	Register uint16
+	Address  uint16
+	Values   []uint16
+}
+
+// String returns the entry the way it is written in a transcript.
+func (entry Entry) String() string {
+	switch entry.Kind {
+	case Expect:
+		return "expect " + strconv.Quote(entry.Text)
+	case Save:
+		return "!save " + entry.Text
+	case SetRegister:
+		return fmt.Sprintf("!set r%v %v", entry.Register, entry.Values[0])
+	case Patch:
+		text := fmt.Sprintf("!patch %v", entry.Address)
+		for _, value := range entry.Values {
+			text += fmt.Sprintf(" %v", value)
+		}
+		return text
+	}
+	return entry.Text
+}
+
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("line %v: %v", err.Line, err.Message)
+}
+
+// Load parses the transcript at filePath.
+func Load(filePath string) ([]Entry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Parse reads a transcript, one entry per line.
+func Parse(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		entry, err := parseEntry(text)
+		if err != nil {
+			return nil, &SyntaxError{Line: line, Message: err.Error()}
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseEntry(text string) (Entry, error) {
+	if strings.HasPrefix(text, "expect ") {
+		expected, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(text, "expect ")))
+		if err != nil {
+			return Entry{}, fmt.Errorf("expect needs a quoted string")
+		}
+		return Entry{Kind: Expect, Text: expected}, nil
+	}
+
+	if !strings.HasPrefix(text, "!") {
+		return Entry{Kind: Command, Text: text}, nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(text, "!"))
+	if len(fields) == 0 {
+		return Entry{}, fmt.Errorf("missing meta-command after !")
+	}
+
+	switch fields[0] {
+	case "save":
+		if len(fields) != 2 {
+			return Entry{}, fmt.Errorf("save takes a file")
+		}
+		return Entry{Kind: Save, Text: fields[1]}, nil
+	case "set":
+		if len(fields) != 3 {
+			return Entry{}, fmt.Errorf("set takes a register and a value")
+		}
+		register := strings.ToLower(fields[1])
+		if len(register) != 2 || register[0] != 'r' || register[1] < '0' || register[1] > '7' {
+			return Entry{}, fmt.Errorf("unknown register %v", fields[1])
+		}
+		values, err := parseValues(fields[2:])
+		if err != nil {
+			return Entry{}, err
+		}
+		return Entry{Kind: SetRegister, Register: uint16(register[1] - '0'), Values: values}, nil
+	case "patch":
+		if len(fields) < 3 {
+			return Entry{}, fmt.Errorf("patch takes an address and at least one value")
+		}
+		values, err := parseValues(fields[1:])
+		if err != nil {
+			return Entry{}, err
+		}
+		if int(values[0])+len(values)-1 > 32768 {
+			return Entry{}, fmt.Errorf("patch runs past the end of memory")
+		}
+		return Entry{Kind: Patch, Address: values[0], Values: values[1:]}, nil
+	}
+	return Entry{}, fmt.Errorf("unknown meta-command %v", fields[0])
+}
+
+// Parses 15-bit numbers, in decimal or with a 0x prefix.
+func parseValues(fields []string) ([]uint16, error) {
+	values := make([]uint16, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 0, 16)
+		if err != nil || value > 32767 {
+			return nil, fmt.Errorf("invalid value %v", field)
+		}
+		values[i] = uint16(value)
+	}
+	return values, nil
+}
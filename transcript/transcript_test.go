@@ -0,0 +1,192 @@
+package transcript
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(`# comment
+take tablet
+expect "Taken.\n"
+
+!save state.json
+!set R7 0x6486
+!patch 5489 21 21
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Line: 2, Kind: Command, Text: "take tablet"},
+		{Line: 3, Kind: Expect, Text: "Taken.\n"},
+		{Line: 5, Kind: Save, Text: "state.json"},
+		{Line: 6, Kind: SetRegister, Register: 7, Values: []uint16{25734}},
+		{Line: 7, Kind: Patch, Address: 5489, Values: []uint16{21, 21}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, got %v", expected, entries)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"expect Taken.",
+		"!",
+		"!save",
+		"!set r8 1",
+		"!set r0 32768",
+		"!patch 32767 1 2",
+		"!jump 5",
+	} {
+		var syntaxError *SyntaxError
+		if _, err := Parse(strings.NewReader("look\n" + text)); !errors.As(err, &syntaxError) || syntaxError.Line != 2 {
+			t.Errorf("%v: expected a SyntaxError on line 2, got %v", text, err)
+		}
+	}
+}
+
+// Prints a prompt and echoes every line it reads, with the first character replaced by the value of r7.
+var echo = assembler.MustAssemble(`
+	prompt: out '>'
+	in r0
+	out r7
+	loop: in r0
+	out r0
+	eq r1 r0 10
+	jf r1 loop
+	jmp prompt`)
+
+func play(t *testing.T, text string) (*VirtualMachine.VirtualMachine, string, error) {
+	entries, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := VirtualMachine.New(echo)
+	vm.Register[7] = '-'
+	output := strings.Builder{}
+	err = NewPlayer(vm, entries, &output).Play(vm)
+	return vm, output.String(), err
+}
+
+func TestPlayer(t *testing.T) {
+	vm, output, err := play(t, `
+expect ">"
+hello
+expect "-ello"
+!set r7 74
+!patch 100 1 2 3
+jello
+expect "Jello\n>"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := ">hello\n-ello\n>jello\nJello\n>"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+	if vm.Memory.Get(100) != 1 || vm.Memory.Get(102) != 3 {
+		t.Errorf("expected the patch in memory, got %v", []uint16{vm.Memory.Get(100), vm.Memory.Get(101), vm.Memory.Get(102)})
+	}
+}
+
+func TestPlayerFailedExpectation(t *testing.T) {
+	_, _, err := play(t, `
+one
+expect "ne"
+two
+expect "ne"
+three`)
+
+	var expectation *ExpectationError
+	if !errors.As(err, &expectation) {
+		t.Fatalf("expected an ExpectationError, got %v", err)
+	}
+	if expectation.Line != 5 || expectation.Output != "-wo\n>" {
+		t.Errorf("expected line 5 to fail on %q, got %v", "-wo\n>", expectation)
+	}
+}
+
+func TestPlayerInteractive(t *testing.T) {
+	entries, err := Parse(strings.NewReader("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := VirtualMachine.New(echo)
+	output := strings.Builder{}
+	player := NewPlayer(vm, entries, &output)
+	player.Interactive = strings.NewReader("two\n")
+	if err := player.Play(vm); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := ">one\n\x00ne\n>\x00wo\n>"; output.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, output.String())
+	}
+}
+
+func TestPlayerPatchesCode(t *testing.T) {
+	// Changes the prompt the echo program prints.
+	entries, err := Parse(strings.NewReader("one\n!patch 1 35\ntwo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := VirtualMachine.New(echo)
+	codeMap := &VirtualMachine.CodeMap{}
+	vm.TrackCode(codeMap)
+	output := strings.Builder{}
+	if err := NewPlayer(vm, entries, &output).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := ">one\n\x00ne\n>two\n\x00wo\n#"; output.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, output.String())
+	}
+	if !codeMap.Written(1) {
+		t.Error("expected the code map to see the patch")
+	}
+}
+
+func TestPlayerRecordsMetaCommands(t *testing.T) {
+	entries, err := Parse(strings.NewReader("one\n!set r7 74\n!patch 100 5\ntwo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := VirtualMachine.New(echo)
+	recorded := strings.Builder{}
+	player := NewPlayer(vm, entries, &recorded)
+	if err := vm.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if err := player.Play(vm); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := VirtualMachine.New(nil)
+	output := strings.Builder{}
+	replayed.SetIO(strings.NewReader(""), &output)
+	if err := replayed.Replay(vm.StopRecording()); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPlayer(replayed, nil, &output).Play(replayed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The commands themselves were echoed by the first player only.
+	if expected := ">\x00ne\n>Jwo\n>"; output.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, output.String())
+	}
+	if replayed.Memory.Get(100) != 5 || replayed.Register[7] != 74 {
+		t.Errorf("expected the meta-commands to be replayed, got %v in memory and %v in r7", replayed.Memory.Get(100), replayed.Register[7])
+	}
+}
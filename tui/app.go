@@ -0,0 +1,295 @@
+// Package tui runs the VM in a full-screen terminal UI: the game's output and an input line on the left, and the
+// registers, the stack, the disassembly around the program counter and a hex view of memory on the right. The VM can be
+// paused, stepped one instruction at a time and stopped at breakpoints while the game is played. It needs nothing but
+// a terminal and stty.
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ckyong/synacor/decompiler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Lines of game output kept for the output pane.
+const maxOutputLines = 2000
+
+// App is the VM with everything the screen shows about it. Everything in it is guarded by mu, which the runner holds
+// while it runs a batch of instructions, so the VM's output arrives with mu held.
+type App struct {
+	mu     sync.Mutex
+	vm     *VirtualMachine.VirtualMachine
+	runner *VirtualMachine.Runner
+	output *outputLog
+
+	// Shown in the status bar until the next key.
+	message     string
+	breakpoints map[uint16]bool
+	// Set when the VM continues from a breakpoint, so that it executes the instruction there instead of stopping again.
+	resumed bool
+
+	// The disassembly pane shows the instructions from codeTop and marks cursor, which stays on the program counter
+	// while follow is set.
+	cursor  uint16
+	codeTop uint16
+	follow  bool
+	// Address the memory pane starts at.
+	memory uint16
+	// The input line being typed.
+	line []rune
+
+	quit chan struct{}
+}
+
+// NewApp prepares to run vm, which starts paused so that breakpoints can be set first. The game reads the lines typed
+// into the input line and prints to the output pane.
+func NewApp(vm *VirtualMachine.VirtualMachine) *App {
+	app := &App{
+		vm:          vm,
+		output:      &outputLog{},
+		breakpoints: map[uint16]bool{},
+		follow:      true,
+		cursor:      vm.Index,
+		codeTop:     vm.Index,
+		quit:        make(chan struct{}),
+	}
+	app.runner = VirtualMachine.NewRunner(vm, &app.mu, app.output)
+	app.runner.State = VirtualMachine.Paused
+	app.runner.Stop = app.atBreakpoint
+	return app
+}
+
+// Run takes over tty until ctrl-q or ctrl-c is pressed.
+func (app *App) Run(tty *os.File) error {
+	restore, err := rawMode(tty)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// The alternate screen leaves the terminal as it was once the TUI quits.
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[2J")
+	defer fmt.Fprint(tty, "\x1b[?1049l")
+
+	keys := make(chan []string)
+	go func() {
+		buffer := make([]byte, 256)
+		for {
+			read, err := tty.Read(buffer)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buffer[:read])
+		}
+	}()
+	go app.runner.Run(app.quit)
+	defer close(app.quit)
+
+	rows, columns, err := terminalSize(tty)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for ticks := 0; ; ticks++ {
+		select {
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range pressed {
+				if app.Handle(key) {
+					return nil
+				}
+			}
+		case <-ticker.C:
+			// Checking the size runs stty, so only once a second.
+			if ticks%20 == 0 {
+				if newRows, newColumns, err := terminalSize(tty); err == nil && (newRows != rows || newColumns != columns) {
+					rows, columns = newRows, newColumns
+					fmt.Fprint(tty, "\x1b[2J")
+				}
+			}
+		}
+		fmt.Fprint(tty, app.Render(columns, rows))
+	}
+}
+
+// Has the runner pause at a breakpoint, unless the VM is continuing from the one it stopped at. Called with mu held.
+func (app *App) atBreakpoint() bool {
+	if app.breakpoints[app.vm.Index] && !app.resumed {
+		app.follow = true
+		app.message = fmt.Sprintf("breakpoint at %v", app.vm.Index)
+		return true
+	}
+	app.resumed = false
+	return false
+}
+
+// Handle acts on a key, as parseKeys names it, and reports whether the TUI should quit.
+func (app *App) Handle(key string) bool {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.message = ""
+	if app.follow {
+		app.cursor = app.vm.Index
+	}
+
+	switch key {
+	case "ctrl-q", "ctrl-c":
+		return true
+	case "f5", "ctrl-p":
+		switch app.runner.State {
+		case VirtualMachine.Running, VirtualMachine.WaitingForInput:
+			app.runner.State = VirtualMachine.Paused
+		case VirtualMachine.Paused:
+			app.runner.State, app.resumed, app.follow = VirtualMachine.Running, true, true
+			app.runner.Wake()
+		}
+	case "f10", "ctrl-n":
+		runner := app.runner
+		if runner.State == VirtualMachine.Running || runner.State == VirtualMachine.WaitingForInput {
+			runner.State = VirtualMachine.Paused
+		}
+		if runner.State == VirtualMachine.Paused {
+			app.resumed, app.follow = true, true
+			runner.Step()
+			if runner.State == VirtualMachine.WaitingForInput {
+				runner.State, app.message = VirtualMachine.Paused, "the program wants input"
+			}
+		}
+	case "f9", "ctrl-b":
+		app.toggleBreakpoint(app.cursor)
+	case "up":
+		app.cursor, app.follow = previous(&app.vm.Memory, app.cursor), false
+	case "down":
+		app.cursor, app.follow = next(&app.vm.Memory, app.cursor), false
+	case "pgup":
+		app.memory -= uint16(min(int(app.memory), 64))
+	case "pgdn":
+		app.memory = uint16(min(int(app.memory)+64, VirtualMachine.MemorySize-8))
+	case "backspace":
+		if len(app.line) > 0 {
+			app.line = app.line[:len(app.line)-1]
+		}
+	case "enter":
+		line := string(app.line)
+		app.line = nil
+		if strings.HasPrefix(line, ":") {
+			return app.command(line[1:])
+		}
+		app.runner.Input(line + "\n")
+	default:
+		if len([]rune(key)) == 1 {
+			app.line = append(app.line, []rune(key)...)
+		}
+	}
+	return false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (app *App) toggleBreakpoint(address uint16) {
+	if app.breakpoints[address] {
+		delete(app.breakpoints, address)
+		app.message = fmt.Sprintf("removed the breakpoint at %v", address)
+	} else {
+		app.breakpoints[address] = true
+		app.message = fmt.Sprintf("breakpoint at %v", address)
+	}
+}
+
+// Runs a command typed into the input line after a colon, and reports whether it was the one to quit.
+func (app *App) command(text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 1 && fields[0] == "q" {
+		return true
+	}
+	if len(fields) != 2 {
+		app.message = "commands are :b, :m and :d followed by an address, and :q"
+		return false
+	}
+	parsed, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil || parsed >= VirtualMachine.MemorySize {
+		app.message = fmt.Sprintf("%q is not an address", fields[1])
+		return false
+	}
+	address := uint16(parsed)
+	switch fields[0] {
+	case "b":
+		app.toggleBreakpoint(address)
+	case "m":
+		app.memory = address
+	case "d":
+		app.cursor, app.codeTop, app.follow = address, address, false
+	default:
+		app.message = fmt.Sprintf("unknown command :%v", fields[0])
+	}
+	return false
+}
+
+// Returns the address of the instruction after the one at address.
+func next(memory *VirtualMachine.Memory, address uint16) uint16 {
+	if ins, err := decode(memory, address); err == nil && int(ins.Next()) < VirtualMachine.MemorySize {
+		return ins.Next()
+	}
+	if int(address)+1 < VirtualMachine.MemorySize {
+		return address + 1
+	}
+	return address
+}
+
+// Returns the address of an instruction that ends right before address, or the word before it if there is none.
+func previous(memory *VirtualMachine.Memory, address uint16) uint16 {
+	for length := uint16(1); length <= 4 && length <= address; length++ {
+		if ins, err := decode(memory, address-length); err == nil && ins.Next() == address {
+			return address - length
+		}
+	}
+	if address > 0 {
+		return address - 1
+	}
+	return 0
+}
+
+// Decodes the instruction at address, looking at no more of memory than it needs.
+func decode(memory *VirtualMachine.Memory, address uint16) (decompiler.Instruction, error) {
+	words := make([]uint16, 0, 4)
+	for i := 0; i < 4 && int(address)+i < VirtualMachine.MemorySize; i++ {
+		words = append(words, memory.Get(address+uint16(i)))
+	}
+	ins, err := decompiler.Decode(words, 0)
+	ins.Address = address
+	return ins, err
+}
+
+// outputLog keeps the last lines the game printed, and the one it is printing.
+type outputLog struct {
+	lines   []string
+	partial []rune
+}
+
+func (log *outputLog) Write(data []byte) (int, error) {
+	for _, char := range string(data) {
+		if char != '\n' {
+			log.partial = append(log.partial, char)
+			continue
+		}
+		log.lines = append(log.lines, string(log.partial))
+		log.partial = log.partial[:0]
+		if len(log.lines) > maxOutputLines {
+			log.lines = append([]string{}, log.lines[len(log.lines)-maxOutputLines:]...)
+		}
+	}
+	return len(data), nil
+}
@@ -0,0 +1,131 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Greets and then echoes what it reads until the end of a line.
+var echo = assembler.MustAssemble(`
+	out 'h'
+	out 'i'
+	out 10
+loop:
+	in r0
+	out r0
+	eq r1 r0 10
+	jf r1 loop
+	halt
+`)
+
+const loop = 6
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("ab\r\x1b[A\x1b[15~\x10\x7f\x1b[99~é\x1b"))
+	expected := []string{"a", "b", "enter", "up", "f5", "ctrl-p", "backspace", "é", "esc"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %q, got %q", expected, keys)
+	}
+}
+
+func typeLine(app *App, line string) {
+	for _, char := range line {
+		app.Handle(string(char))
+	}
+	app.Handle("enter")
+}
+
+// Waits for the runner to leave the VM in the expected state.
+func waitFor(t *testing.T, app *App, expected VirtualMachine.RunState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		app.mu.Lock()
+		current := app.runner.State
+		app.mu.Unlock()
+		if current == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the VM to be %v, it is %v", expected, current)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRun(t *testing.T) {
+	app := NewApp(VirtualMachine.New(echo))
+	go app.runner.Run(app.quit)
+	defer close(app.quit)
+
+	typeLine(app, ":b 6")
+	app.Handle("f5")
+	waitFor(t, app, VirtualMachine.Paused)
+	if app.vm.Index != loop || app.message != "breakpoint at 6" {
+		t.Fatalf("expected to stop at the breakpoint, stopped at %v with %q", app.vm.Index, app.message)
+	}
+
+	typeLine(app, ":b 6")
+	app.Handle("f5")
+	waitFor(t, app, VirtualMachine.WaitingForInput)
+	typeLine(app, "ok")
+	waitFor(t, app, VirtualMachine.Halted)
+	if output := strings.Join(app.output.lines, "\n"); output != "hi\nok" {
+		t.Errorf("expected the greeting and the line echoed, got %q", output)
+	}
+}
+
+func TestStep(t *testing.T) {
+	app := NewApp(VirtualMachine.New(echo))
+	for i := 0; i < 4; i++ {
+		app.Handle("f10")
+	}
+	if app.vm.Index != loop || app.runner.State != VirtualMachine.Paused || app.message != "the program wants input" {
+		t.Errorf("expected to stop at the input, stopped at %v, %v with %q", app.vm.Index, app.runner.State, app.message)
+	}
+
+	app.Handle("f9")
+	app.Handle("down")
+	app.Handle("f9")
+	if !reflect.DeepEqual(app.breakpoints, map[uint16]bool{loop: true, loop + 2: true}) {
+		t.Errorf("expected breakpoints on the input and the instruction after it, got %v", app.breakpoints)
+	}
+	if app.Handle("ctrl-q") != true {
+		t.Error("expected ctrl-q to quit")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	app := NewApp(VirtualMachine.New(echo))
+	for i := 0; i < 4; i++ {
+		app.Handle("f10")
+	}
+	app.Handle("x")
+	app.Handle("f9")
+
+	lines := app.Frame(100, 30)
+	if len(lines) != 30 {
+		t.Fatalf("expected 30 lines, got %v", len(lines))
+	}
+	for i, line := range lines {
+		if utf8.RuneCountInString(line) != 100 {
+			t.Errorf("expected line %v to be 100 characters wide, got %q", i, line)
+		}
+	}
+	screen := strings.Join(lines, "\n")
+	for _, expected := range []string{"│hi ", "│> x ", "r0 0 ", "pc 6 ", "*> 6: in r0", "   8: out r0", "    0  0013 0068 ", "paused | breakpoint at 6 | F5"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("expected %q in\n%v", expected, screen)
+		}
+	}
+
+	if small := app.Frame(60, 10); !strings.Contains(small[0], "at least 80 by 24") {
+		t.Errorf("expected a small terminal to be refused, got %q", small[0])
+	}
+}
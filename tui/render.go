@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ckyong/synacor/decompiler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+const help = "F5/^P run or pause  F10/^N step  F9/^B breakpoint  Up/Down code  PgUp/PgDn memory  :b :m :d address  ^Q quit"
+
+// Smallest terminal the panes fit in.
+const (
+	minColumns = 80
+	minRows    = 24
+)
+
+// Render returns what to write to a terminal of columns by rows to draw the whole screen, with the cursor left on
+// the input line.
+func (app *App) Render(columns, rows int) string {
+	lines := app.Frame(columns, rows)
+	app.mu.Lock()
+	inputColumn := 4 + len(app.line)
+	app.mu.Unlock()
+
+	frame := strings.Builder{}
+	frame.WriteString("\x1b[?25l\x1b[H")
+	frame.WriteString(strings.Join(lines, "\r\n"))
+	if columns >= minColumns && rows >= minRows && inputColumn < columns*3/5 {
+		// The input line is the middle one of the box at the bottom left.
+		fmt.Fprintf(&frame, "\x1b[%v;%vH\x1b[?25h", rows-2, inputColumn+1)
+	}
+	return frame.String()
+}
+
+// Frame returns the lines of the screen for a terminal of columns by rows.
+func (app *App) Frame(columns, rows int) []string {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if columns < minColumns || rows < minRows {
+		lines := make([]string, rows)
+		for i := range lines {
+			lines[i] = fit("", columns)
+		}
+		lines[0] = fit(fmt.Sprintf("The terminal needs to be at least %v by %v", minColumns, minRows), columns)
+		return lines
+	}
+	if app.follow {
+		app.cursor = app.vm.Index
+	}
+
+	height := rows - 1
+	leftWidth := columns * 3 / 5
+	rightWidth := columns - leftWidth
+
+	left := append(
+		box("Output", app.outputLines(leftWidth-2, height-5), leftWidth, height-3),
+		box("Input", []string{"> " + string(app.line)}, leftWidth, 3)...,
+	)
+
+	code := (height - 11) * 11 / 20
+	right := box("Registers", app.registerLines(), rightWidth, 5)
+	right = append(right, box(fmt.Sprintf("Stack (%v)", app.vm.Stack.Len()), app.stackLines(4), rightWidth, 6)...)
+	right = append(right, box("Code", app.codeLines(code-2), rightWidth, code)...)
+	right = append(right, box("Memory", app.memoryLines(rightWidth-2, height-11-code-2), rightWidth, height-11-code)...)
+
+	lines := make([]string, 0, rows)
+	for i := 0; i < height; i++ {
+		lines = append(lines, left[i]+right[i])
+	}
+
+	status := string(app.runner.State)
+	if app.runner.Err != nil {
+		status += ": " + app.runner.Err.Error()
+	}
+	if app.message != "" {
+		status += " | " + app.message
+	}
+	return append(lines, fit(" "+status+" | "+help, columns))
+}
+
+// Returns text cut or padded with spaces to width characters.
+func fit(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// Returns lines drawn in a box of width by height characters with title in its top border. Lines that do not fit are
+// cut off.
+func box(title string, lines []string, width, height int) []string {
+	inner := width - 2
+	result := []string{"┌" + fit("─"+title+strings.Repeat("─", inner), inner) + "┐"}
+	for i := 0; i < height-2; i++ {
+		line := ""
+		if i < len(lines) {
+			line = lines[i]
+		}
+		result = append(result, "│"+fit(line, inner)+"│")
+	}
+	return append(result, "└"+strings.Repeat("─", inner)+"┘")
+}
+
+// Returns the last height lines of output wrapped to width, ending with the line being printed.
+func (app *App) outputLines(width, height int) []string {
+	lines := app.output.lines
+	if len(app.output.partial) > 0 {
+		lines = append(lines[:len(lines):len(lines)], string(app.output.partial))
+	}
+	var wrapped []string
+	for i := len(lines) - 1; i >= 0 && len(wrapped) < height; i-- {
+		line := []rune(lines[i])
+		parts := []string{}
+		for len(line) > width {
+			parts, line = append(parts, string(line[:width])), line[width:]
+		}
+		wrapped = append(append(parts, string(line)), wrapped...)
+	}
+	if len(wrapped) > height {
+		wrapped = wrapped[len(wrapped)-height:]
+	}
+	return wrapped
+}
+
+func (app *App) registerLines() []string {
+	register := app.vm.Register
+	return []string{
+		fmt.Sprintf("r0 %-6v r1 %-6v r2 %-6v r3 %-6v", register[0], register[1], register[2], register[3]),
+		fmt.Sprintf("r4 %-6v r5 %-6v r6 %-6v r7 %-6v", register[4], register[5], register[6], register[7]),
+		fmt.Sprintf("pc %-6v steps %v", app.vm.Index, app.vm.Steps),
+	}
+}
+
+// Returns up to height values from the top of the stack down.
+func (app *App) stackLines(height int) []string {
+	values := app.vm.Stack.Values()
+	var lines []string
+	for i := len(values) - 1; i >= 0 && len(lines) < height; i-- {
+		lines = append(lines, fmt.Sprintf("%v: %v", len(values)-1-i, values[i]))
+	}
+	return lines
+}
+
+// Returns height instructions from codeTop, moving it so that the cursor is among them. Every line starts with a * for
+// a breakpoint and a > for the program counter, or a - for the cursor when it is not on the program counter.
+func (app *App) codeLines(height int) []string {
+	addresses := func() []uint16 {
+		var addresses []uint16
+		for address := app.codeTop; len(addresses) < height; address = next(&app.vm.Memory, address) {
+			addresses = append(addresses, address)
+			if int(address)+1 >= VirtualMachine.MemorySize {
+				break
+			}
+		}
+		return addresses
+	}
+
+	shown := addresses()
+	visible := false
+	for _, address := range shown[:len(shown)-min(len(shown), 1)] {
+		visible = visible || address == app.cursor
+	}
+	if !visible {
+		// Keep a couple of instructions before the cursor in view.
+		app.codeTop = previous(&app.vm.Memory, previous(&app.vm.Memory, app.cursor))
+		shown = addresses()
+	}
+
+	lines := make([]string, len(shown))
+	for i, address := range shown {
+		marks := []byte("   ")
+		if app.breakpoints[address] {
+			marks[0] = '*'
+		}
+		if address == app.vm.Index {
+			marks[1] = '>'
+		} else if address == app.cursor {
+			marks[1] = '-'
+		}
+		lines[i] = string(marks) + format(&app.vm.Memory, address)
+	}
+	return lines
+}
+
+// Formats the instruction at address with register names, or the word there if it is not an instruction.
+func format(memory *VirtualMachine.Memory, address uint16) string {
+	ins, err := decode(memory, address)
+	if err != nil {
+		return fmt.Sprintf("%v: %v", address, memory.Get(address))
+	}
+	text := ins.String()
+	for _, operand := range ins.Operands {
+		if decompiler.IsRegister(operand) {
+			text = strings.Replace(text, fmt.Sprint(operand), decompiler.RegisterName(operand), 1)
+		}
+	}
+	return text
+}
+
+// Returns height rows of memory from the memory address, as many words to a row as fit in width, each in hex and then
+// as a character.
+func (app *App) memoryLines(width, height int) []string {
+	perRow := (width - 7) / 6
+	if perRow < 1 {
+		perRow = 1
+	}
+	var lines []string
+	for row := 0; row < height; row++ {
+		start := int(app.memory) + row*perRow
+		if start >= VirtualMachine.MemorySize {
+			break
+		}
+		line := strings.Builder{}
+		chars := strings.Builder{}
+		fmt.Fprintf(&line, "%5v ", start)
+		for address := start; address < start+perRow && address < VirtualMachine.MemorySize; address++ {
+			word := app.vm.Memory.Get(uint16(address))
+			fmt.Fprintf(&line, " %04x", word)
+			if word >= ' ' && word <= '~' {
+				chars.WriteRune(rune(word))
+			} else {
+				chars.WriteByte('.')
+			}
+		}
+		lines = append(lines, line.String()+" "+chars.String())
+	}
+	return lines
+}
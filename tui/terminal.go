@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// Switches tty to raw mode with stty, so that keys arrive as they are pressed and are not echoed. Returns a function
+// that puts the terminal back the way it was.
+func rawMode(tty *os.File) (func() error, error) {
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := stty(tty, strings.TrimSpace(saved))
+		return err
+	}, nil
+}
+
+// Returns the number of rows and columns of tty.
+func terminalSize(tty *os.File) (int, int, error) {
+	size, err := stty(tty, "size")
+	if err != nil {
+		return 0, 0, err
+	}
+	var rows, columns int
+	if _, err := fmt.Sscan(size, &rows, &columns); err != nil {
+		return 0, 0, fmt.Errorf("unexpected terminal size %q: %w", size, err)
+	}
+	return rows, columns, nil
+}
+
+func stty(tty *os.File, args ...string) (string, error) {
+	command := exec.Command("stty", args...)
+	command.Stdin = tty
+	output, err := command.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %v: %w", strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
+// Escape sequences of the keys the TUI knows, as xterm and the Linux console send them.
+var sequences = map[string]string{
+	"\x1b[A":   "up",
+	"\x1b[B":   "down",
+	"\x1b[C":   "right",
+	"\x1b[D":   "left",
+	"\x1bOA":   "up",
+	"\x1bOB":   "down",
+	"\x1b[5~":  "pgup",
+	"\x1b[6~":  "pgdn",
+	"\x1b[15~": "f5",
+	"\x1b[[E":  "f5",
+	"\x1b[20~": "f9",
+	"\x1b[21~": "f10",
+}
+
+// Splits what the terminal sent into keys: printable characters as themselves, and names such as enter, backspace,
+// ctrl-p, up or f5 for the rest. Escape sequences the TUI does not know are dropped.
+func parseKeys(data []byte) []string {
+	var keys []string
+	for len(data) > 0 {
+		if name, length := escape(data); length > 0 {
+			if name != "" {
+				keys = append(keys, name)
+			}
+			data = data[length:]
+			continue
+		}
+
+		char, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case char == '\r' || char == '\n':
+			keys = append(keys, "enter")
+		case char == 0x7f || char == 0x08:
+			keys = append(keys, "backspace")
+		case char == 0x1b:
+			keys = append(keys, "esc")
+		case char >= 1 && char <= 26:
+			keys = append(keys, "ctrl-"+string(rune('a'+char-1)))
+		case char >= ' ' && char != utf8.RuneError:
+			keys = append(keys, string(char))
+		}
+	}
+	return keys
+}
+
+// Returns the key the escape sequence data starts with stands for, or an empty name for one the TUI does not know, and
+// the length of the sequence. The length is 0 if data does not start with a sequence.
+func escape(data []byte) (string, int) {
+	if len(data) < 2 || data[0] != 0x1b {
+		return "", 0
+	}
+	for sequence, name := range sequences {
+		if bytes.HasPrefix(data, []byte(sequence)) {
+			return name, len(sequence)
+		}
+	}
+	switch data[1] {
+	case '[':
+		// Parameters up to a final character from @ to ~.
+		for i := 2; i < len(data); i++ {
+			if data[i] >= '@' && data[i] <= '~' {
+				return "", i + 1
+			}
+		}
+		return "", len(data)
+	case 'O':
+		if len(data) < 3 {
+			return "", len(data)
+		}
+		return "", 3
+	}
+	return "", 0
+}
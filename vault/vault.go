@@ -0,0 +1,322 @@
+// Package vault finds the way through the grid of rooms that controls the vault door. The orb starts with the weight
+// on its pedestal. Walking into a room with an operator on its floor picks that operator, walking into a room with a
+// number applies it to the weight. The door opens if the orb reaches the door room with the weight carved into the
+// door. The orb evaporates if its weight leaves its bounds, if it is carried back to the pedestal or if it reaches the
+// door room with any other weight.
+package vault
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ckyong/synacor/gamestate"
+)
+
+// Grid holds the tiles of the rooms, north at the top. A tile is a number, one of + - * or empty where there is no
+// room.
+type Grid [][]string
+
+type Position struct {
+	Row    int
+	Column int
+}
+
+type Puzzle struct {
+	Grid   Grid
+	Start  Position
+	Target Position
+	// Weight of the orb when it is picked up and the weight that opens the door.
+	Weight int
+	Goal   int
+	// Bounds the weight has to stay within.
+	Min int
+	Max int
+}
+
+// Compass directions in the order they are tried, with the way each moves through the grid.
+var directions = []struct {
+	name string
+	move Position
+}{
+	{"north", Position{-1, 0}},
+	{"east", Position{0, 1}},
+	{"south", Position{1, 0}},
+	{"west", Position{0, -1}},
+}
+
+type state struct {
+	position Position
+	weight   int
+	// Operator picked in the last room, applied by the next number.
+	operator string
+}
+
+// Solve returns the shortest walk from Start that opens the door, as compass directions the game accepts.
+func (puzzle *Puzzle) Solve() ([]string, error) {
+	if !puzzle.room(puzzle.Start) || !puzzle.room(puzzle.Target) {
+		return nil, fmt.Errorf("the start %v and the target %v have to be rooms of the grid", puzzle.Start, puzzle.Target)
+	}
+
+	type visit struct {
+		previous  state
+		direction string
+	}
+
+	start := state{position: puzzle.Start, weight: puzzle.Weight}
+	visits := map[state]visit{start: {}}
+	queue := []state{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, direction := range directions {
+			next, alive := puzzle.walk(current, direction.move)
+			if !alive {
+				continue
+			}
+			if _, seen := visits[next]; seen {
+				continue
+			}
+			visits[next] = visit{previous: current, direction: direction.name}
+
+			if next.position == puzzle.Target {
+				var path []string
+				for at := next; at != start; at = visits[at].previous {
+					path = append([]string{visits[at].direction}, path...)
+				}
+				return path, nil
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, fmt.Errorf("no walk from %v brings a weight of %v to %v with a weight of %v", puzzle.Start, puzzle.Weight, puzzle.Target, puzzle.Goal)
+}
+
+// Walk checks that a walk from Start opens the door, and returns the weight of the orb when it reaches the door room.
+func (puzzle *Puzzle) Walk(path []string) (int, error) {
+	current := state{position: puzzle.Start, weight: puzzle.Weight}
+	for i, name := range path {
+		move, ok := Position{}, false
+		for _, direction := range directions {
+			if direction.name == name {
+				move, ok = direction.move, true
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("step %v: %q is not a compass direction", i+1, name)
+		}
+
+		next, alive := puzzle.walk(current, move)
+		if !alive && next.position == puzzle.Target {
+			return next.weight, fmt.Errorf("step %v: the orb reaches the door with a weight of %v", i+1, next.weight)
+		}
+		if !alive {
+			return 0, fmt.Errorf("step %v: the orb evaporates walking %v from %v", i+1, name, current.position)
+		}
+		if next.position == puzzle.Target {
+			if i != len(path)-1 {
+				return next.weight, fmt.Errorf("step %v: the door opens before the end of the walk", i+1)
+			}
+			return next.weight, nil
+		}
+		current = next
+	}
+	return 0, fmt.Errorf("the walk ends at %v, not at the door", current.position)
+}
+
+// Takes the orb one room further and reports whether it survives, which for the door room means opening the door.
+func (puzzle *Puzzle) walk(current state, move Position) (state, bool) {
+	next := state{position: Position{current.position.Row + move.Row, current.position.Column + move.Column}, weight: current.weight}
+	if !puzzle.room(next.position) || next.position == puzzle.Start {
+		return next, false
+	}
+
+	tile := puzzle.Grid[next.position.Row][next.position.Column]
+	value, err := strconv.Atoi(tile)
+	if err != nil {
+		next.operator = tile
+		return next, true
+	}
+
+	switch current.operator {
+	case "+":
+		next.weight += value
+	case "-":
+		next.weight -= value
+	case "*":
+		next.weight *= value
+	}
+	if next.weight < puzzle.Min || next.weight > puzzle.Max {
+		return next, false
+	}
+	if next.position == puzzle.Target {
+		return next, next.weight == puzzle.Goal
+	}
+	return next, true
+}
+
+func (puzzle *Puzzle) room(position Position) bool {
+	grid := puzzle.Grid
+	return position.Row >= 0 && position.Row < len(grid) &&
+		position.Column >= 0 && position.Column < len(grid[position.Row]) &&
+		grid[position.Row][position.Column] != ""
+}
+
+// LoadGrid parses the grid file at filePath.
+func LoadGrid(filePath string) (Grid, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseGrid(file)
+}
+
+// ParseGrid reads a grid with a row per line, north first, and the tiles of a row separated by spaces. A . stands for
+// a missing room. Blank lines and lines starting with # are skipped.
+func ParseGrid(reader io.Reader) (Grid, error) {
+	var grid Grid
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var row []string
+		for _, tile := range strings.Fields(text) {
+			if tile == "." {
+				tile = ""
+			} else if _, err := strconv.Atoi(tile); err != nil && tile != "+" && tile != "-" && tile != "*" {
+				return nil, fmt.Errorf("line %v: %q is not a number, an operator or .", line, tile)
+			}
+			row = append(row, tile)
+		}
+		grid = append(grid, row)
+	}
+	return grid, scanner.Err()
+}
+
+// The tile of a vault room is the last thing quoted in its description: the number on the pedestal in the
+// antechamber, and the mosaic on the floor everywhere else.
+var tilePattern = regexp.MustCompile(`'([^']+)'`)
+
+// The number on the door, in the description of the room the vault is entered from.
+var doorPattern = regexp.MustCompile(`'(\d+)' carved into it`)
+
+// FromMemory reads the vault out of the room table of the game, starting from the room the orb is in, or the room the
+// player is in while the orb is carried. The weight bounds are those of the 15-bit numbers of the VM.
+func FromMemory(game *gamestate.State) (*Puzzle, error) {
+	orb, ok := game.Item("orb")
+	if !ok {
+		return nil, fmt.Errorf("there is no orb in the item table")
+	}
+	start := game.Room(orb.Location)
+	if where := game.Where(orb.Location); where == "inventory" || where == "nowhere" {
+		start = game.CurrentRoom()
+	}
+
+	// Lay the rooms out by following their compass exits, as long as they have a tile.
+	positions := map[uint16]Position{start.Address: {}}
+	rooms := []gamestate.Room{start}
+	for i := 0; i < len(rooms); i++ {
+		for _, exit := range rooms[i].Exits {
+			for _, direction := range directions {
+				if exit.Name != direction.name {
+					continue
+				}
+				if _, seen := positions[exit.To]; seen {
+					continue
+				}
+				next := game.Room(exit.To)
+				if len(tilePattern.FindAllString(next.Description, -1)) == 0 {
+					continue
+				}
+				from := positions[rooms[i].Address]
+				positions[exit.To] = Position{from.Row + direction.move.Row, from.Column + direction.move.Column}
+				rooms = append(rooms, next)
+			}
+		}
+	}
+
+	top, left, bottom, right := 0, 0, 0, 0
+	for _, position := range positions {
+		if position.Row < top {
+			top = position.Row
+		}
+		if position.Row > bottom {
+			bottom = position.Row
+		}
+		if position.Column < left {
+			left = position.Column
+		}
+		if position.Column > right {
+			right = position.Column
+		}
+	}
+
+	grid := make(Grid, bottom-top+1)
+	for row := range grid {
+		grid[row] = make([]string, right-left+1)
+	}
+	puzzle := &Puzzle{Grid: grid, Min: 0, Max: 32767}
+	door := false
+	for _, room := range rooms {
+		position := positions[room.Address]
+		position = Position{position.Row - top, position.Column - left}
+		quoted := tilePattern.FindAllStringSubmatch(room.Description, -1)
+		grid[position.Row][position.Column] = quoted[len(quoted)-1][1]
+
+		if room.Address == start.Address {
+			puzzle.Start = position
+		}
+		if match := doorPattern.FindStringSubmatch(room.Description); match != nil {
+			puzzle.Target = position
+			puzzle.Goal, _ = strconv.Atoi(match[1])
+			door = true
+		}
+	}
+	if !door {
+		return nil, fmt.Errorf("none of the %v rooms around %v has the vault door", len(rooms), start.Name)
+	}
+
+	weight, err := strconv.Atoi(grid[puzzle.Start.Row][puzzle.Start.Column])
+	if err != nil {
+		return nil, fmt.Errorf("the pedestal in %v has no weight on it", start.Name)
+	}
+	puzzle.Weight = weight
+	return puzzle, nil
+}
+
+// String draws the grid the way ParseGrid reads it.
+func (grid Grid) String() string {
+	width := 1
+	for _, row := range grid {
+		for _, tile := range row {
+			if len(tile) > width {
+				width = len(tile)
+			}
+		}
+	}
+
+	text := strings.Builder{}
+	for _, row := range grid {
+		for i, tile := range row {
+			if tile == "" {
+				tile = "."
+			}
+			if i < len(row)-1 {
+				tile = fmt.Sprintf("%-*v", width+1, tile)
+			}
+			text.WriteString(tile)
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+var challenge = Grid{
+	{"*", "8", "-", "1"},
+	{"4", "*", "11", "*"},
+	{"+", "4", "-", "18"},
+	{"22", "-", "9", "*"},
+}
+
+func challengePuzzle() *Puzzle {
+	return &Puzzle{Grid: challenge, Start: Position{3, 0}, Target: Position{0, 3}, Weight: 22, Goal: 30, Min: 0, Max: 32767}
+}
+
+func TestSolve(t *testing.T) {
+	puzzle := challengePuzzle()
+	path, err := puzzle.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Fields("north east east north west south east east west north north east")
+	if !reflect.DeepEqual(path, expected) {
+		t.Errorf("expected %v, got %v", expected, path)
+	}
+	if weight, err := puzzle.Walk(path); err != nil || weight != 30 {
+		t.Errorf("expected the walk to open the door, got a weight of %v: %v", weight, err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	puzzle := challengePuzzle()
+	for _, walk := range []string{
+		"north north north east east east",
+		"east west",
+		"north east up",
+		"north east east",
+	} {
+		if _, err := puzzle.Walk(strings.Fields(walk)); err == nil {
+			t.Errorf("%v: expected the walk to fail", walk)
+		}
+	}
+}
+
+func TestSolveOtherGrids(t *testing.T) {
+	// A ring around a missing room. West of it the weight goes 20, 16, 12... and then down by 1 into the door room,
+	// east of it 7, 9, 11... and then up by 1, and the two sides only meet at the pedestal and the door.
+	grid, err := ParseGrid(strings.NewReader("# a ring\n4  -  1\n*  .  +\n5  +  2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	puzzle := &Puzzle{Grid: grid, Start: Position{2, 0}, Target: Position{0, 2}, Weight: 5, Min: 0, Max: 100}
+
+	for goal, expected := range map[int]string{
+		19: "north north east east",
+		8:  "east east north north",
+		11: "north north east west east west east east",
+		14: "east east north south north south north south north north",
+	} {
+		puzzle.Goal = goal
+		path, err := puzzle.Solve()
+		if err != nil || strings.Join(path, " ") != expected {
+			t.Errorf("goal %v: expected %v, got %v: %v", goal, expected, path, err)
+		}
+	}
+
+	puzzle.Goal = 13
+	if path, err := puzzle.Solve(); err == nil {
+		t.Errorf("expected no walk to a weight of 13, got %v", path)
+	}
+}
+
+func TestParseGrid(t *testing.T) {
+	grid, err := ParseGrid(strings.NewReader(challenge.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(grid, challenge) {
+		t.Errorf("expected %v, got %v", challenge, grid)
+	}
+
+	if _, err := ParseGrid(strings.NewReader("1 / 2")); err == nil {
+		t.Error("expected an error for an unknown operator")
+	}
+}
+
+func TestFromMemory(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Play the route up to the antechamber, where the orb sits on its pedestal.
+	entries, err := transcript.Load("../tools/autoplay/autopath.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if entry.Text == "take orb" {
+			entries = entries[:i]
+			break
+		}
+	}
+	if err := transcript.NewPlayer(vm, entries, io.Discard).Play(VirtualMachine.NewThreaded(vm)); err != nil {
+		t.Fatal(err)
+	}
+
+	puzzle, err := FromMemory(gamestate.New(&vm.Memory, gamestate.Challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := challengePuzzle(); !reflect.DeepEqual(puzzle, expected) {
+		t.Errorf("expected %+v, got %+v", expected, puzzle)
+	}
+}
@@ -0,0 +1,178 @@
+package VirtualMachine_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestMemory(t *testing.T) {
+	memory := VirtualMachine.Memory{}
+	if memory.Get(32767) != 0 {
+		t.Error("expected fresh memory to read as zeros")
+	}
+	memory.Set(1000, 5)
+	memory.Copy(32766, []uint16{1, 2, 3})
+	if memory.Get(1000) != 5 || memory.Get(32766) != 1 || memory.Get(32767) != 2 {
+		t.Errorf("expected the words that were written, got %v, %v and %v", memory.Get(1000), memory.Get(32766), memory.Get(32767))
+	}
+
+	// Saved states keep memory as a list of every word.
+	data, err := json.Marshal(&memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := []uint16{}
+	if err := json.Unmarshal(data, &words); err != nil || len(words) != VirtualMachine.MemorySize || words[1000] != 5 {
+		t.Fatalf("expected a list of %v words, got %v: %v", VirtualMachine.MemorySize, len(words), err)
+	}
+	restored := VirtualMachine.Memory{}
+	if err := json.Unmarshal(data, &restored); err != nil || !restored.Equal(&memory) {
+		t.Errorf("expected the memory back from JSON: %v", err)
+	}
+
+	restored.Set(1000, 6)
+	if restored.Equal(&memory) || !(&VirtualMachine.Memory{}).Equal(&VirtualMachine.Memory{}) {
+		t.Error("expected memories to be equal exactly when their words are")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	vm := VirtualMachine.New([]uint16{21, 21, 0})
+	vm.Memory.Set(100, 1)
+	vm.Stack.Push(1)
+	vm.Stack.Push(2)
+
+	clone := vm.Clone()
+	vm.Memory.Set(100, 2)
+	clone.Memory.Set(101, 3)
+	vm.Register[7] = 4
+	// A pop followed by a push writes where the clone still keeps its top value.
+	vm.Stack.Pop()
+	vm.Stack.Push(5)
+	clone.Stack.Push(6)
+
+	if clone.Memory.Get(100) != 1 || vm.Memory.Get(101) != 0 || clone.Register[7] != 0 {
+		t.Errorf("expected the clone and the original not to see each other's writes")
+	}
+	if original, cloned := drain(&vm.Stack), drain(&clone.Stack); !equal(original, []uint16{1, 5}) || !equal(cloned, []uint16{1, 2, 6}) {
+		t.Errorf("expected stacks [1 5] and [1 2 6], got %v and %v", original, cloned)
+	}
+}
+
+func TestCloneKeepsPendingInput(t *testing.T) {
+	vm := VirtualMachine.New(echo)
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader("ab\ncd\nq"), &output)
+	vm.SetHook(1000, func(vm *VirtualMachine.VirtualMachine) error { return nil })
+
+	// Read the a, leaving the rest of the line and of the input pending.
+	for output.Len() == 0 {
+		if _, err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clone := vm.Clone()
+	for _, engine := range []interface{ Run() error }{vm, VirtualMachine.NewThreaded(clone)} {
+		if err := engine.Run(); err != nil && !errors.Is(err, io.EOF) {
+			t.Fatal(err)
+		}
+	}
+
+	if output.String() != "ab\ncd\n" {
+		t.Errorf("expected the original to echo all of its input, got %q", output.String())
+	}
+	if clone.Register != vm.Register || clone.Index != vm.Index || clone.Steps != vm.Steps || !clone.Memory.Equal(&vm.Memory) {
+		t.Errorf("expected the clone to read the same input, got registers %v after %v steps instead of %v after %v",
+			clone.Register, clone.Steps, vm.Register, vm.Steps)
+	}
+	if expected, got := drain(&vm.Stack), drain(&clone.Stack); !equal(expected, got) {
+		t.Errorf("expected stack %v, got %v", expected, got)
+	}
+}
+
+// A VM with every page of memory in use and a stack, like the game in the middle of a command.
+func busyVM() *VirtualMachine.VirtualMachine {
+	vm := VirtualMachine.New(nil)
+	for address := uint16(0); address < VirtualMachine.MemorySize; address++ {
+		vm.Memory.Set(address, address)
+	}
+	for i := uint16(0); i < 20; i++ {
+		vm.Stack.Push(i)
+	}
+	return vm
+}
+
+type fork struct {
+	name string
+	fork func(b *testing.B, vm *VirtualMachine.VirtualMachine) *VirtualMachine.VirtualMachine
+}
+
+var forks = []fork{
+	{"snapshot", func(b *testing.B, vm *VirtualMachine.VirtualMachine) *VirtualMachine.VirtualMachine {
+		snapshot, err := vm.Snapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fork := VirtualMachine.New(nil)
+		if err := fork.Restore(snapshot); err != nil {
+			b.Fatal(err)
+		}
+		return fork
+	}},
+	{"dump", func(b *testing.B, vm *VirtualMachine.VirtualMachine) *VirtualMachine.VirtualMachine {
+		memory := vm.DumpMemory()
+		fork := VirtualMachine.New(memory[:])
+		fork.Register, fork.Index = vm.Register, vm.Index
+		return fork
+	}},
+	{"clone", func(b *testing.B, vm *VirtualMachine.VirtualMachine) *VirtualMachine.VirtualMachine {
+		return vm.Clone()
+	}},
+}
+
+// Like the world mapper: fork, then make a move that writes to a few pages, like the current room and an item.
+func BenchmarkForkMapper(b *testing.B) {
+	vm := busyVM()
+	for _, fork := range forks {
+		b.Run(fork.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				moved := fork.fork(b, vm)
+				moved.Memory.Set(2732, 2377)
+				moved.Memory.Set(2670, 0)
+				moved.Stack.Push(1)
+			}
+		})
+	}
+}
+
+// Like the brute-force search: fork, set r7 and run a few instructions on one threaded engine, reset to every fork.
+// Clones share the pages nobody writes to, so the engine keeps what it decoded from them, while every other kind of
+// fork has all of its code decoded again.
+func BenchmarkForkBruteForce(b *testing.B) {
+	vm := busyVM()
+	program := assembler.MustAssemble(`
+		add r0 r7 1
+		wmem 30000 r0
+		halt`)
+	vm.Memory.Copy(0, program)
+	for _, fork := range forks {
+		b.Run(fork.name, func(b *testing.B) {
+			engine := VirtualMachine.NewThreaded(vm)
+			for i := 0; i < b.N; i++ {
+				candidate := fork.fork(b, vm)
+				candidate.Register[7] = uint16(i % 32768)
+				engine.Reset(candidate)
+				if err := engine.Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package VirtualMachine
+
+import (
+	"fmt"
+)
+
+// What a CodeMap noticed the guest doing to its own code.
+type CodeEvent string
+
+const (
+	// The guest wrote to a word it had executed before.
+	WroteExecuted CodeEvent = "wrote executed code"
+	// The guest executed an instruction with a word it had written before.
+	ExecutedWritten CodeEvent = "executed written code"
+)
+
+// SelfModification is a CodeEvent at Address, caused by the instruction at Index after Steps instructions.
+type SelfModification struct {
+	Event   CodeEvent `json:"event"`
+	Address uint16    `json:"address"`
+	Index   uint16    `json:"index"`
+	Steps   uint64    `json:"steps"`
+}
+
+func (modification SelfModification) String() string {
+	return fmt.Sprintf("%v at %v by %v after %v steps", modification.Event, modification.Address, modification.Index, modification.Steps)
+}
+
+// CodeMap keeps track of the words of Memory the guest has executed, as an operation or an operand, and the ones it
+// has written since the map was attached with TrackCode. It records every word that is written after being executed,
+// or executed after being written, the first time that happens to the word.
+//
+// Only the guest's own instructions count: loading a program or a state, hooks and the input hacks do not.
+type CodeMap struct {
+	executed [MemorySize]bool
+	written  [MemorySize]bool
+	reported [2][MemorySize]bool
+	// Self-modifications in the order they happened.
+	Modifications []SelfModification
+	// Called with every self-modification as it is recorded, if set.
+	OnModification func(SelfModification)
+}
+
+// Executed reports whether the guest has executed the word at address, as an operation or an operand.
+func (codeMap *CodeMap) Executed(address uint16) bool {
+	return int(address) < MemorySize && codeMap.executed[address]
+}
+
+// Written reports whether the guest has written the word at address.
+func (codeMap *CodeMap) Written(address uint16) bool {
+	return int(address) < MemorySize && codeMap.written[address]
+}
+
+// Reset forgets everything the map has seen.
+func (codeMap *CodeMap) Reset() {
+	*codeMap = CodeMap{OnModification: codeMap.OnModification}
+}
+
+func (codeMap *CodeMap) report(event CodeEvent, address uint16, vm *VirtualMachine) {
+	kind := 0
+	if event == ExecutedWritten {
+		kind = 1
+	}
+	if codeMap.reported[kind][address] {
+		return
+	}
+	codeMap.reported[kind][address] = true
+
+	modification := SelfModification{Event: event, Address: address, Index: vm.Index, Steps: vm.Steps}
+	codeMap.Modifications = append(codeMap.Modifications, modification)
+	if codeMap.OnModification != nil {
+		codeMap.OnModification(modification)
+	}
+}
+
+// Records that the instruction at Index, of length words, is about to be executed.
+func (codeMap *CodeMap) execute(vm *VirtualMachine, length uint16) {
+	for address := vm.Index; address < vm.Index+length; address++ {
+		if codeMap.written[address] {
+			codeMap.report(ExecutedWritten, address, vm)
+		}
+		codeMap.executed[address] = true
+	}
+}
+
+// Records that the instruction at Index wrote the word at address.
+func (codeMap *CodeMap) write(vm *VirtualMachine, address uint16) {
+	if codeMap.executed[address] {
+		codeMap.report(WroteExecuted, address, vm)
+	}
+	codeMap.written[address] = true
+}
+
+// TrackCode makes the VM record what it executes and writes in codeMap from now on, or stops it if codeMap is nil.
+// Clones do not carry the map over.
+func (vm *VirtualMachine) TrackCode(codeMap *CodeMap) {
+	vm.codeMap = codeMap
+}
+
+// CodeMap returns the map given to TrackCode, if any.
+func (vm *VirtualMachine) CodeMap() *CodeMap {
+	return vm.codeMap
+}
+
+// Writes a word of Memory on behalf of the instruction at Index.
+func (vm *VirtualMachine) setMemory(address uint16, val uint16) {
+	vm.Memory.Set(address, val)
+	if vm.codeMap != nil {
+		vm.codeMap.write(vm, address)
+	}
+}
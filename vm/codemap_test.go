@@ -0,0 +1,96 @@
+package VirtualMachine_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Patches the character it prints before printing it, then overwrites its own first instruction.
+var selfModifying = assembler.MustAssemble(`
+	wmem 4 'b'
+	out 'a'
+	wmem 0 21
+	halt
+`)
+
+func TestCodeMap(t *testing.T) {
+	engines := map[string]func(vm *VirtualMachine.VirtualMachine) error{
+		"interpreted": func(vm *VirtualMachine.VirtualMachine) error { return vm.Run() },
+		"threaded":    func(vm *VirtualMachine.VirtualMachine) error { return VirtualMachine.NewThreaded(vm).Run() },
+		"debugger": func(vm *VirtualMachine.VirtualMachine) error {
+			debugger := VirtualMachine.NewDebugger(vm)
+			debugger.SetLog(&bytes.Buffer{})
+			return debugger.Run()
+		},
+	}
+	for name, run := range engines {
+		vm := VirtualMachine.New(selfModifying)
+		output := strings.Builder{}
+		vm.SetIO(strings.NewReader(""), &output)
+		reported := 0
+		codeMap := &VirtualMachine.CodeMap{OnModification: func(VirtualMachine.SelfModification) { reported++ }}
+		vm.TrackCode(codeMap)
+		if err := run(vm); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		expected := []VirtualMachine.SelfModification{
+			{Event: VirtualMachine.ExecutedWritten, Address: 4, Index: 3, Steps: 1},
+			{Event: VirtualMachine.WroteExecuted, Address: 0, Index: 5, Steps: 2},
+		}
+		if !reflect.DeepEqual(codeMap.Modifications, expected) || reported != 2 || output.String() != "b" {
+			t.Errorf("%v: expected %v, got %v (%v reported) printing %q", name, expected, codeMap.Modifications, reported, output.String())
+		}
+		if !codeMap.Executed(8) || codeMap.Executed(9) || !codeMap.Written(4) || codeMap.Written(3) {
+			t.Errorf("%v: expected everything up to the halt at 8 to be executed and only 0 and 4 written", name)
+		}
+	}
+}
+
+func TestCodeMapReset(t *testing.T) {
+	vm := VirtualMachine.New(selfModifying)
+	vm.SetIO(strings.NewReader(""), &strings.Builder{})
+	snapshot, err := vm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeMap := &VirtualMachine.CodeMap{}
+	vm.TrackCode(codeMap)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if vm.Clone().CodeMap() != nil || vm.CodeMap() != codeMap {
+		t.Error("expected the VM to keep its code map and clones to go without")
+	}
+
+	// Whatever was executed and written belonged to the memory a restore replaces.
+	if err := vm.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if codeMap.Executed(0) || codeMap.Written(4) || len(codeMap.Modifications) != 0 {
+		t.Errorf("expected a restore to start the code map over, got %v", codeMap.Modifications)
+	}
+}
+
+func TestWriteImage(t *testing.T) {
+	vm := VirtualMachine.New(selfModifying)
+	vm.SetIO(strings.NewReader(""), &strings.Builder{})
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	image := bytes.Buffer{}
+	if err := vm.WriteImage(&image); err != nil {
+		t.Fatal(err)
+	}
+	// The patched program, without the halt and the zeros after it.
+	expected := []byte{21, 0, 4, 0, 'b', 0, 19, 0, 'b', 0, 16, 0, 0, 0, 21, 0}
+	if !bytes.Equal(image.Bytes(), expected) {
+		t.Errorf("expected %v, got %v", expected, image.Bytes())
+	}
+}
@@ -0,0 +1,36 @@
+package VirtualMachine
+
+import (
+	"io"
+)
+
+// Command runs instead of the guest reading a line typed at its prompt when the first word of the line is its name,
+// like the hacks. It gets the rest of the words on the line and prints to the guest's output.
+type Command func(vm *VirtualMachine, args []string, output io.Writer)
+
+// AddCommand makes the VM run command for lines that start with name. Commands take precedence over the hacks.
+func (vm *VirtualMachine) AddCommand(name string, command Command) {
+	if vm.commands == nil {
+		vm.commands = map[string]Command{}
+	}
+	vm.commands[name] = command
+}
+
+// DisableHacks turns off the hacks built into the VM, some of which read and write files named by whoever types at the
+// prompt, for VMs that play for someone else. Commands still run, and clones of the VM keep the hacks off.
+func (vm *VirtualMachine) DisableHacks() {
+	vm.hacksDisabled = true
+}
+
+// Runs the command line names, and reports whether there was one.
+func (vm *VirtualMachine) runCommand(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	command, ok := vm.commands[fields[0]]
+	if !ok {
+		return false
+	}
+	command(vm, fields[1:], vm.output)
+	return true
+}
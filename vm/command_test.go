@@ -0,0 +1,86 @@
+package VirtualMachine_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestDisableHacks(t *testing.T) {
+	// Echoes what it reads.
+	vm := VirtualMachine.New(assembler.MustAssemble(`
+	loop:
+		in r0
+		out r0
+		jmp loop`))
+	vm.AddCommand("hello", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+		fmt.Fprintln(output, "hi")
+	})
+	vm.DisableHacks()
+
+	output := strings.Builder{}
+	// Commands only take whole lines, not what is left of one once the game has read its start.
+	vm.SetIO(strings.NewReader("set 5\nhello\nxhello\n"), &output)
+	if err := vm.Run(); err != io.EOF {
+		t.Fatalf("expected to run out of input, got %v", err)
+	}
+	if output.String() != "set 5\nhi\nxhello\n" || vm.Register[7] != 0 {
+		t.Errorf("expected the game to read the hack and the command to run, got %q and r7 %v", output.String(),
+			vm.Register[7])
+	}
+
+	clone := vm.Clone()
+	output.Reset()
+	clone.SetIO(strings.NewReader("set 5\n"), &output)
+	if err := clone.Run(); err != io.EOF {
+		t.Fatalf("expected to run out of input, got %v", err)
+	}
+	if output.String() != "set 5\n" || clone.Register[7] != 0 {
+		t.Errorf("expected the clone to keep the hacks off, got %q and r7 %v", output.String(), clone.Register[7])
+	}
+}
+
+// Every engine looks for hacks and commands only as it reads a new line, not in what is left of a line once the game
+// has read its start.
+func TestCommandsTakeWholeLines(t *testing.T) {
+	program := assembler.MustAssemble(`
+	loop:
+		in r0
+		out r0
+		jmp loop`)
+	tests := []struct {
+		name   string
+		input  string
+		output string
+		r7     uint16
+	}{
+		{"whole lines", "hello\nset 5\n", "hi\n", 5},
+		{"rest of a line", "xhello\na hello\n", "xhello\na hello\n", 0},
+		{"line after a partly read one", "a hello\nhello\n", "a hello\nhi\n", 0},
+	}
+
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				vm := VirtualMachine.New(program)
+				vm.AddCommand("hello", func(vm *VirtualMachine.VirtualMachine, args []string, output io.Writer) {
+					fmt.Fprintln(output, "hi")
+				})
+				output := strings.Builder{}
+				vm.SetIO(strings.NewReader(test.input), &output)
+
+				if err := engine.run(vm); err != io.EOF {
+					t.Fatalf("expected to run out of input, got %v", err)
+				}
+				if output.String() != test.output || vm.Register[7] != test.r7 {
+					t.Errorf("expected %q and r7 %v, got %q and r7 %v", test.output, test.r7, output.String(),
+						vm.Register[7])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package VirtualMachine_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+var engines = []struct {
+	name string
+	run  func(vm *VirtualMachine.VirtualMachine) error
+}{
+	{"VirtualMachine", func(vm *VirtualMachine.VirtualMachine) error {
+		return vm.Run()
+	}},
+	{"VirtualMachineDebugger", func(vm *VirtualMachine.VirtualMachine) error {
+		return VirtualMachine.NewDebugger(vm).Run()
+	}},
+	{"ThreadedVirtualMachine", func(vm *VirtualMachine.VirtualMachine) error {
+		return VirtualMachine.NewThreaded(vm).Run()
+	}},
+}
+
+// Every case runs a program until it halts and checks the output, registers and stack it leaves behind. The stack is
+// listed bottom first. Writes to memory are checked by reading them back into a register.
+var conformance = []struct {
+	name       string
+	source     string
+	input      string
+	output     string
+	registers  [8]uint16
+	stack      []uint16
+	emptyStack bool
+}{
+	{
+		name: "halt stops execution",
+		source: `
+			halt
+			out 'x'`,
+	},
+	{
+		name: "set literal and register",
+		source: `
+			set r0 42
+			set r1 r0
+			set r7 32767
+			halt`,
+		registers: [8]uint16{42, 42, 0, 0, 0, 0, 0, 32767},
+	},
+	{
+		name: "push and pop",
+		source: `
+			set r1 9
+			push 5
+			push r1
+			push 3
+			pop r2
+			pop r3
+			halt`,
+		registers: [8]uint16{0, 9, 3, 9, 0, 0, 0, 0},
+		stack:     []uint16{5},
+	},
+	{
+		name: "pop into memory",
+		source: `
+			push 77
+			pop target
+			rmem r0 target
+			halt
+			target: data 0`,
+		registers: [8]uint16{77, 0, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "pop from empty stack",
+		source: `
+			pop r0
+			halt`,
+		emptyStack: true,
+	},
+	{
+		name: "eq",
+		source: `
+			set r3 6
+			eq r0 6 6
+			eq r1 6 7
+			eq r2 r3 6
+			eq r4 r3 r0
+			halt`,
+		registers: [8]uint16{1, 0, 1, 6, 0, 0, 0, 0},
+	},
+	{
+		name: "gt",
+		source: `
+			set r3 4
+			gt r0 5 4
+			gt r1 4 4
+			gt r2 r3 3
+			gt r4 r3 32767
+			halt`,
+		registers: [8]uint16{1, 0, 1, 4, 0, 0, 0, 0},
+	},
+	{
+		name: "jmp literal and register",
+		source: `
+			set r0 second
+			jmp first
+			out 'x'
+			first: jmp r0
+			out 'y'
+			second: out 'z'
+			halt`,
+		output:    "z",
+		registers: [8]uint16{11, 0, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "jt",
+		source: `
+			set r1 taken
+			jt 0 fail
+			jt 1 next
+			jmp fail
+			next: jt r0 fail
+			set r0 1
+			jt r0 r1
+			fail: out 'x'
+			halt
+			taken: out 't'
+			halt`,
+		output:    "t",
+		registers: [8]uint16{1, 23, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "jf",
+		source: `
+			set r1 taken
+			jf 1 fail
+			jf 0 next
+			jmp fail
+			next: set r0 1
+			jf r0 fail
+			set r0 0
+			jf r0 r1
+			fail: out 'x'
+			halt
+			taken: out 'f'
+			halt`,
+		output:    "f",
+		registers: [8]uint16{0, 26, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "add wraps modulo 32768",
+		source: `
+			add r0 2 3
+			add r1 32758 15
+			set r2 32767
+			add r3 r2 r2
+			add r4 r3 1
+			halt`,
+		registers: [8]uint16{5, 5, 32767, 32766, 32767, 0, 0, 0},
+	},
+	{
+		name: "mult wraps modulo 32768",
+		source: `
+			mult r0 6 7
+			mult r1 32767 2
+			set r2 300
+			mult r3 r2 r2
+			halt`,
+		registers: [8]uint16{42, 32766, 300, 24464, 0, 0, 0, 0},
+	},
+	{
+		name: "mod",
+		source: `
+			mod r0 17 5
+			mod r1 4 9
+			set r2 32767
+			mod r3 r2 10
+			halt`,
+		registers: [8]uint16{2, 4, 32767, 7, 0, 0, 0, 0},
+	},
+	{
+		name: "and and or",
+		source: `
+			and r0 12 10
+			or r1 12 10
+			set r2 21845
+			and r3 r2 32767
+			or r4 r2 10922
+			halt`,
+		registers: [8]uint16{8, 14, 21845, 21845, 32767, 0, 0, 0},
+	},
+	{
+		name: "not is 15 bits",
+		source: `
+			not r0 0
+			not r1 32767
+			set r2 21845
+			not r3 r2
+			halt`,
+		registers: [8]uint16{32767, 0, 21845, 10922, 0, 0, 0, 0},
+	},
+	{
+		name: "rmem literal and register address",
+		source: `
+			rmem r0 value
+			set r1 value
+			rmem r2 r1
+			rmem r3 looks_like_register
+			halt
+			value: data 1234
+			looks_like_register: data 32770`,
+		registers: [8]uint16{1234, 13, 1234, 32770, 0, 0, 0, 0},
+	},
+	{
+		name: "wmem literal and register",
+		source: `
+			wmem first 11
+			set r0 second
+			set r1 22
+			wmem r0 r1
+			rmem r2 first
+			rmem r3 second
+			halt
+			first: data 0
+			second: data 0`,
+		registers: [8]uint16{20, 22, 11, 22, 0, 0, 0, 0},
+	},
+	{
+		name: "wmem rewrites code that runs afterwards",
+		source: `
+			set r0 2
+			loop: out 'a'
+			wmem 4 'b'
+			add r0 r0 32767
+			jt r0 loop
+			halt`,
+		output: "ab",
+	},
+	{
+		name: "call and ret",
+		source: `
+			call function
+			set r1 function
+			call r1
+			halt
+			function: add r0 r0 1
+			ret`,
+		registers: [8]uint16{2, 8, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "call pushes the return address",
+		source: `
+			push 9
+			call function
+			function: halt`,
+		stack: []uint16{9, 4},
+	},
+	{
+		name: "ret pops the address to jump to",
+		source: `
+			push done
+			ret
+			out 'x'
+			done: out 'r'
+			halt`,
+		output: "r",
+	},
+	{
+		name: "ret from empty stack",
+		source: `
+			ret
+			out 'x'`,
+		emptyStack: true,
+	},
+	{
+		name: "out literal and register",
+		source: `
+			out 'o'
+			set r0 'k'
+			out r0
+			out 10
+			halt`,
+		output:    "ok\n",
+		registers: [8]uint16{'k', 0, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		name: "in reads one character at a time",
+		source: `
+			in r0
+			in r1
+			in target
+			rmem r2 target
+			halt
+			target: data 0`,
+		input:     "hi\n",
+		registers: [8]uint16{'h', 'i', '\n', 0, 0, 0, 0, 0},
+	},
+	{
+		name: "noop",
+		source: `
+			noop
+			noop
+			out 'n'
+			halt`,
+		output: "n",
+	},
+}
+
+func TestConformance(t *testing.T) {
+	for _, test := range conformance {
+		program, err := assembler.Assemble(test.source)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				vm := VirtualMachine.New(program)
+				output := strings.Builder{}
+				vm.SetIO(strings.NewReader(test.input), &output)
+
+				err := engine.run(vm)
+
+				var emptyStack *VirtualMachine.EmptyStackError
+				if test.emptyStack {
+					if !errors.As(err, &emptyStack) {
+						t.Fatalf("expected an EmptyStackError, got %v", err)
+					}
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if output.String() != test.output {
+					t.Errorf("expected output %q, got %q", test.output, output.String())
+				}
+				if vm.Register != test.registers {
+					t.Errorf("expected registers %v, got %v", test.registers, vm.Register)
+				}
+				if stack := drain(&vm.Stack); !equal(stack, test.stack) {
+					t.Errorf("expected stack %v, got %v", test.stack, stack)
+				}
+			})
+		}
+	}
+}
+
+// Empties the stack and returns what was on it, bottom first.
+func drain(stack *VirtualMachine.Stack) []uint16 {
+	result := make([]uint16, stack.Len())
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i], _ = stack.Pop()
+	}
+	return result
+}
+
+func equal(a []uint16, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -8,11 +8,18 @@ import (
 )
 
 func (vm *VirtualMachine) DumpMemory() [32768]uint16 {
-	result := [32768]uint16{}
-	for address, value := range vm.Memory {
-		result[address] = value
+	return vm.Memory.Array()
+}
+
+// WriteImage writes Memory as it is now in the format Load reads, leaving out the zeros at the end. Once the guest has
+// decrypted or patched its code, the image holds the code that actually runs.
+func (vm *VirtualMachine) WriteImage(output io.Writer) error {
+	memory := vm.Memory.Array()
+	end := len(memory)
+	for end > 0 && memory[end-1] == 0 {
+		end--
 	}
-	return result
+	return binary.Write(output, binary.LittleEndian, memory[:end])
 }
 
 func (vm *VirtualMachine) load(file *os.File) error {
@@ -29,7 +36,7 @@ func (vm *VirtualMachine) load(file *os.File) error {
 			}
 		}
 
-		vm.Memory[index] = num
+		vm.Memory.Set(uint16(index), num)
 		index++
 	}
 }
@@ -0,0 +1,135 @@
+package VirtualMachine_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Runs random program images on random input with every engine for a limited number of instructions. Besides not
+// panicking, every engine has to fail or halt in the same way the interpreter does.
+func FuzzEngines(f *testing.F) {
+	f.Add(toBytes(assembler.MustAssemble(`
+		in r0
+		mod r1 r0 r2
+		wmem r0 r1
+		rmem r2 r0
+		jmp r2`)), []byte("ab\n"))
+	f.Add(toBytes(assembler.MustAssemble(`
+		loop: in r0
+		out r0
+		jt r0 loop`)), []byte("set 5\nget\nhello\n"))
+
+	f.Fuzz(func(t *testing.T, image []byte, input []byte) {
+		if bytes.Contains(input, []byte("state")) {
+			t.Skip("save state and load state use the file system")
+		}
+
+		program := toWords(image)
+		if len(program) > 32768 {
+			program = program[:32768]
+		}
+
+		for _, engine := range VirtualMachine.Engines[1:] {
+			err := VirtualMachine.Lockstep(program, string(input), VirtualMachine.Engines[0], engine, 1000)
+			var divergence *VirtualMachine.DivergenceError
+			if errors.As(err, &divergence) {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+// Saves random states and checks that restoring them gives back the same VM.
+func FuzzSnapshot(f *testing.F) {
+	f.Add(toBytes([]uint16{9, 32768, 32769, 4, 0}), toBytes([]uint16{1, 2, 3}), toBytes([]uint16{7, 8}), uint16(4))
+
+	f.Fuzz(func(t *testing.T, image []byte, registers []byte, stack []byte, index uint16) {
+		program := toWords(image)
+		if len(program) > 32768 {
+			program = program[:32768]
+		}
+
+		vm := VirtualMachine.New(program)
+		copy(vm.Register[:], toWords(registers))
+		for _, value := range toWords(stack) {
+			vm.Stack.Push(value)
+		}
+		vm.Index = index
+
+		snapshot, err := vm.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := VirtualMachine.New(nil)
+		if err := restored.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+
+		if !restored.Memory.Equal(&vm.Memory) {
+			t.Error("memory differs after restoring")
+		}
+		if restored.Register != vm.Register {
+			t.Errorf("expected registers %v, got %v", vm.Register, restored.Register)
+		}
+		if restored.Index != vm.Index {
+			t.Errorf("expected index %v, got %v", vm.Index, restored.Index)
+		}
+		if expected, got := drain(&vm.Stack), drain(&restored.Stack); !equal(expected, got) {
+			t.Errorf("expected stack %v, got %v", expected, got)
+		}
+	})
+}
+
+// Restores arbitrary data, which either fails and leaves the VM alone or produces a state that saves back the same.
+func FuzzRestore(f *testing.F) {
+	f.Add([]byte(`{"memory":[1,2,3],"register":[0,0,0,0,0,0,0,5],"stack":[4],"index":2}`))
+	f.Add([]byte(`{"memory":[],"register":[],"stack":{},"index":0}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		vm := VirtualMachine.New([]uint16{21, 21, 0})
+		before, err := vm.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := vm.Restore(data); err != nil {
+			if after, _ := vm.Snapshot(); !bytes.Equal(before, after) {
+				t.Error("a failed restore changed the VM")
+			}
+			return
+		}
+
+		snapshot, err := vm.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := VirtualMachine.New(nil)
+		if err := restored.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := restored.Snapshot(); !bytes.Equal(snapshot, again) {
+			t.Errorf("snapshot changed after restoring it: %s against %s", snapshot, again)
+		}
+	})
+}
+
+func toWords(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return words
+}
+
+func toBytes(words []uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[2*i:], word)
+	}
+	return data
+}
@@ -0,0 +1,84 @@
+package VirtualMachine
+
+import (
+	"fmt"
+)
+
+// Hook is a native replacement for a guest function. It reads its arguments from and leaves its results in Register,
+// Memory and Stack like the guest code would. The VM takes care of returning to the caller afterwards.
+//
+// The threaded engine does not notice a hook writing to Memory that holds code.
+type Hook func(vm *VirtualMachine) error
+
+// SetHook makes the VM call hook instead of running the guest function that starts at address.
+func (vm *VirtualMachine) SetHook(address uint16, hook Hook) {
+	if vm.hooks == nil {
+		vm.hooks = map[uint16]Hook{}
+	}
+	vm.hooks[address] = hook
+}
+
+func (vm *VirtualMachine) RemoveHook(address uint16) {
+	delete(vm.hooks, address)
+}
+
+// Runs the hook for the current Index followed by the equivalent of ret. Returns false if there is no hook there.
+func (vm *VirtualMachine) runHook() (bool, error) {
+	hook, ok := vm.hooks[vm.Index]
+	if !ok {
+		return false, nil
+	}
+
+	if err := hook(vm); err != nil {
+		return true, err
+	}
+	return true, vm.ret()
+}
+
+type HookMismatchError struct {
+	Address             uint16
+	Interpreted, Hooked string
+}
+
+func (err *HookMismatchError) Error() string {
+	return fmt.Sprintf("hook for %v left %v, the guest code left %v", err.Address, err.Hooked, err.Interpreted)
+}
+
+// VerifyHook calls the guest function at address with the given registers on a VM loaded with memory, once
+// interpreted and once through hook, and returns a HookMismatchError if they leave different registers or stacks.
+func VerifyHook(memory []uint16, address uint16, registers [8]uint16, hook Hook) error {
+	interpreted, err := callFunction(memory, address, registers, nil)
+	if err != nil {
+		return err
+	}
+
+	hooked, err := callFunction(memory, address, registers, hook)
+	if err != nil {
+		return err
+	}
+
+	if interpreted != hooked {
+		return &HookMismatchError{Address: address, Interpreted: interpreted, Hooked: hooked}
+	}
+	return nil
+}
+
+// Calls the function at address and returns its registers and stack once it has returned.
+func callFunction(memory []uint16, address uint16, registers [8]uint16, hook Hook) (string, error) {
+	vm := New(memory)
+	vm.Register = registers
+
+	// Return to a halt in the last word of Memory.
+	vm.Memory.Set(MemorySize-1, 0)
+	vm.Stack.Push(MemorySize - 1)
+	vm.Index = address
+
+	if hook != nil {
+		vm.SetHook(address, hook)
+	}
+
+	if err := NewThreaded(vm).Run(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("registers %v and stack %v", vm.Register, vm.Stack.inner), nil
+}
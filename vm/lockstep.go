@@ -0,0 +1,182 @@
+package VirtualMachine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stepper executes a VirtualMachine one instruction at a time. Step returns true once the VM has halted.
+type Stepper interface {
+	Step() (bool, error)
+}
+
+// Engine names a way of executing a VirtualMachine.
+type Engine struct {
+	Name string
+	New  func(vm *VirtualMachine) Stepper
+}
+
+var Engines = []Engine{
+	{"VirtualMachine", func(vm *VirtualMachine) Stepper {
+		return vm
+	}},
+	{"VirtualMachineDebugger", func(vm *VirtualMachine) Stepper {
+		debugger := NewDebugger(vm)
+		// The instruction log would drown out whatever is being compared.
+		debugger.SetLog(io.Discard)
+		return debugger
+	}},
+	{"ThreadedVirtualMachine", func(vm *VirtualMachine) Stepper {
+		return NewThreaded(vm)
+	}},
+}
+
+// DivergenceError reports the first instruction after which two engines no longer agree.
+type DivergenceError struct {
+	// Number of instructions both engines had executed, counting the one that diverged.
+	Step int
+	// Address of the instruction that diverged.
+	Index uint16
+	// What differs: steps, pc, registers, stack, memory, output, halt or error.
+	Field string
+	A, B  string
+}
+
+func (err *DivergenceError) Error() string {
+	return fmt.Sprintf("step %v at index %v: %v differs, %v against %v", err.Step, err.Index, err.Field, err.A, err.B)
+}
+
+// Memory is compared in full this often, on top of the words each engine's instruction is known to write.
+const fullCompareInterval = 4096
+
+// Lockstep loads memory into a VM for each engine, feeds both the same input and executes them side by side for at most
+// limit instructions, or until they halt if limit is 0. Returns a DivergenceError as soon as their state differs.
+// Running out of input ends the comparison like halting does, as long as both engines run out at the same point.
+func Lockstep(memory []uint16, input string, a Engine, b Engine, limit int) error {
+	vmA, vmB := New(memory), New(memory)
+	outputA, outputB := &strings.Builder{}, &strings.Builder{}
+	vmA.SetIO(strings.NewReader(input), outputA)
+	vmB.SetIO(strings.NewReader(input), outputB)
+	stepperA, stepperB := a.New(vmA), b.New(vmB)
+
+	compared := 0
+	for step := 1; limit == 0 || step <= limit; step++ {
+		index := vmA.Index
+		// The engines can disagree on where the instruction writes if Memory has already diverged unnoticed.
+		writtenA, writesA := vmA.writtenAddress()
+		writtenB, writesB := vmB.writtenAddress()
+		readsInput := int(index) < MemorySize && vmA.Memory.Get(index) == 20
+
+		haltedA, errA := stepperA.Step()
+		haltedB, errB := stepperB.Step()
+
+		diverged := func(field string, valueA interface{}, valueB interface{}) error {
+			return &DivergenceError{
+				Step:  step,
+				Index: index,
+				Field: field,
+				A:     fmt.Sprintf("%v %v", a.Name, valueA),
+				B:     fmt.Sprintf("%v %v", b.Name, valueB),
+			}
+		}
+
+		if errorText(errA) != errorText(errB) {
+			return diverged("error", errorText(errA), errorText(errB))
+		}
+		if haltedA != haltedB {
+			return diverged("halt", haltedA, haltedB)
+		}
+		if vmA.Steps != vmB.Steps {
+			return diverged("steps", vmA.Steps, vmB.Steps)
+		}
+		if vmA.Index != vmB.Index {
+			return diverged("pc", vmA.Index, vmB.Index)
+		}
+		if vmA.Register != vmB.Register {
+			return diverged("registers", vmA.Register, vmB.Register)
+		}
+		if !equalStacks(vmA.Stack.inner, vmB.Stack.inner) {
+			return diverged("stack", vmA.Stack.inner, vmB.Stack.inner)
+		}
+		if outputA.Len() != outputB.Len() || outputA.String()[compared:] != outputB.String()[compared:] {
+			return diverged("output", fmt.Sprintf("%q", outputA.String()[compared:]), fmt.Sprintf("%q", outputB.String()[compared:]))
+		}
+		compared = outputA.Len()
+
+		for _, written := range []struct {
+			address uint16
+			writes  bool
+		}{{writtenA, writesA}, {writtenB, writesB}} {
+			if written.writes && vmA.Memory.Get(written.address) != vmB.Memory.Get(written.address) {
+				return diverged(fmt.Sprintf("memory at %v", written.address), vmA.Memory.Get(written.address),
+					vmB.Memory.Get(written.address))
+			}
+		}
+		// The input hacks can rewrite any part of Memory.
+		if readsInput || step%fullCompareInterval == 0 || haltedA || errA != nil {
+			if address, differs := firstDifference(&vmA.Memory, &vmB.Memory); differs {
+				return diverged(fmt.Sprintf("memory at %v", address), vmA.Memory.Get(address), vmB.Memory.Get(address))
+			}
+		}
+
+		if haltedA || errA != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Returns the Memory address the instruction at Index writes to, if any.
+func (vm *VirtualMachine) writtenAddress() (uint16, bool) {
+	if int(vm.Index)+1 >= MemorySize {
+		return 0, false
+	}
+	destination := vm.Memory.Get(vm.Index + 1)
+
+	switch vm.Memory.Get(vm.Index) {
+	case 1, 3, 4, 5, 9, 10, 11, 12, 13, 14, 15, 20:
+		if destination >= 32768 {
+			return 0, false
+		}
+		return destination, true
+	case 16:
+		address := vm.tryGetRegistryValue(destination)
+		if address >= 32768 {
+			return 0, false
+		}
+		return address, true
+	}
+	return 0, false
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return "no error"
+	}
+	return err.Error()
+}
+
+func equalStacks(a []uint16, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func firstDifference(a *Memory, b *Memory) (uint16, bool) {
+	if a.Equal(b) {
+		return 0, false
+	}
+	for address := uint16(0); address < MemorySize; address++ {
+		if a.Get(address) != b.Get(address) {
+			return address, true
+		}
+	}
+	return 0, false
+}
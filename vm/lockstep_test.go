@@ -0,0 +1,143 @@
+package VirtualMachine_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Plays the whole game with the autopath transcript on every engine and checks them against the plain interpreter.
+func TestLockstepChallenge(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	defer file.Close()
+
+	vm, err := VirtualMachine.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := vm.DumpMemory()
+
+	entries, err := transcript.Load("../tools/autoplay/autopath.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := ""
+	for _, entry := range entries {
+		if entry.Kind == transcript.Command {
+			input += entry.Text + "\n"
+		}
+	}
+
+	for _, engine := range VirtualMachine.Engines[1:] {
+		t.Run(engine.Name, func(t *testing.T) {
+			if err := VirtualMachine.Lockstep(memory[:], input, VirtualMachine.Engines[0], engine, 0); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestLockstepSelfModifyingProgram(t *testing.T) {
+	program := assembler.MustAssemble(`
+		set r0 3
+		loop: in buffer
+		rmem r1 buffer
+		add target r1 1
+		mult target target 2
+		mod target target 7
+		wmem character r1
+		data 19 ; out
+		character: data 'x'
+		add r0 r0 32767
+		jt r0 loop
+		halt
+		buffer: data 0
+		target: data 0`)
+
+	for _, engine := range VirtualMachine.Engines[1:] {
+		t.Run(engine.Name, func(t *testing.T) {
+			if err := VirtualMachine.Lockstep(program, "abc", VirtualMachine.Engines[0], engine, 0); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestLockstepReportsFirstDivergence(t *testing.T) {
+	program := assembler.MustAssemble(`
+		set r0 1
+		wmem target 5
+		out 'a'
+		halt
+		target: data 0`)
+
+	// Behaves like the interpreter but writes one word too far with wmem.
+	broken := VirtualMachine.Engine{Name: "broken", New: func(vm *VirtualMachine.VirtualMachine) VirtualMachine.Stepper {
+		return &offByOne{vm}
+	}}
+
+	err := VirtualMachine.Lockstep(program, "", VirtualMachine.Engines[0], broken, 0)
+
+	var divergence *VirtualMachine.DivergenceError
+	if !errors.As(err, &divergence) {
+		t.Fatalf("expected a DivergenceError, got %v", err)
+	}
+	if divergence.Step != 2 || divergence.Index != 3 || divergence.Field != "memory at 9" {
+		t.Errorf("expected the wmem at index 3 to diverge on step 2, got %v", divergence)
+	}
+}
+
+func TestLockstepComparesWhatEitherEngineWrote(t *testing.T) {
+	program := assembler.MustAssemble(`
+		set r0 1
+		wmem target 5
+		out 'a'
+		halt
+		target: data 5
+		data 0`)
+
+	// Behaves like the interpreter but quietly points the wmem one word further on the first step, so it writes to
+	// a word the interpreter leaves alone.
+	broken := VirtualMachine.Engine{Name: "broken", New: func(vm *VirtualMachine.VirtualMachine) VirtualMachine.Stepper {
+		return &redirected{vm}
+	}}
+
+	err := VirtualMachine.Lockstep(program, "", VirtualMachine.Engines[0], broken, 0)
+
+	var divergence *VirtualMachine.DivergenceError
+	if !errors.As(err, &divergence) {
+		t.Fatalf("expected a DivergenceError, got %v", err)
+	}
+	if divergence.Step != 2 || divergence.Index != 3 || divergence.Field != "memory at 10" {
+		t.Errorf("expected the wmem at index 3 to diverge on step 2, got %v", divergence)
+	}
+}
+
+type redirected struct {
+	vm *VirtualMachine.VirtualMachine
+}
+
+func (engine *redirected) Step() (bool, error) {
+	if engine.vm.Index == 0 {
+		engine.vm.Memory.Set(4, engine.vm.Memory.Get(4)+1)
+	}
+	return engine.vm.Step()
+}
+
+type offByOne struct {
+	vm *VirtualMachine.VirtualMachine
+}
+
+func (engine *offByOne) Step() (bool, error) {
+	if engine.vm.Memory.Get(engine.vm.Index) == 16 {
+		engine.vm.Memory.Set(engine.vm.Index+1, engine.vm.Memory.Get(engine.vm.Index+1)+1)
+	}
+	return engine.vm.Step()
+}
@@ -0,0 +1,122 @@
+package VirtualMachine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MemorySize is the number of words in the 15 bit address space.
+const MemorySize = 32768
+
+const (
+	pageBits  = 9
+	pageSize  = 1 << pageBits
+	pageMask  = pageSize - 1
+	pageCount = MemorySize / pageSize
+)
+
+type page [pageSize]uint16
+
+// Memory is the 15 bit address space, kept in pages that clones share until one of them writes to a page. A page
+// nobody has written to yet is nil and reads as zeros. The zero value is an address space of zeros.
+//
+// A page is only ever written to by the one Memory that owns it, and a Memory gives up every page it owns when it is
+// cloned, so clones can run on different goroutines. Cloning itself has to happen on the goroutine that uses memory.
+// Assigning a Memory would leave both copies owning the same pages, so copies have to be made with Clone.
+type Memory struct {
+	pages [pageCount]*page
+	owned [pageCount]bool
+}
+
+// Get returns the word at address, which has to be below MemorySize.
+func (memory *Memory) Get(address uint16) uint16 {
+	if page := memory.pages[address>>pageBits]; page != nil {
+		return page[address&pageMask]
+	}
+	return 0
+}
+
+// Set writes value to address, which has to be below MemorySize, copying the page first if it is shared.
+func (memory *Memory) Set(address uint16, value uint16) {
+	index := address >> pageBits
+	if !memory.owned[index] {
+		memory.own(index)
+	}
+	memory.pages[index][address&pageMask] = value
+}
+
+func (memory *Memory) own(index uint16) {
+	page := &page{}
+	if shared := memory.pages[index]; shared != nil {
+		*page = *shared
+	}
+	memory.pages[index] = page
+	memory.owned[index] = true
+}
+
+// Copy writes values to the words starting at address, leaving out the ones past the end of Memory.
+func (memory *Memory) Copy(address uint16, values []uint16) {
+	for i, value := range values {
+		if int(address)+i >= MemorySize {
+			return
+		}
+		memory.Set(address+uint16(i), value)
+	}
+}
+
+// Array returns a copy of every word.
+func (memory *Memory) Array() [MemorySize]uint16 {
+	result := [MemorySize]uint16{}
+	for index, page := range memory.pages {
+		if page != nil {
+			copy(result[index*pageSize:], page[:])
+		}
+	}
+	return result
+}
+
+// Clone returns a copy of memory that shares every page with it until either of them writes to the page.
+func (memory *Memory) Clone() Memory {
+	memory.owned = [pageCount]bool{}
+	return Memory{pages: memory.pages}
+}
+
+// Equal reports whether memory and other hold the same words.
+func (memory *Memory) Equal(other *Memory) bool {
+	for index := range memory.pages {
+		a, b := memory.pages[index], other.pages[index]
+		switch {
+		case a == b:
+		case a == nil:
+			if *b != (page{}) {
+				return false
+			}
+		case b == nil:
+			if *a != (page{}) {
+				return false
+			}
+		case *a != *b:
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON stores memory as a list of every word, the format saved states have always used.
+func (memory Memory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(memory.Array())
+}
+
+func (memory *Memory) UnmarshalJSON(data []byte) error {
+	words := []uint16{}
+	if err := json.Unmarshal(data, &words); err != nil {
+		return err
+	}
+	if len(words) > MemorySize {
+		return fmt.Errorf("memory holds %v words, more than %v", len(words), MemorySize)
+	}
+
+	*memory = Memory{}
+	memory.Copy(0, words)
+	return nil
+}
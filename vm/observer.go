@@ -0,0 +1,18 @@
+package VirtualMachine
+
+// OutputObserver is told about every character the guest prints, once it has been written to the output. Steps does not
+// include the out instruction that printed it yet.
+type OutputObserver interface {
+	Observe(vm *VirtualMachine, char uint16)
+}
+
+// AddObserver makes the VM pass everything it prints to observer as well.
+func (vm *VirtualMachine) AddObserver(observer OutputObserver) {
+	vm.observers = append(vm.observers, observer)
+}
+
+func (vm *VirtualMachine) notify(char uint16) {
+	for _, observer := range vm.observers {
+		observer.Observe(vm, char)
+	}
+}
@@ -0,0 +1,53 @@
+package VirtualMachine
+
+// OpArgs maps every opcode to the number of operands that follow it in Memory.
+var OpArgs = map[uint16]uint16{
+	0:  0,
+	1:  2,
+	2:  1,
+	3:  1,
+	4:  3,
+	5:  3,
+	6:  1,
+	7:  2,
+	8:  2,
+	9:  3,
+	10: 3,
+	11: 3,
+	12: 3,
+	13: 3,
+	14: 2,
+	15: 2,
+	16: 2,
+	17: 1,
+	18: 0,
+	19: 1,
+	20: 1,
+	21: 0,
+}
+
+// OpNames maps every opcode to its mnemonic from the architecture spec.
+var OpNames = map[uint16]string{
+	0:  "halt",
+	1:  "set",
+	2:  "push",
+	3:  "pop",
+	4:  "eq",
+	5:  "gt",
+	6:  "jmp",
+	7:  "jt",
+	8:  "jf",
+	9:  "add",
+	10: "mult",
+	11: "mod",
+	12: "and",
+	13: "or",
+	14: "not",
+	15: "rmem",
+	16: "wmem",
+	17: "call",
+	18: "ret",
+	19: "out",
+	20: "in",
+	21: "noop",
+}
@@ -0,0 +1,141 @@
+package VirtualMachine
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// RunState is what the VM of a Runner is doing.
+type RunState string
+
+const (
+	Running         RunState = "running"
+	Paused          RunState = "paused"
+	WaitingForInput RunState = "waiting for input"
+	Halted          RunState = "halted"
+	Failed          RunState = "failed"
+)
+
+// Instructions a Runner executes between chances for others to take its lock and look at the VM.
+const runBatch = 10_000
+
+// Runner runs a VM on the threaded engine in the background while its State is Running, for front ends that show the
+// VM as it plays. It holds the lock it is given while it executes a batch of instructions, so that the VM's output
+// arrives with the lock held and the VM can be looked at between batches. State, Err and Stop are guarded by the lock
+// too.
+//
+// The game reads the lines given to Input. Instead of blocking when there are none it leaves the runner
+// WaitingForInput, as a VM that waits for a line while it holds the lock would lock everyone else out.
+type Runner struct {
+	State RunState
+	Err   error
+	// Stop is asked before every instruction, if it is set, whether to pause at it instead of executing it.
+	Stop func() bool
+
+	lock   sync.Locker
+	engine *ThreadedVirtualMachine
+	input  *LineReader
+	wake   chan struct{}
+}
+
+// NewRunner prepares to run vm, which prints to output, under lock. The runner starts Running, but executes nothing
+// until Run is called.
+func NewRunner(vm *VirtualMachine, lock sync.Locker, output io.Writer) *Runner {
+	runner := &Runner{
+		State:  Running,
+		lock:   lock,
+		engine: NewThreaded(vm),
+		input:  &LineReader{},
+		wake:   make(chan struct{}, 1),
+	}
+	vm.SetIO(runner.input, output)
+	return runner
+}
+
+// Run executes the VM whenever the runner is Running, until quit is closed.
+func (runner *Runner) Run(quit <-chan struct{}) {
+	for {
+		runner.lock.Lock()
+		for i := 0; i < runBatch && runner.State == Running; i++ {
+			runner.Step()
+		}
+		isRunning := runner.State == Running
+		runner.lock.Unlock()
+
+		if isRunning {
+			select {
+			case <-quit:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-runner.wake:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Step executes one instruction, unless Stop says to pause at it. Call with the lock held.
+func (runner *Runner) Step() {
+	if runner.Stop != nil && runner.Stop() {
+		runner.State = Paused
+		return
+	}
+
+	done, err := runner.engine.Step()
+	switch {
+	case errors.Is(err, io.EOF):
+		runner.State = WaitingForInput
+	case err != nil:
+		runner.State, runner.Err = Failed, err
+	case done:
+		runner.State = Halted
+	}
+}
+
+// Wake lets Run know that State may have changed. Call it after setting State to Running.
+func (runner *Runner) Wake() {
+	select {
+	case runner.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Input queues line for the game, which reads it as if it was typed, and has a runner that waited for it continue.
+// Call with the lock held.
+func (runner *Runner) Input(line string) {
+	runner.input.Add(line)
+	if runner.State == WaitingForInput {
+		runner.State = Running
+		runner.Wake()
+	}
+}
+
+// LineReader hands a VM the lines added so far and reports io.EOF when there are none, so that the VM never blocks
+// waiting for input. Lines can be added from any goroutine.
+type LineReader struct {
+	mu      sync.Mutex
+	pending []byte
+}
+
+// Add queues line, which should end with a line feed.
+func (reader *LineReader) Add(line string) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	reader.pending = append(reader.pending, line...)
+}
+
+func (reader *LineReader) Read(buffer []byte) (int, error) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	if len(reader.pending) == 0 {
+		return 0, io.EOF
+	}
+	read := copy(buffer, reader.pending)
+	reader.pending = reader.pending[read:]
+	return read, nil
+}
@@ -0,0 +1,57 @@
+package VirtualMachine_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestRunner(t *testing.T) {
+	// Echoes a line, then halts.
+	vm := VirtualMachine.New(assembler.MustAssemble(`
+	loop:
+		in r0
+		out r0
+		eq r1 r0 10
+		jf r1 loop
+		halt`))
+	var lock sync.Mutex
+	output := strings.Builder{}
+	runner := VirtualMachine.NewRunner(vm, &lock, &output)
+	quit := make(chan struct{})
+	defer close(quit)
+	go runner.Run(quit)
+
+	waitFor := func(expected VirtualMachine.RunState) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			lock.Lock()
+			current := runner.State
+			lock.Unlock()
+			if current == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the runner to be %v, it is %v", expected, current)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor(VirtualMachine.WaitingForInput)
+	lock.Lock()
+	runner.Input("ok\n")
+	lock.Unlock()
+	waitFor(VirtualMachine.Halted)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if output.String() != "ok\n" {
+		t.Errorf("expected the line echoed, got %q", output.String())
+	}
+}
@@ -0,0 +1,168 @@
+package VirtualMachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Session is a recording of everything a VM took from its input, from which Replay reproduces the same output and
+// state.
+type Session struct {
+	// The state recording started from, as returned by Snapshot.
+	Start  json.RawMessage `json:"start"`
+	Events []Event         `json:"events"`
+}
+
+// Event is either a byte read by the in instruction or a command that changed the VM from outside the game: one of the
+// input hacks, or a meta-command passed to RecordCommand.
+type Event struct {
+	// Instructions executed since recording started, before the in instruction that read the event.
+	Step    uint64 `json:"step"`
+	Byte    byte   `json:"byte,omitempty"`
+	Command string `json:"command,omitempty"`
+	// What the command printed, and the state it left behind.
+	Output string          `json:"output,omitempty"`
+	State  json.RawMessage `json:"state,omitempty"`
+}
+
+type replay struct {
+	events []Event
+	next   int
+	start  uint64
+}
+
+type ReplayError struct {
+	Step  uint64
+	Event Event
+}
+
+func (err *ReplayError) Error() string {
+	return fmt.Sprintf("replay diverged: input was read at step %v, but the session has it at step %v", err.Step, err.Event.Step)
+}
+
+// StartRecording makes the VM record a Session from its current state.
+func (vm *VirtualMachine) StartRecording() error {
+	start, err := vm.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	vm.session = &Session{Start: start, Events: []Event{}}
+	vm.recordingStart = vm.Steps
+	return nil
+}
+
+// StopRecording returns the Session recorded since StartRecording, or nil if the VM is not recording.
+func (vm *VirtualMachine) StopRecording() *Session {
+	session := vm.session
+	vm.session = nil
+	return session
+}
+
+// RecordCommand adds a command that changed the VM to the Session being recorded, together with the state it left the
+// VM in. Does nothing if the VM is not recording.
+func (vm *VirtualMachine) RecordCommand(command string) {
+	vm.recordCommand(command, "")
+}
+
+func (vm *VirtualMachine) recordCommand(command string, output string) {
+	if vm.session == nil {
+		return
+	}
+
+	state, err := vm.Snapshot()
+	if err != nil {
+		// A VM always turns into JSON.
+		panic(err)
+	}
+	vm.session.Events = append(vm.session.Events, Event{
+		Step:    vm.Steps - vm.recordingStart,
+		Command: command,
+		Output:  output,
+		State:   state,
+	})
+}
+
+func (vm *VirtualMachine) recordInput(input byte) {
+	if vm.session == nil {
+		return
+	}
+	vm.session.Events = append(vm.session.Events, Event{Step: vm.Steps - vm.recordingStart, Byte: input})
+}
+
+// Replay restores the state session started from and feeds its events to the in instruction as the VM runs, in place of
+// the input. Commands in session are not run again: the VM prints what they printed and takes on the state they left.
+// Once every event has been read the VM goes back to its input.
+func (vm *VirtualMachine) Replay(session *Session) error {
+	if err := vm.Restore(session.Start); err != nil {
+		return err
+	}
+
+	vm.inputBuffer = []byte{}
+	vm.replay = &replay{events: session.Events, start: vm.Steps}
+	return nil
+}
+
+// Replaying reports whether there are events of a Replay left to read.
+func (vm *VirtualMachine) Replaying() bool {
+	return vm.replay != nil
+}
+
+// StopReplay drops the events of a Replay that have not been read yet, so the VM reads from its input instead.
+func (vm *VirtualMachine) StopReplay() {
+	vm.replay = nil
+}
+
+func (vm *VirtualMachine) replayIn(a uint16) error {
+	replay := vm.replay
+	for replay.next < len(replay.events) {
+		event := replay.events[replay.next]
+		if step := vm.Steps - replay.start; event.Step != step {
+			return &ReplayError{Step: step, Event: event}
+		}
+		replay.next++
+
+		if event.State == nil {
+			vm.recordInput(event.Byte)
+			vm.write(a, uint16(event.Byte))
+			vm.Index += 2
+			if replay.next == len(replay.events) {
+				vm.replay = nil
+			}
+			return nil
+		}
+
+		fmt.Fprint(vm.output, event.Output)
+		if err := vm.Restore(event.State); err != nil {
+			return err
+		}
+		vm.recordCommand(event.Command, event.Output)
+	}
+
+	vm.replay = nil
+	return vm.in(a)
+}
+
+// Save writes the session to filePath as JSON.
+func (session *Session) Save(filePath string) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0777)
+}
+
+// LoadSession reads a Session written by Save.
+func LoadSession(filePath string) (*Session, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
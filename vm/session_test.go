@@ -0,0 +1,96 @@
+package VirtualMachine_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Echoes its input until it reads a q, adding every character to r0 and pushing it.
+var echo = assembler.MustAssemble(`
+	loop: in r1
+	eq r2 r1 'q'
+	jt r2 done
+	out r1
+	add r0 r0 r1
+	push r1
+	jmp loop
+	done: halt`)
+
+func record(t *testing.T, input string) (*VirtualMachine.Session, *VirtualMachine.VirtualMachine, string) {
+	vm := VirtualMachine.New(echo)
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader(input), &output)
+
+	if err := vm.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Run(); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	return vm.StopRecording(), vm, output.String()
+}
+
+func TestReplay(t *testing.T) {
+	session, recorded, recordedOutput := record(t, "ab\nset 42\nget\nhack teleporter\ncd\nq")
+
+	vm := VirtualMachine.New(nil)
+	output := strings.Builder{}
+	// Replaying must not read from the input.
+	vm.SetIO(strings.NewReader("x"), &output)
+	if err := vm.Replay(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != recordedOutput {
+		t.Errorf("expected output %q, got %q", recordedOutput, output.String())
+	}
+	if !vm.Memory.Equal(&recorded.Memory) || vm.Register != recorded.Register || vm.Index != recorded.Index || vm.Steps != recorded.Steps {
+		t.Errorf("expected registers %v at index %v after %v steps, got %v at %v after %v",
+			recorded.Register, recorded.Index, recorded.Steps, vm.Register, vm.Index, vm.Steps)
+	}
+	if expected, got := drain(&recorded.Stack), drain(&vm.Stack); !equal(expected, got) {
+		t.Errorf("expected stack %v, got %v", expected, got)
+	}
+}
+
+func TestReplayThenInput(t *testing.T) {
+	session, _, _ := record(t, "ab")
+
+	vm := VirtualMachine.New(nil)
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader("cq"), &output)
+	if err := vm.Replay(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := VirtualMachine.NewThreaded(vm).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != "abc" {
+		t.Errorf("expected the replay followed by the input, got %q", output.String())
+	}
+}
+
+func TestReplayDiverges(t *testing.T) {
+	session, _, _ := record(t, "abq")
+	session.Events[1].Step++
+
+	vm := VirtualMachine.New(nil)
+	vm.SetIO(strings.NewReader(""), &strings.Builder{})
+	if err := vm.Replay(session); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayError *VirtualMachine.ReplayError
+	if err := vm.Run(); !errors.As(err, &replayError) || replayError.Step != 7 {
+		t.Errorf("expected a ReplayError at step 7, got %v", err)
+	}
+}
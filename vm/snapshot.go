@@ -0,0 +1,88 @@
+package VirtualMachine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Snapshot returns Memory, Register, Stack and Index as JSON, the format the save state command writes.
+func (vm *VirtualMachine) Snapshot() ([]byte, error) {
+	return json.Marshal(vm)
+}
+
+// Restore replaces Memory, Register, Stack and Index with a state returned by Snapshot. The VM is left as it was if
+// snapshot cannot be read.
+func (vm *VirtualMachine) Restore(snapshot []byte) error {
+	state := VirtualMachine{}
+	if err := json.Unmarshal(snapshot, &state); err != nil {
+		return err
+	}
+
+	vm.Memory = state.Memory
+	vm.Register = state.Register
+	vm.Stack = state.Stack
+	vm.Index = state.Index
+	vm.generation++
+	// The memory the code map describes is gone.
+	if vm.codeMap != nil {
+		vm.codeMap.Reset()
+	}
+	return nil
+}
+
+// SaveState writes a Snapshot to filePath.
+func (vm *VirtualMachine) SaveState(filePath string) error {
+	snapshot, err := vm.Snapshot()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, snapshot, 0777)
+}
+
+// LoadState restores the VM from a file written by SaveState.
+func (vm *VirtualMachine) LoadState(filePath string) error {
+	snapshot, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return vm.Restore(snapshot)
+}
+
+// Clone returns a copy of the VM that shares Memory and Stack with it until either of them writes to them, so a fork
+// costs little more than the pages it changes. The copy starts with the same Register, Index, Steps and hooks, with the
+// hacks on or off like the VM and with the input the VM has read but not executed yet. Beyond that it reads nothing
+// and writes to io.Discard until SetIO is called. Sessions, replays, observers, commands and code maps stay with the
+// original.
+//
+// Clone the VM on the goroutine that runs it. The copy can then run on any goroutine.
+func (vm *VirtualMachine) Clone() *VirtualMachine {
+	pending := []byte{}
+	if vm.input != nil {
+		buffered, _ := vm.input.Peek(vm.input.Buffered())
+		pending = append(pending, buffered...)
+	}
+
+	// in only ever moves past the start of inputBuffer or replaces it, so the clone can share it.
+	clone := &VirtualMachine{
+		Memory:        vm.Memory.Clone(),
+		Register:      vm.Register,
+		Stack:         vm.Stack.Clone(),
+		Index:         vm.Index,
+		Steps:         vm.Steps,
+		opArgs:        vm.opArgs,
+		inputBuffer:   vm.inputBuffer,
+		input:         bufio.NewReader(bytes.NewReader(pending)),
+		output:        io.Discard,
+		hacksDisabled: vm.hacksDisabled,
+	}
+	if len(vm.hooks) > 0 {
+		clone.hooks = make(map[uint16]Hook, len(vm.hooks))
+		for address, hook := range vm.hooks {
+			clone.hooks[address] = hook
+		}
+	}
+	return clone
+}
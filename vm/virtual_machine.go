@@ -3,8 +3,9 @@ package VirtualMachine
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -14,37 +15,122 @@ import (
 // Improvements:
 // 	- Make switch/case into a hashmap of functions
 //	- Make registry into a hashmap starting from 32768 to 32775 (so there's no need for conversions)
-// 	- Add unit tests for all commands
 
 type VirtualMachine struct {
 	// 15 bit address space Memory
-	Memory [32768]uint16 `json:"memory"`
+	Memory Memory `json:"memory"`
 	// Register set with 8 slots
 	Register [8]uint16 `json:"register"`
 	// Unbounded Stack
 	Stack Stack `json:"stack"`
 	// Program counter
-	Index       uint16 `json:"index"`
-	opArgs      map[uint16]uint16
-	inputBuffer []byte
+	Index uint16 `json:"index"`
+	// Number of instructions executed so far, which saved states leave alone
+	Steps          uint64 `json:"-"`
+	opArgs         map[uint16]uint16
+	inputBuffer    []byte
+	input          *bufio.Reader
+	output         io.Writer
+	hooks          map[uint16]Hook
+	session        *Session
+	recordingStart uint64
+	replay         *replay
+	observers      []OutputObserver
+	commands       map[string]Command
+	codeMap        *CodeMap
+	hacksDisabled  bool
+	// Changes whenever Memory may have changed other than through an instruction, so that the threaded engine knows
+	// to decode it again.
+	generation uint64
+	// Operands of the instruction being executed, so that decoding does not allocate.
+	operands [3]uint16
 }
 
 type Stack struct {
 	inner []uint16
+	// Set once a clone shares inner, which is then copied before the next push.
+	shared bool
 }
 
-func (stack *Stack) push(arg uint16) {
+// Len returns the number of values on the stack.
+func (stack *Stack) Len() int {
+	return len(stack.inner)
+}
+
+// Values returns a copy of the values on the stack, bottom first.
+func (stack *Stack) Values() []uint16 {
+	return append([]uint16{}, stack.inner...)
+}
+
+func (stack *Stack) Push(arg uint16) {
+	if stack.shared {
+		stack.inner = append(make([]uint16, 0, cap(stack.inner)), stack.inner...)
+		stack.shared = false
+	}
 	stack.inner = append(stack.inner, arg)
 }
 
+// Clone returns a copy of stack that shares its values with it until either of them pushes. Popping only shortens the
+// slice, so it leaves the shared values alone.
+func (stack *Stack) Clone() Stack {
+	stack.shared = true
+	return Stack{inner: stack.inner, shared: true}
+}
+
 type EmptyStackError struct{}
 
 func (err *EmptyStackError) Error() string {
 	return "Stack is empty, application should halt"
 }
 
-// Returns the value from the top of the stack. If a value is returned from the stack, also returns true, otherwise false.
-func (stack *Stack) pop() (uint16, error) {
+// MarshalJSON stores the stack as a list of values, bottom first, so that saved states keep it.
+func (stack Stack) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stack.inner)
+}
+
+func (stack *Stack) UnmarshalJSON(data []byte) error {
+	// States saved before the stack was stored have an empty object in its place.
+	if string(data) == "{}" {
+		stack.inner = []uint16{}
+		return nil
+	}
+
+	inner := []uint16{}
+	if err := json.Unmarshal(data, &inner); err != nil {
+		return err
+	}
+	stack.inner = inner
+	return nil
+}
+
+type InvalidAddressError struct {
+	Address uint16
+	Index   uint16
+}
+
+func (err *InvalidAddressError) Error() string {
+	return fmt.Sprintf("Invalid address: %v at index %v", err.Address, err.Index)
+}
+
+type InvalidNumberError struct {
+	Value uint16
+	Index uint16
+}
+
+func (err *InvalidNumberError) Error() string {
+	return fmt.Sprintf("Invalid number: %v at index %v", err.Value, err.Index)
+}
+
+type DivisionByZeroError struct {
+	Index uint16
+}
+
+func (err *DivisionByZeroError) Error() string {
+	return fmt.Sprintf("Division by zero at index %v", err.Index)
+}
+
+// Returns the value from the top of the stack, or an EmptyStackError if there is none.
+func (stack *Stack) Pop() (uint16, error) {
 	if len(stack.inner) == 0 {
 		return 0, &EmptyStackError{}
 	}
@@ -55,168 +141,242 @@ func (stack *Stack) pop() (uint16, error) {
 }
 
 // checks whether address refers to the VM registry, and writes it either to the registry or the corresponding Memory address.
+// val is written as is: callers have already resolved it, and a value read from Memory may look like a register.
 func (vm *VirtualMachine) write(address uint16, val uint16) {
 	if index, ok := tryGetRegistryAddress(address); ok {
-		vm.Register[index] = vm.tryGetRegistryValue(val)
+		vm.Register[index] = val
 	} else {
-		vm.Memory[address] = vm.tryGetRegistryValue(val)
+		vm.setMemory(address, val)
 	}
 }
 
-func Load(file *os.File) (*VirtualMachine, error) {
-	vm := VirtualMachine{
-		Memory:   [32768]uint16{},
-		Register: [8]uint16{},
-		Stack:    Stack{inner: []uint16{}},
-		opArgs: map[uint16]uint16{
-			0:  0,
-			1:  2,
-			2:  1,
-			3:  1,
-			4:  3,
-			5:  3,
-			6:  1,
-			7:  2,
-			8:  2,
-			9:  3,
-			10: 3,
-			11: 3,
-			12: 3,
-			13: 3,
-			14: 2,
-			15: 2,
-			16: 2,
-			17: 1,
-			18: 0,
-			19: 1,
-			20: 1,
-			21: 0,
-		},
-		inputBuffer: []byte{},
+// Patch writes values to Memory from address on, dropping those that would go past its end. Unlike writing to Memory
+// directly, the writes are seen by the code map and have the engines decode the patched code again.
+func (vm *VirtualMachine) Patch(address uint16, values []uint16) {
+	for i, value := range values {
+		if int(address)+i >= MemorySize {
+			break
+		}
+		vm.setMemory(address+uint16(i), value)
 	}
+	vm.generation++
+}
+
+// New creates a VirtualMachine with program copied to the start of its Memory.
+func New(program []uint16) *VirtualMachine {
+	vm := newVirtualMachine()
+	vm.Memory.Copy(0, program)
+	return vm
+}
+
+func Load(file *os.File) (*VirtualMachine, error) {
+	vm := newVirtualMachine()
 	err := vm.load(file)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &vm, nil
+	return vm, nil
+}
+
+func newVirtualMachine() *VirtualMachine {
+	return &VirtualMachine{
+		Register:    [8]uint16{},
+		Stack:       Stack{inner: []uint16{}},
+		opArgs:      OpArgs,
+		inputBuffer: []byte{},
+		input:       bufio.NewReader(os.Stdin),
+		output:      os.Stdout,
+	}
+}
+
+// SetIO replaces the terminal the guest reads from and writes to, which is os.Stdin and os.Stdout by default.
+func (vm *VirtualMachine) SetIO(input io.Reader, output io.Writer) {
+	vm.input = bufio.NewReader(input)
+	vm.output = output
+}
+
+// Returned by the halt command to stop the VM.
+var errHalted = errors.New("halted")
+
+// Every command executes one instruction and moves Index past it, or to wherever it jumps.
+var commands = map[uint16]func(vm *VirtualMachine, operands []uint16) error{
+	0: func(vm *VirtualMachine, operands []uint16) error {
+		return errHalted
+	},
+	1: func(vm *VirtualMachine, operands []uint16) error {
+		vm.set(operands[0], operands[1])
+		return nil
+	},
+	2: func(vm *VirtualMachine, operands []uint16) error {
+		vm.push(operands[0])
+		return nil
+	},
+	3: func(vm *VirtualMachine, operands []uint16) error {
+		if err := vm.pop(operands[0]); err != nil {
+			return err
+		}
+		return nil
+	},
+	4: func(vm *VirtualMachine, operands []uint16) error {
+		vm.eq(operands[0], operands[1], operands[2])
+		return nil
+	},
+	5: func(vm *VirtualMachine, operands []uint16) error {
+		vm.gt(operands[0], operands[1], operands[2])
+		return nil
+	},
+	6: func(vm *VirtualMachine, operands []uint16) error {
+		vm.jmp(operands[0])
+		return nil
+	},
+	7: func(vm *VirtualMachine, operands []uint16) error {
+		vm.jt(operands[0], operands[1])
+		return nil
+	},
+	8: func(vm *VirtualMachine, operands []uint16) error {
+		vm.jf(operands[0], operands[1])
+		return nil
+	},
+	9: func(vm *VirtualMachine, operands []uint16) error {
+		vm.add(operands[0], operands[1], operands[2])
+		return nil
+	},
+	10: func(vm *VirtualMachine, operands []uint16) error {
+		vm.mult(operands[0], operands[1], operands[2])
+		return nil
+	},
+	11: func(vm *VirtualMachine, operands []uint16) error {
+		return vm.mod(operands[0], operands[1], operands[2])
+	},
+	12: func(vm *VirtualMachine, operands []uint16) error {
+		vm.and(operands[0], operands[1], operands[2])
+		return nil
+	},
+	13: func(vm *VirtualMachine, operands []uint16) error {
+		vm.or(operands[0], operands[1], operands[2])
+		return nil
+	},
+	14: func(vm *VirtualMachine, operands []uint16) error {
+		vm.not(operands[0], operands[1])
+		return nil
+	},
+	15: func(vm *VirtualMachine, operands []uint16) error {
+		return vm.rmem(operands[0], operands[1])
+	},
+	16: func(vm *VirtualMachine, operands []uint16) error {
+		return vm.wmem(operands[0], operands[1])
+	},
+	17: func(vm *VirtualMachine, operands []uint16) error {
+		vm.call(operands[0])
+		return nil
+	},
+	18: func(vm *VirtualMachine, operands []uint16) error {
+		if err := vm.ret(); err != nil {
+			return err
+		}
+		return nil
+	},
+	19: func(vm *VirtualMachine, operands []uint16) error {
+		vm.out(operands[0])
+		return nil
+	},
+	20: func(vm *VirtualMachine, operands []uint16) error {
+		return vm.in(operands[0])
+	},
+	21: func(vm *VirtualMachine, operands []uint16) error { // no-op
+		vm.Index++
+		return nil
+	},
 }
 
-func (vm *VirtualMachine) Run() error {
+func (vm *VirtualMachine) Run() (err error) {
 	defer func() {
-		fmt.Printf("Fault index: %v\n", vm.Index)
+		if err != nil {
+			fmt.Printf("Fault index: %v\n", vm.Index)
+		}
 	}()
 
-	commands := map[uint16]func(operands []uint16) error{
-		0: func(operands []uint16) error {
-			return nil
-		},
-		1: func(operands []uint16) error {
-			vm.set(operands[0], operands[1])
-			return nil
-		},
-		2: func(operands []uint16) error {
-			vm.push(operands[0])
-			return nil
-		},
-		3: func(operands []uint16) error {
-			if err := vm.pop(operands[0]); err != nil {
-				return err
-			}
-			return nil
-		},
-		4: func(operands []uint16) error {
-			vm.eq(operands[0], operands[1], operands[2])
-			return nil
-		},
-		5: func(operands []uint16) error {
-			vm.gt(operands[0], operands[1], operands[2])
-			return nil
-		},
-		6: func(operands []uint16) error {
-			vm.jmp(operands[0])
-			return nil
-		},
-		7: func(operands []uint16) error {
-			vm.jt(operands[0], operands[1])
-			return nil
-		},
-		8: func(operands []uint16) error {
-			vm.jf(operands[0], operands[1])
-			return nil
-		},
-		9: func(operands []uint16) error {
-			vm.add(operands[0], operands[1], operands[2])
-			return nil
-		},
-		10: func(operands []uint16) error {
-			vm.mult(operands[0], operands[1], operands[2])
-			return nil
-		},
-		11: func(operands []uint16) error {
-			vm.mod(operands[0], operands[1], operands[2])
-			return nil
-		},
-		12: func(operands []uint16) error {
-			vm.and(operands[0], operands[1], operands[2])
-			return nil
-		},
-		13: func(operands []uint16) error {
-			vm.or(operands[0], operands[1], operands[2])
-			return nil
-		},
-		14: func(operands []uint16) error {
-			vm.not(operands[0], operands[1])
-			return nil
-		},
-		15: func(operands []uint16) error {
-			vm.rmem(operands[0], operands[1])
-			return nil
-		},
-		16: func(operands []uint16) error {
-			vm.wmem(operands[0], operands[1])
-			return nil
-		},
-		17: func(operands []uint16) error {
-			vm.call(operands[0])
+	for {
+		halted, err := vm.Step()
+		if err != nil {
+			return err
+		}
+		if halted {
 			return nil
-		},
-		18: func(operands []uint16) error {
-			if err := vm.ret(); err != nil {
-				return err
+		}
+	}
+}
+
+// Step executes the instruction at Index, or the hook registered there. Returns true once the VM has halted, which
+// leaves Index on the halt instruction.
+func (vm *VirtualMachine) Step() (bool, error) {
+	if len(vm.hooks) > 0 {
+		if hooked, err := vm.runHook(); hooked {
+			if err == nil {
+				vm.Steps++
 			}
-			return nil
-		},
-		19: func(operands []uint16) error {
-			vm.out(operands[0])
-			return nil
-		},
-		20: func(operands []uint16) error {
-			vm.in(operands[0])
-			return nil
-		},
-		21: func(operands []uint16) error { // no-op
-			vm.Index++
-			return nil
-		},
+			return false, err
+		}
 	}
 
-	for {
-		op := vm.Memory[vm.Index]
+	op, operands, err := vm.decode()
+	if err != nil {
+		return false, err
+	}
+	if vm.codeMap != nil {
+		vm.codeMap.execute(vm, 1+uint16(len(operands)))
+	}
 
-		// Prepare operands, get from registry if necessary
-		var operands []uint16
-		if vm.opArgs[op] > 0 {
-			operands = vm.Memory[vm.Index+1 : vm.Index+vm.opArgs[op]+1]
-		}
+	err = commands[op](vm, operands)
 
-		err := commands[op](operands)
+	if err == errHalted {
+		vm.Steps++
+		return true, nil
+	}
+	if err == nil {
+		vm.Steps++
+	}
+	return false, err
+}
 
-		if err != nil {
-			return err
+// Returns the operation at Index and its operands, or an error if the instruction cannot be executed.
+func (vm *VirtualMachine) decode() (uint16, []uint16, error) {
+	if err := checkInstruction(&vm.Memory, vm.Index); err != nil {
+		return 0, nil, err
+	}
+
+	op := vm.Memory.Get(vm.Index)
+	operands := vm.operands[:vm.opArgs[op]]
+	for i := range operands {
+		operands[i] = vm.Memory.Get(vm.Index + 1 + uint16(i))
+	}
+	return op, operands, nil
+}
+
+// Checks that the instruction at address is a known operation that fits in memory, and that none of its operands is
+// above the last register.
+func checkInstruction(memory *Memory, address uint16) error {
+	if int(address) >= MemorySize {
+		return &InvalidAddressError{Address: address, Index: address}
+	}
+
+	op := memory.Get(address)
+	args, ok := OpArgs[op]
+	if !ok {
+		return &UnknownOperationError{Op: op, Index: address}
+	}
+	if int(address)+int(args) >= MemorySize {
+		return &InvalidAddressError{Address: MemorySize, Index: address}
+	}
+
+	for i := uint16(1); i <= args; i++ {
+		if operand := memory.Get(address + i); operand > 32775 {
+			return &InvalidNumberError{Value: operand, Index: address}
 		}
 	}
+	return nil
 }
 
 // returns the registry address, or the default value (passed in value) if arg is not a registry address.
@@ -240,20 +400,19 @@ func (vm *VirtualMachine) tryGetRegistryValue(arg uint16) uint16 {
 }
 
 // set Register <a> to the value of <b>
-func (vm *VirtualMachine) set(index uint16, b uint16) {
-	index, _ = tryGetRegistryAddress(index)
-	vm.Register[index] = vm.tryGetRegistryValue(b)
+func (vm *VirtualMachine) set(a uint16, b uint16) {
+	vm.write(a, vm.tryGetRegistryValue(b))
 	vm.Index += 3
 }
 
 func (vm *VirtualMachine) push(a uint16) {
-	vm.Stack.push(vm.tryGetRegistryValue(a))
+	vm.Stack.Push(vm.tryGetRegistryValue(a))
 	vm.Index += 2
 }
 
 // remove the top element from the Stack and write it into <a>; empty Stack = error
 func (vm *VirtualMachine) pop(a uint16) error {
-	val, err := vm.Stack.pop()
+	val, err := vm.Stack.Pop()
 
 	if err != nil {
 		return err
@@ -312,23 +471,26 @@ func (vm *VirtualMachine) jf(a uint16, b uint16) {
 
 // assign into <a> the sum of <b> and <c> (modulo 32768)
 func (vm *VirtualMachine) add(a uint16, b uint16, c uint16) {
-	index, _ := tryGetRegistryAddress(a)
-	vm.Register[index] = (vm.tryGetRegistryValue(b) + vm.tryGetRegistryValue(c)) % 32768
+	vm.write(a, (vm.tryGetRegistryValue(b)+vm.tryGetRegistryValue(c))%32768)
 	vm.Index += 4
 }
 
 // store into <a> the product of <b> and <c> (modulo 32768)
 func (vm *VirtualMachine) mult(a uint16, b uint16, c uint16) {
-	index, _ := tryGetRegistryAddress(a)
-	vm.Register[index] = (vm.tryGetRegistryValue(b) * vm.tryGetRegistryValue(c)) % 32768
+	vm.write(a, (vm.tryGetRegistryValue(b)*vm.tryGetRegistryValue(c))%32768)
 	vm.Index += 4
 }
 
 // store into <a> the remainder of <b> divided by <c>
-func (vm *VirtualMachine) mod(a uint16, b uint16, c uint16) {
-	index, _ := tryGetRegistryAddress(a)
-	vm.Register[index] = vm.tryGetRegistryValue(b) % vm.tryGetRegistryValue(c)
+func (vm *VirtualMachine) mod(a uint16, b uint16, c uint16) error {
+	divisor := vm.tryGetRegistryValue(c)
+	if divisor == 0 {
+		return &DivisionByZeroError{Index: vm.Index}
+	}
+
+	vm.write(a, vm.tryGetRegistryValue(b)%divisor)
 	vm.Index += 4
+	return nil
 }
 
 // stores into <a> the bitwise and of <b> and <c>
@@ -356,33 +518,38 @@ func (vm *VirtualMachine) not(a uint16, b uint16) {
 }
 
 // read Memory at address <b> and write it to <a>
-func (vm *VirtualMachine) rmem(a uint16, b uint16) {
-	var val uint16
-	if adr, isRegistry := tryGetRegistryAddress(b); isRegistry {
-		val = vm.Memory[vm.Register[adr]]
-	} else {
-		val = vm.Memory[b]
+func (vm *VirtualMachine) rmem(a uint16, b uint16) error {
+	address := vm.tryGetRegistryValue(b)
+	if int(address) >= MemorySize {
+		return &InvalidAddressError{Address: address, Index: vm.Index}
 	}
 
-	vm.write(a, val)
+	vm.write(a, vm.Memory.Get(address))
 	vm.Index += 3
+	return nil
 }
 
 // write the value from <b> into Memory at address <a>
-func (vm *VirtualMachine) wmem(a uint16, b uint16) {
-	vm.Memory[vm.tryGetRegistryValue(a)] = vm.tryGetRegistryValue(b)
+func (vm *VirtualMachine) wmem(a uint16, b uint16) error {
+	address := vm.tryGetRegistryValue(a)
+	if int(address) >= MemorySize {
+		return &InvalidAddressError{Address: address, Index: vm.Index}
+	}
+
+	vm.setMemory(address, vm.tryGetRegistryValue(b))
 	vm.Index += 3
+	return nil
 }
 
 // write the address of the next instruction to the Stack and jump to <a>
 func (vm *VirtualMachine) call(a uint16) {
-	vm.Stack.push(vm.Index + 2)
+	vm.Stack.Push(vm.Index + 2)
 	vm.jmp(a)
 }
 
 // remove the top element from the Stack and jump to it; empty Stack = halt
 func (vm *VirtualMachine) ret() error {
-	val, err := vm.Stack.pop()
+	val, err := vm.Stack.Pop()
 
 	if err != nil {
 		return err
@@ -393,99 +560,107 @@ func (vm *VirtualMachine) ret() error {
 }
 
 // read a character from the terminal and write its ascii code to <a>
-func (vm *VirtualMachine) in(a uint16) {
+func (vm *VirtualMachine) in(a uint16) error {
+	if vm.replay != nil {
+		return vm.replayIn(a)
+	}
+
 	if len(vm.inputBuffer) == 0 {
-		reader := bufio.NewReader(os.Stdin)
-		buffer, err := reader.ReadBytes('\n')
+		buffer, err := vm.input.ReadBytes('\n')
 
-		if err != nil {
-			fmt.Println("Could not read keyboard input.")
-			panic(err)
+		if err != nil && len(buffer) == 0 {
+			return err
 		}
 
 		vm.inputBuffer = buffer
+
+		// Hacks and commands take up a whole line, so they are only looked for as the line starts and not in what is
+		// left of it once the guest has read part of it.
+		line := string(vm.inputBuffer)
+		output := vm.output
+		printed := strings.Builder{}
+		if vm.session != nil {
+			vm.output = io.MultiWriter(output, &printed)
+		}
+		hacked := vm.hack(line)
+		vm.output = output
+
+		if hacked {
+			vm.generation++
+			vm.recordCommand(strings.TrimSpace(line), printed.String())
+			vm.inputBuffer = []byte{}
+			return vm.in(a)
+		}
 	}
 
-	// Hacks
-	strVal := string(vm.inputBuffer)
-	if strings.Contains(strVal, "set") {
-		strVal = strings.Trim(strVal, "\n")
-		integer, _ := strconv.ParseUint(strings.Split(strVal, " ")[1], 10, 16)
-		vm.Register[7] = uint16(integer)
-		vm.inputBuffer = []byte{}
-		vm.in(a)
-		return
+	vm.recordInput(vm.inputBuffer[0])
+	vm.write(a, uint16(vm.inputBuffer[0]))
+	vm.inputBuffer = vm.inputBuffer[1:]
+
+	vm.Index += 2
+	return nil
+}
+
+// Runs the command in line if it is one of the hacks, and reports whether it was.
+func (vm *VirtualMachine) hack(line string) bool {
+	fields := strings.Fields(line)
+	if vm.runCommand(fields) {
+		return true
 	}
-	if strings.Contains(strVal, "get") {
-		fmt.Printf("R8: %v\n", vm.Register[7])
-		vm.inputBuffer = []byte{}
-		vm.in(a)
-		return
+	if vm.hacksDisabled {
+		return false
+	}
+	if strings.Contains(line, "set") {
+		if len(fields) > 1 {
+			integer, _ := strconv.ParseUint(fields[1], 10, 16)
+			vm.Register[7] = uint16(integer)
+		}
+		return true
+	}
+	if strings.Contains(line, "get") {
+		fmt.Fprintf(vm.output, "R8: %v\n", vm.Register[7])
+		return true
 	}
 
-	if strings.Contains(strVal, "hack teleporter") {
-		fmt.Printf("Applying hacks...")
+	if strings.Contains(line, "hack teleporter") {
+		fmt.Fprintf(vm.output, "Applying hacks...")
 		vm.Register[7] = 25734
 		vm.Register[1] = 6
 		for i := 5489; i < 5495; i++ {
-			vm.Memory[i] = 21 // set to noop
+			vm.Memory.Set(uint16(i), 21) // set to noop
 		}
-
-		vm.inputBuffer = []byte{}
-		vm.in(a)
-		return
+		return true
 	}
 
 	// save state synacor_1
-	if strings.Contains(strVal, "save state") {
-		filePath := strings.Trim(strings.Split(strVal, " ")[2], "\n")
-		vmJson, err := json.Marshal(vm)
-
-		if err != nil {
-			log.Fatal("Could not save state", err)
+	if strings.Contains(line, "save state") && len(fields) > 2 {
+		filePath := fields[2]
+		if err := vm.SaveState(filePath); err != nil {
+			fmt.Fprintln(vm.output, "Could not save state", err)
+		} else {
+			fmt.Fprintln(vm.output, "Saved state to", filePath)
 		}
-		err = os.WriteFile(filePath, vmJson, 0777)
-
-		if err != nil {
-			log.Fatal("Could not save state", err)
-		}
-		fmt.Println("Saved state to", filePath)
-
-		vm.inputBuffer = []byte{}
-		vm.in(a)
-		return
+		return true
 	}
 
 	// load state synacor_1
-	if strings.Contains(strVal, "load state") {
-		filePath := strings.Trim(strings.Split(strVal, " ")[2], "\n")
-		file, err := os.ReadFile(filePath)
-
-		if err != nil {
-			log.Fatal("Could not load state", err)
-		}
-
-		err = json.Unmarshal(file, vm)
-
-		if err != nil {
-			log.Fatal("Could not load state", err)
+	if strings.Contains(line, "load state") && len(fields) > 2 {
+		filePath := fields[2]
+		if err := vm.LoadState(filePath); err != nil {
+			fmt.Fprintln(vm.output, "Could not load state", err)
+		} else {
+			fmt.Fprintln(vm.output, "State loaded from", filePath)
 		}
-		fmt.Println("State loaded from", filePath)
-
-		vm.inputBuffer = []byte{}
-		vm.in(a)
-		return
+		return true
 	}
 
-	// End hacks
-	vm.write(a, uint16(vm.inputBuffer[0]))
-	vm.inputBuffer = vm.inputBuffer[1:]
-
-	vm.Index += 2
+	return false
 }
 
 // write the character represented by ascii code <a> to the terminal
 func (vm *VirtualMachine) out(a uint16) {
-	fmt.Printf("%c", vm.tryGetRegistryValue(a))
+	char := vm.tryGetRegistryValue(a)
+	fmt.Fprintf(vm.output, "%c", char)
+	vm.notify(char)
 	vm.Index += 2
 }
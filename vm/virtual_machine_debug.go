@@ -2,12 +2,14 @@ package VirtualMachine
 
 import (
 	"fmt"
+	"io"
 	"os"
 )
 
 type VirtualMachineDebugger struct {
 	inner     *VirtualMachine
 	outputLog bool
+	log       io.Writer
 }
 
 func LoadDebugger(file *os.File) (*VirtualMachineDebugger, error) {
@@ -16,100 +18,143 @@ func LoadDebugger(file *os.File) (*VirtualMachineDebugger, error) {
 		return nil, err
 	}
 
+	return NewDebugger(vm), nil
+}
+
+// NewDebugger wraps vm, continuing from its current state.
+func NewDebugger(vm *VirtualMachine) *VirtualMachineDebugger {
 	return &VirtualMachineDebugger{
 		inner: vm,
-	}, nil
+		log:   os.Stdout,
+	}
 }
 
-func (vm *VirtualMachineDebugger) Run() error {
+// SetLog replaces where the instruction log is written once the first input has been read, which is os.Stdout by
+// default.
+func (vm *VirtualMachineDebugger) SetLog(log io.Writer) {
+	vm.log = log
+}
+
+func (vm *VirtualMachineDebugger) Run() (err error) {
 	defer func() {
-		fmt.Printf("Fault index: %v\n", vm.inner.Index)
+		if err != nil {
+			fmt.Printf("Fault index: %v\n", vm.inner.Index)
+		}
 	}()
 
 	for {
-		op := vm.inner.Memory[vm.inner.Index]
-
-		// Prepare operands, get from registry if necessary
-		var operands []uint16
-		if vm.inner.opArgs[op] > 0 {
-			operands = vm.inner.Memory[vm.inner.Index+1 : vm.inner.Index+vm.inner.opArgs[op]+1]
+		halted, err := vm.Step()
+		if err != nil {
+			return err
 		}
-
-		switch op {
-		case 0: // stop
+		if halted {
 			return nil
-		case 1:
-			vm.set(operands[0], operands[1])
-			break
-		case 2:
-			vm.push(operands[0])
-			break
-		case 3:
-			if err := vm.pop(operands[0]); err != nil {
-				return err
-			}
-			break
-		case 4:
-			vm.eq(operands[0], operands[1], operands[2])
-			break
-		case 5:
-			vm.gt(operands[0], operands[1], operands[2])
-			break
-		case 6: // jmp
-			vm.jmp(operands[0])
-			break
-		case 7:
-			vm.jt(operands[0], operands[1])
-			break
-		case 8:
-			vm.jf(operands[0], operands[1])
-			break
-		case 9:
-			vm.add(operands[0], operands[1], operands[2])
-			break
-		case 10:
-			vm.mult(operands[0], operands[1], operands[2])
-			break
-		case 11:
-			vm.mod(operands[0], operands[1], operands[2])
-			break
-		case 12:
-			vm.and(operands[0], operands[1], operands[2])
-			break
-		case 13:
-			vm.or(operands[0], operands[1], operands[2])
-			break
-		case 14:
-			vm.not(operands[0], operands[1])
-			break
-		case 15:
-			vm.rmem(operands[0], operands[1])
-			break
-		case 16:
-			vm.wmem(operands[0], operands[1])
-			break
-		case 17:
-			vm.call(operands[0])
-			break
-		case 18:
-			if err := vm.ret(); err != nil {
-				return err
+		}
+	}
+}
+
+// Step logs and executes a single instruction. Returns true once the VM has halted.
+func (vm *VirtualMachineDebugger) Step() (bool, error) {
+	if len(vm.inner.hooks) > 0 {
+		if hooked, err := vm.inner.runHook(); hooked {
+			vm.print("hook", vm.inner.Index)
+			if err == nil {
+				vm.inner.Steps++
 			}
-			break
-		case 19:
-			vm.out(operands[0])
-			break
-		case 20:
-			vm.in(operands[0])
-			break
-		case 21: // no-op
-			vm.inner.Index++
-			break
-		default:
-			fmt.Printf("Unknown operation: %v at index %v\n", op, vm.inner.Index)
-			vm.inner.Index++
+			return false, err
+		}
+	}
+
+	op, operands, err := vm.inner.decode()
+	if err != nil {
+		return false, err
+	}
+	if vm.inner.codeMap != nil {
+		vm.inner.codeMap.execute(vm.inner, 1+uint16(len(operands)))
+	}
+
+	switch op {
+	case 0: // stop
+		vm.inner.Steps++
+		return true, nil
+	case 1:
+		vm.set(operands[0], operands[1])
+		break
+	case 2:
+		vm.push(operands[0])
+		break
+	case 3:
+		if err := vm.pop(operands[0]); err != nil {
+			return false, err
+		}
+		break
+	case 4:
+		vm.eq(operands[0], operands[1], operands[2])
+		break
+	case 5:
+		vm.gt(operands[0], operands[1], operands[2])
+		break
+	case 6: // jmp
+		vm.jmp(operands[0])
+		break
+	case 7:
+		vm.jt(operands[0], operands[1])
+		break
+	case 8:
+		vm.jf(operands[0], operands[1])
+		break
+	case 9:
+		vm.add(operands[0], operands[1], operands[2])
+		break
+	case 10:
+		vm.mult(operands[0], operands[1], operands[2])
+		break
+	case 11:
+		if err := vm.mod(operands[0], operands[1], operands[2]); err != nil {
+			return false, err
+		}
+		break
+	case 12:
+		vm.and(operands[0], operands[1], operands[2])
+		break
+	case 13:
+		vm.or(operands[0], operands[1], operands[2])
+		break
+	case 14:
+		vm.not(operands[0], operands[1])
+		break
+	case 15:
+		if err := vm.rmem(operands[0], operands[1]); err != nil {
+			return false, err
+		}
+		break
+	case 16:
+		if err := vm.wmem(operands[0], operands[1]); err != nil {
+			return false, err
+		}
+		break
+	case 17:
+		vm.call(operands[0])
+		break
+	case 18:
+		if err := vm.ret(); err != nil {
+			return false, err
+		}
+		break
+	case 19:
+		vm.out(operands[0])
+		break
+	case 20:
+		if err := vm.in(operands[0]); err != nil {
+			return false, err
 		}
+		break
+	case 21: // no-op
+		vm.inner.Index++
+		break
 	}
+	vm.inner.Steps++
+	return false, nil
 }
 
 func (vm *VirtualMachineDebugger) print(op string, args ...uint16) {
@@ -117,13 +162,13 @@ func (vm *VirtualMachineDebugger) print(op string, args ...uint16) {
 		return
 	}
 
-	fmt.Println("vmreg:", vm.inner.Register, "vmstack", vm.inner.Stack.inner)
+	fmt.Fprintln(vm.log, "vmreg:", vm.inner.Register, "vmstack", vm.inner.Stack.inner)
 
-	fmt.Printf("%v: %v ", vm.inner.Index, op)
+	fmt.Fprintf(vm.log, "%v: %v ", vm.inner.Index, op)
 	for _, arg := range args {
-		fmt.Printf("%v ", arg)
+		fmt.Fprintf(vm.log, "%v ", arg)
 	}
-	fmt.Print("\n")
+	fmt.Fprint(vm.log, "\n")
 }
 
 // set register <a> to the value of <b>
@@ -186,9 +231,9 @@ func (vm *VirtualMachineDebugger) mult(a uint16, b uint16, c uint16) {
 }
 
 // store into <a> the remainder of <b> divided by <c>
-func (vm *VirtualMachineDebugger) mod(a uint16, b uint16, c uint16) {
+func (vm *VirtualMachineDebugger) mod(a uint16, b uint16, c uint16) error {
 	vm.print("mod", a, b, c)
-	vm.inner.mod(a, b, c)
+	return vm.inner.mod(a, b, c)
 }
 
 // stores into <a> the bitwise and of <b> and <c>
@@ -210,15 +255,15 @@ func (vm *VirtualMachineDebugger) not(a uint16, b uint16) {
 }
 
 // read memory at address <b> and write it to <a>
-func (vm *VirtualMachineDebugger) rmem(a uint16, b uint16) {
+func (vm *VirtualMachineDebugger) rmem(a uint16, b uint16) error {
 	vm.print("rmem", a, b)
-	vm.inner.rmem(a, b)
+	return vm.inner.rmem(a, b)
 }
 
 // write the value from <b> into memory at address <a>
-func (vm *VirtualMachineDebugger) wmem(a uint16, b uint16) {
+func (vm *VirtualMachineDebugger) wmem(a uint16, b uint16) error {
 	vm.print("wmem", a, b)
-	vm.inner.wmem(a, b)
+	return vm.inner.wmem(a, b)
 }
 
 // write the address of the next instruction to the stack and jump to <a>
@@ -234,14 +279,14 @@ func (vm *VirtualMachineDebugger) ret() error {
 }
 
 // read a character from the terminal and write its ascii code to <a>
-func (vm *VirtualMachineDebugger) in(a uint16) {
+func (vm *VirtualMachineDebugger) in(a uint16) error {
 	vm.outputLog = true
 	vm.print("in", a)
-	vm.inner.in(a)
+	return vm.inner.in(a)
 }
 
 // write the character represented by ascii code <a> to the terminal
 func (vm *VirtualMachineDebugger) out(a uint16) {
 	vm.print("out", a)
-	vm.inner.Index += 2
+	vm.inner.out(a)
 }
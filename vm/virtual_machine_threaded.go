@@ -0,0 +1,325 @@
+package VirtualMachine
+
+import (
+	"fmt"
+	"os"
+)
+
+// An operand with its kind resolved when the instruction is decoded, so executing it needs no range checks.
+type operand struct {
+	value    uint16
+	register bool
+}
+
+// A pre-decoded instruction. One that cannot be executed gets an op no engine knows, with the reason kept in faults.
+type instruction struct {
+	op      uint16
+	decoded bool
+	length  uint16
+	args    [3]operand
+}
+
+const invalidOp = 0xffff
+
+type UnknownOperationError struct {
+	Op    uint16
+	Index uint16
+}
+
+func (err *UnknownOperationError) Error() string {
+	return fmt.Sprintf("Unknown operation: %v at index %v", err.Op, err.Index)
+}
+
+// ThreadedVirtualMachine runs the same program as the VirtualMachine it wraps, but decodes every instruction only once.
+// Decoded instructions are kept in a dense array indexed by address and thrown away when the guest writes to the
+// memory they were decoded from, or all at once when a hack, a command or Restore may have changed Memory.
+//
+// A CodeMap given to TrackCode sees each instruction executed when it is decoded, which is enough as writing to an
+// instruction has it decoded again.
+type ThreadedVirtualMachine struct {
+	inner  *VirtualMachine
+	code   [32768]instruction
+	faults map[uint16]error
+	// The code map the decoded instructions have been recorded in.
+	tracked *CodeMap
+	// The generation of the inner VM's Memory the instructions were decoded from.
+	generation uint64
+}
+
+func LoadThreaded(file *os.File) (*ThreadedVirtualMachine, error) {
+	vm, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewThreaded(vm), nil
+}
+
+// NewThreaded wraps vm, continuing from its current state.
+func NewThreaded(vm *VirtualMachine) *ThreadedVirtualMachine {
+	return &ThreadedVirtualMachine{inner: vm, faults: map[uint16]error{}, generation: vm.generation}
+}
+
+// Reset points the engine at inner, continuing from its current state. The instructions decoded from pages of Memory
+// that inner shares with the VM the engine ran before are kept, so an engine that runs one clone of a VM after another
+// only decodes again the code the clones wrote to.
+func (vm *ThreadedVirtualMachine) Reset(inner *VirtualMachine) {
+	previous := vm.inner
+	vm.inner = inner
+	// What was decoded may not match the previous VM's own Memory any more.
+	if previous.generation != vm.generation || inner.codeMap != vm.tracked {
+		vm.code = [32768]instruction{}
+		vm.tracked = inner.codeMap
+	}
+	vm.generation = inner.generation
+
+	for index := range inner.Memory.pages {
+		if inner.Memory.pages[index] == previous.Memory.pages[index] {
+			continue
+		}
+		// The instructions that start up to three words before the page can reach into it.
+		start := index*pageSize - 3
+		if start < 0 {
+			start = 0
+		}
+		for address := start; address < (index+1)*pageSize; address++ {
+			vm.code[address].decoded = false
+		}
+	}
+}
+
+func (vm *ThreadedVirtualMachine) Run() (err error) {
+	defer func() {
+		if err != nil {
+			fmt.Printf("Fault index: %v\n", vm.inner.Index)
+		}
+	}()
+
+	_, err = vm.execute(-1)
+	return err
+}
+
+// Step executes a single instruction, decoding it first if necessary. Returns true once the VM has halted.
+func (vm *ThreadedVirtualMachine) Step() (bool, error) {
+	return vm.execute(1)
+}
+
+// Executes up to steps instructions, or until the VM halts or fails if steps is negative. Run and Step share this loop
+// so that running does not pay for a call per instruction.
+func (vm *ThreadedVirtualMachine) execute(steps int) (bool, error) {
+	inner := vm.inner
+
+	// Instructions that fail are not counted, as they are retried if the VM is resumed.
+	executed := uint64(0)
+	defer func() {
+		inner.Steps += executed
+	}()
+
+	// Instructions decoded before the code map was attached have not been recorded in it.
+	if inner.codeMap != vm.tracked {
+		vm.code = [32768]instruction{}
+		vm.tracked = inner.codeMap
+	}
+	vm.checkGeneration()
+
+	for ; steps != 0; steps, executed = steps-1, executed+1 {
+		if len(inner.hooks) > 0 {
+			if hooked, err := inner.runHook(); hooked {
+				if err != nil {
+					return false, err
+				}
+				continue
+			}
+		}
+
+		if int(inner.Index) >= len(vm.code) {
+			return false, &InvalidAddressError{Address: inner.Index, Index: inner.Index}
+		}
+		ins := &vm.code[inner.Index]
+		if !ins.decoded {
+			vm.decode(inner.Index)
+			if inner.codeMap != nil && ins.op != invalidOp {
+				inner.Steps += executed
+				executed = 0
+				inner.codeMap.execute(inner, ins.length)
+			}
+		}
+		args := &ins.args
+
+		switch ins.op {
+		case 0:
+			executed++
+			return true, nil
+		case 1:
+			vm.store(args[0], vm.value(args[1]))
+		case 2:
+			inner.Stack.Push(vm.value(args[0]))
+		case 3:
+			val, err := inner.Stack.Pop()
+			if err != nil {
+				return false, err
+			}
+			vm.store(args[0], val)
+		case 4:
+			vm.store(args[0], flag(vm.value(args[1]) == vm.value(args[2])))
+		case 5:
+			vm.store(args[0], flag(vm.value(args[1]) > vm.value(args[2])))
+		case 6:
+			inner.Index = vm.value(args[0])
+			continue
+		case 7:
+			if vm.value(args[0]) != 0 {
+				inner.Index = vm.value(args[1])
+				continue
+			}
+		case 8:
+			if vm.value(args[0]) == 0 {
+				inner.Index = vm.value(args[1])
+				continue
+			}
+		case 9:
+			vm.store(args[0], (vm.value(args[1])+vm.value(args[2]))%32768)
+		case 10:
+			vm.store(args[0], (vm.value(args[1])*vm.value(args[2]))%32768)
+		case 11:
+			divisor := vm.value(args[2])
+			if divisor == 0 {
+				return false, &DivisionByZeroError{Index: inner.Index}
+			}
+			vm.store(args[0], vm.value(args[1])%divisor)
+		case 12:
+			vm.store(args[0], vm.value(args[1])&vm.value(args[2]))
+		case 13:
+			vm.store(args[0], vm.value(args[1])|vm.value(args[2]))
+		case 14:
+			vm.store(args[0], ^vm.value(args[1])&32767)
+		case 15:
+			address := vm.value(args[1])
+			if int(address) >= MemorySize {
+				return false, &InvalidAddressError{Address: address, Index: inner.Index}
+			}
+			vm.store(args[0], inner.Memory.Get(address))
+		case 16:
+			address := vm.value(args[0])
+			if int(address) >= MemorySize {
+				return false, &InvalidAddressError{Address: address, Index: inner.Index}
+			}
+			if inner.codeMap != nil {
+				// The code map reports how many instructions came before a write.
+				inner.Steps += executed
+				executed = 0
+			}
+			vm.store(operand{value: address}, vm.value(args[1]))
+		case 17:
+			inner.Stack.Push(inner.Index + 2)
+			inner.Index = vm.value(args[0])
+			continue
+		case 18:
+			val, err := inner.Stack.Pop()
+			if err != nil {
+				return false, err
+			}
+			inner.Index = val
+			continue
+		case 19:
+			char := vm.value(args[0])
+			fmt.Fprintf(inner.output, "%c", char)
+			if len(inner.observers) > 0 {
+				inner.Steps += executed
+				executed = 0
+				inner.notify(char)
+			}
+		case 20:
+			// Recording and replaying sessions need the number of instructions executed before this one.
+			inner.Steps += executed
+			executed = 0
+			err := inner.in(args[0].encode())
+			if !args[0].register {
+				vm.invalidate(args[0].value)
+			}
+			// The hacks and commands can patch or replace the whole of Memory.
+			vm.checkGeneration()
+			if err != nil {
+				return false, err
+			}
+			continue
+		case 21:
+		default:
+			return false, vm.faults[inner.Index]
+		}
+
+		inner.Index += ins.length
+	}
+	return false, nil
+}
+
+func (vm *ThreadedVirtualMachine) value(arg operand) uint16 {
+	if arg.register {
+		return vm.inner.Register[arg.value]
+	}
+	return arg.value
+}
+
+func (arg operand) encode() uint16 {
+	if arg.register {
+		return arg.value + 32768
+	}
+	return arg.value
+}
+
+func flag(condition bool) uint16 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// Decodes the instruction at address into the cache.
+func (vm *ThreadedVirtualMachine) decode(address uint16) {
+	if err := checkInstruction(&vm.inner.Memory, address); err != nil {
+		vm.code[address] = instruction{op: invalidOp, decoded: true}
+		vm.faults[address] = err
+		return
+	}
+
+	op := vm.inner.Memory.Get(address)
+	ins := instruction{op: op, decoded: true, length: 1 + OpArgs[op]}
+	for i := uint16(0); i < OpArgs[op]; i++ {
+		raw := vm.inner.Memory.Get(address + 1 + i)
+		index, isRegistry := tryGetRegistryAddress(raw)
+		ins.args[i] = operand{value: index, register: isRegistry}
+	}
+
+	vm.code[address] = ins
+}
+
+// Writes val to a register or to Memory, dropping every decoded instruction that covers the written address.
+func (vm *ThreadedVirtualMachine) store(destination operand, val uint16) {
+	if destination.register {
+		vm.inner.Register[destination.value] = val
+		return
+	}
+	vm.storeMemory(destination.value, val)
+}
+
+// Kept apart from store so that storing to a register, by far the most common case, stays small enough to inline.
+func (vm *ThreadedVirtualMachine) storeMemory(address uint16, val uint16) {
+	vm.inner.setMemory(address, val)
+	vm.invalidate(address)
+}
+
+// Drops every decoded instruction that covers address. The longest instruction is four words, so only the ones
+// starting up to three words earlier can include it.
+func (vm *ThreadedVirtualMachine) invalidate(address uint16) {
+	for i := uint16(0); i < 4 && i <= address; i++ {
+		vm.code[address-i].decoded = false
+	}
+}
+
+// Drops everything decoded if Memory has changed behind the engine's back since it was decoded.
+func (vm *ThreadedVirtualMachine) checkGeneration() {
+	if vm.generation != vm.inner.generation {
+		vm.code = [32768]instruction{}
+		vm.generation = vm.inner.generation
+	}
+}
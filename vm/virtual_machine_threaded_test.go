@@ -0,0 +1,174 @@
+package VirtualMachine
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// The teleporter confirmation function from notes/teleporter.txt, moved to address 12 and called with r0, r1 and r7
+// set to a, b and c.
+func confirmation(a uint16, b uint16, c uint16) []uint16 {
+	return []uint16{
+		// 0: set r0 a
+		1, 32768, a,
+		// 3: set r1 b
+		1, 32769, b,
+		// 6: set r7 c
+		1, 32775, c,
+		// 9: call 12
+		17, 12,
+		// 11: halt
+		0,
+		// 12: jt r0 20
+		7, 32768, 20,
+		// 15: add r0 r1 1
+		9, 32768, 32769, 1,
+		// 19: ret
+		18,
+		// 20: jt r1 33
+		7, 32769, 33,
+		// 23: add r0 r0 32767
+		9, 32768, 32768, 32767,
+		// 27: set r1 r7
+		1, 32769, 32775,
+		// 30: call 12
+		17, 12,
+		// 32: ret
+		18,
+		// 33: push r0
+		2, 32768,
+		// 35: add r1 r1 32767
+		9, 32769, 32769, 32767,
+		// 39: call 12
+		17, 12,
+		// 41: set r1 r0
+		1, 32769, 32768,
+		// 44: pop r0
+		3, 32768,
+		// 46: add r0 r0 32767
+		9, 32768, 32768, 32767,
+		// 50: call 12
+		17, 12,
+		// 52: ret
+		18,
+	}
+}
+
+func TestThreadedMatchesRun(t *testing.T) {
+	program := confirmation(3, 2, 3)
+
+	expected := New(program)
+	if err := expected.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := New(program)
+	if err := NewThreaded(actual).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected.Register != actual.Register {
+		t.Errorf("expected registers %v, got %v", expected.Register, actual.Register)
+	}
+	if expected.Index != actual.Index {
+		t.Errorf("expected to halt at %v, got %v", expected.Index, actual.Index)
+	}
+}
+
+func TestThreadedInput(t *testing.T) {
+	// 0: in r0, 2: out r0, 4: jmp 0
+	vm := New([]uint16{20, 32768, 19, 32768, 6, 0})
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader("a\npatch\nb\n"), &output)
+	vm.AddCommand("patch", func(vm *VirtualMachine, args []string, output io.Writer) {
+		// out r0 becomes out 'X'
+		vm.Memory.Set(3, 'X')
+	})
+	engine := NewThreaded(vm)
+
+	// Reading a character leaves what has been decoded alone.
+	for i := 0; i < 4; i++ {
+		if _, err := engine.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !engine.code[2].decoded || !engine.code[4].decoded {
+		t.Error("expected the instructions to stay decoded after reading input")
+	}
+
+	// A command that patches Memory has it decoded again.
+	if err := engine.Run(); err != io.EOF {
+		t.Fatalf("expected to run out of input, got %v", err)
+	}
+	if output.String() != "a\nXX" {
+		t.Errorf("expected the patched output, got %q", output.String())
+	}
+
+	// 0: in 3, 2: out 'A', 4: jmp 0, so that input lands in the operand of the out after it.
+	vm = New([]uint16{20, 3, 19, 'A', 6, 0})
+	output.Reset()
+	vm.SetIO(strings.NewReader("ab"), &output)
+	if err := NewThreaded(vm).Run(); err != io.EOF {
+		t.Fatalf("expected to run out of input, got %v", err)
+	}
+	if output.String() != "ab" {
+		t.Errorf("expected the input to be printed back, got %q", output.String())
+	}
+}
+
+func TestThreadedReset(t *testing.T) {
+	base := New(nil)
+	base.Memory.Copy(0, []uint16{
+		// 0: jf r7 6
+		8, 32775, 6,
+		// 3: wmem 7 'B'
+		16, 7, 'B',
+		// 6: out 'A'
+		19, 'A',
+		// 8: jmp 600
+		6, 600,
+	})
+	// 600: halt
+	base.Memory.Set(600, 0)
+
+	output := strings.Builder{}
+	first := base.Clone()
+	first.SetIO(strings.NewReader(""), &output)
+	first.Register[7] = 1
+	engine := NewThreaded(first)
+	if err := engine.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := base.Clone()
+	second.SetIO(strings.NewReader(""), &output)
+	engine.Reset(second)
+	if engine.code[6].decoded || !engine.code[600].decoded {
+		t.Error("expected only the code on the page the first clone wrote to to be dropped")
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "BA" {
+		t.Errorf("expected the second clone to run its own code, got %q", output.String())
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	program := confirmation(3, 2, 3)
+	for i := 0; i < b.N; i++ {
+		if err := New(program).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkThreadedRun(b *testing.B) {
+	program := confirmation(3, 2, 3)
+	for i := 0; i < b.N; i++ {
+		if err := NewThreaded(New(program)).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
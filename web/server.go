@@ -0,0 +1,389 @@
+// Package web serves VM sessions to browsers: a WebSocket carries the game's input and output, and a small REST API
+// reads the registers, the stack and memory, saves and restores snapshots and patches memory and registers. Any number
+// of pages can watch the same session, and any of them can type into it. An embedded page offers all of it.
+//
+// The API, with ids and names as path segments:
+//
+//	GET  /api/sessions                              sessions with their state
+//	POST /api/sessions                              starts a new session
+//	GET  /api/sessions/{id}                         registers, program counter, steps and state
+//	GET  /api/sessions/{id}/stack                   the stack, from the bottom
+//	GET  /api/sessions/{id}/memory?start=N&length=N words of memory, 256 unless length says otherwise
+//	GET  /api/sessions/{id}/snapshots               names of the snapshots
+//	POST /api/sessions/{id}/snapshots               saves a snapshot, {"name": "before"}
+//	POST /api/sessions/{id}/snapshots/{name}        restores a snapshot
+//	POST /api/sessions/{id}/patches                 writes {"address": 5489, "values": [21, 21]} to memory, or
+//	                                                {"register": 7, "values": [25734]} to a register
+//	GET  /api/sessions/{id}/ws                      the WebSocket
+//
+// The server is meant for the loopback interface: it trusts whoever can reach it. It only answers requests addressed
+// to a loopback name or address, so that pages of other sites cannot rebind their own name to it, and refuses requests
+// that come from pages of another origin. Its sessions run with the hacks of the VM turned off, as some of them read
+// and write files.
+package web
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+//go:embed index.html
+var page []byte
+
+// Words returned by the memory endpoint unless length says otherwise.
+const defaultLength = 256
+
+// Server serves sessions that all start as copies of the same VM.
+type Server struct {
+	template *VirtualMachine.VirtualMachine
+	// Called with the copy of the template of every new session before it runs, if it is set, to add commands to it.
+	Setup func(vm *VirtualMachine.VirtualMachine)
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	next     int
+	quit     chan struct{}
+}
+
+// NewServer serves sessions that start from the state template is in. template is only ever copied.
+func NewServer(template *VirtualMachine.VirtualMachine) *Server {
+	return &Server{template: template, sessions: map[string]*Session{}, next: 1, quit: make(chan struct{})}
+}
+
+// NewSession starts a session from a copy of the template, which runs until it wants input.
+func (server *Server) NewSession() *Session {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	vm := server.template.Clone()
+	vm.DisableHacks()
+	if server.Setup != nil {
+		server.Setup(vm)
+	}
+	session := newSession(strconv.Itoa(server.next), vm)
+	server.next++
+	server.sessions[session.ID] = session
+	go session.runner.Run(server.quit)
+	return session
+}
+
+// Session returns the session with id, or nil if there is none.
+func (server *Server) Session(id string) *Session {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.sessions[id]
+}
+
+// Close stops every session. WebSockets stay open until their pages leave.
+func (server *Server) Close() {
+	close(server.quit)
+}
+
+// SessionInfo is what the API says about a session.
+type SessionInfo struct {
+	ID       string    `json:"id"`
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Steps    uint64    `json:"steps"`
+	Index    uint16    `json:"pc"`
+	Register [8]uint16 `json:"registers"`
+	Viewers  int       `json:"viewers"`
+}
+
+func (session *Session) info() SessionInfo {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	info := SessionInfo{
+		ID:       session.ID,
+		State:    string(session.runner.State),
+		Steps:    session.vm.Steps,
+		Index:    session.vm.Index,
+		Register: session.vm.Register,
+		Viewers:  len(session.viewers),
+	}
+	if session.runner.Err != nil {
+		info.Error = session.runner.Err.Error()
+	}
+	return info
+}
+
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if !Loopback(request.Host) {
+		http.Error(writer, "only requests for a loopback host are served", http.StatusForbidden)
+		return
+	}
+	if !sameOrigin(request) {
+		http.Error(writer, "requests from other pages are not allowed", http.StatusForbidden)
+		return
+	}
+	if request.URL.Path == "/" {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Write(page)
+		return
+	}
+
+	path := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	if len(path) < 2 || path[0] != "api" || path[1] != "sessions" {
+		http.NotFound(writer, request)
+		return
+	}
+	if len(path) == 2 {
+		server.serveSessions(writer, request)
+		return
+	}
+	session := server.Session(path[2])
+	if session == nil {
+		http.Error(writer, fmt.Sprintf("no session %q", path[2]), http.StatusNotFound)
+		return
+	}
+
+	switch resource := strings.Join(path[3:], "/"); {
+	case resource == "" && request.Method == http.MethodGet:
+		writeJSON(writer, http.StatusOK, session.info())
+	case resource == "stack" && request.Method == http.MethodGet:
+		session.mu.Lock()
+		values := session.vm.Stack.Values()
+		session.mu.Unlock()
+		writeJSON(writer, http.StatusOK, values)
+	case resource == "memory" && request.Method == http.MethodGet:
+		serveMemory(writer, request, session)
+	case resource == "snapshots" && request.Method == http.MethodGet:
+		writeJSON(writer, http.StatusOK, session.snapshotNames())
+	case resource == "snapshots" && request.Method == http.MethodPost:
+		saveSnapshot(writer, request, session)
+	case len(path) == 5 && path[3] == "snapshots" && request.Method == http.MethodPost:
+		restoreSnapshot(writer, session, path[4])
+	case resource == "patches" && request.Method == http.MethodPost:
+		applyPatch(writer, request, session)
+	case resource == "ws" && request.Method == http.MethodGet:
+		serveWebSocket(writer, request, session)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+// Loopback reports whether host, a name or an IP address with or without a port, can only be reached from this
+// machine.
+func Loopback(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Reports whether request comes from one of the server's own pages, or from something that is not a page at all.
+// Browsers send Origin with every cross-origin request and with WebSocket handshakes.
+func sameOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == request.Host
+}
+
+func (server *Server) serveSessions(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		server.mu.Lock()
+		sessions := make([]*Session, 0, len(server.sessions))
+		for _, session := range server.sessions {
+			sessions = append(sessions, session)
+		}
+		server.mu.Unlock()
+
+		infos := make([]SessionInfo, len(sessions))
+		for i, session := range sessions {
+			infos[i] = session.info()
+		}
+		sort.Slice(infos, func(i, j int) bool {
+			a, _ := strconv.Atoi(infos[i].ID)
+			b, _ := strconv.Atoi(infos[j].ID)
+			return a < b
+		})
+		writeJSON(writer, http.StatusOK, infos)
+	case http.MethodPost:
+		writeJSON(writer, http.StatusCreated, server.NewSession().info())
+	default:
+		http.Error(writer, "expected GET or POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// Memory is a range of words, as the memory endpoint returns it.
+type Memory struct {
+	Start  uint16   `json:"start"`
+	Values []uint16 `json:"values"`
+}
+
+func serveMemory(writer http.ResponseWriter, request *http.Request, session *Session) {
+	start, err := queryNumber(request, "start", 0)
+	if err != nil || start >= VirtualMachine.MemorySize {
+		http.Error(writer, "start must be an address", http.StatusBadRequest)
+		return
+	}
+	length, err := queryNumber(request, "length", defaultLength)
+	if err != nil {
+		http.Error(writer, "length must be a number", http.StatusBadRequest)
+		return
+	}
+	if start+length > VirtualMachine.MemorySize {
+		length = VirtualMachine.MemorySize - start
+	}
+
+	memory := Memory{Start: uint16(start), Values: make([]uint16, length)}
+	session.mu.Lock()
+	for i := range memory.Values {
+		memory.Values[i] = session.vm.Memory.Get(uint16(start + i))
+	}
+	session.mu.Unlock()
+	writeJSON(writer, http.StatusOK, memory)
+}
+
+// Returns the query parameter name of request as a number, or fallback if it is missing.
+func queryNumber(request *http.Request, name string, fallback int) (int, error) {
+	text := request.URL.Query().Get(name)
+	if text == "" {
+		return fallback, nil
+	}
+	number, err := strconv.ParseUint(text, 10, 16)
+	return int(number), err
+}
+
+func (session *Session) snapshotNames() []string {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	names := make([]string, 0, len(session.snapshots))
+	for name := range session.snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func saveSnapshot(writer http.ResponseWriter, request *http.Request, session *Session) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.Name == "" || strings.Contains(body.Name, "/") {
+		http.Error(writer, `expected {"name": "..."} without slashes in the name`, http.StatusBadRequest)
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	snapshot, err := session.vm.Snapshot()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.snapshots[body.Name] = snapshot
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Restores the snapshot, after which the session runs as it did when the snapshot was saved, with input already
+// received.
+func restoreSnapshot(writer http.ResponseWriter, session *Session, name string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	snapshot, ok := session.snapshots[name]
+	if !ok {
+		http.Error(writer, fmt.Sprintf("no snapshot %q", name), http.StatusNotFound)
+		return
+	}
+	if err := session.vm.Restore(snapshot); err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.changed()
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Patch writes Values to memory from Address, or to Register.
+type Patch struct {
+	Address  *uint16  `json:"address"`
+	Register *uint16  `json:"register"`
+	Values   []uint16 `json:"values"`
+}
+
+func applyPatch(writer http.ResponseWriter, request *http.Request, session *Session) {
+	var patch Patch
+	if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	switch {
+	case patch.Address != nil && patch.Register == nil &&
+		int(*patch.Address)+len(patch.Values) <= VirtualMachine.MemorySize:
+		session.vm.Patch(*patch.Address, patch.Values)
+	case patch.Register != nil && patch.Address == nil && *patch.Register < 8 && len(patch.Values) == 1:
+		session.vm.Register[*patch.Register] = patch.Values[0]
+	default:
+		http.Error(writer, "expected values for an address within memory, or a single value for a register from 0 to 7",
+			http.StatusBadRequest)
+		return
+	}
+	session.changed()
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Gives a VM that halted or failed another chance once its state was changed. Call with mu held.
+func (session *Session) changed() {
+	runner := session.runner
+	if runner.State == VirtualMachine.Halted || runner.State == VirtualMachine.Failed {
+		runner.State, runner.Err = VirtualMachine.Running, nil
+		runner.Wake()
+	}
+}
+
+// Sends the output of session to the WebSocket, and the lines it receives to the game.
+func serveWebSocket(writer http.ResponseWriter, request *http.Request, session *Session) {
+	ws, err := upgrade(writer, request)
+	if err != nil {
+		return
+	}
+	defer ws.close()
+
+	watcher := session.watch()
+	defer session.unwatch(watcher)
+	go func() {
+		// Output is sent as binary, as the game prints bytes and a line may end in the middle of a character. The
+		// loop ends once the page leaves or falls too far behind, and either way the connection is done.
+		for range watcher.ready {
+			if pending, _ := session.take(watcher); len(pending) > 0 && ws.write(opBinary, pending) != nil {
+				break
+			}
+		}
+		ws.close()
+	}()
+
+	for {
+		line, err := ws.read()
+		if err != nil {
+			return
+		}
+		session.Input(string(line))
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"sync"
+
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Bytes of output kept for viewers that connect later.
+const maxHistory = 64 * 1024
+
+// Session is a VM that runs whenever it has input, with the output it printed so far and the states saved from it.
+// Everything in it is guarded by mu, which the runner holds while it runs a batch of instructions, so the VM's output
+// arrives with mu held.
+type Session struct {
+	ID string
+
+	mu     sync.Mutex
+	vm     *VirtualMachine.VirtualMachine
+	runner *VirtualMachine.Runner
+
+	history   []byte
+	viewers   map[*viewer]bool
+	snapshots map[string][]byte
+}
+
+// A WebSocket the output of a session is sent to. The VM adds to pending and signals ready, and the WebSocket takes
+// what is pending whenever ready fires, so that the VM never waits for it.
+type viewer struct {
+	pending []byte
+	ready   chan struct{}
+}
+
+func newSession(id string, vm *VirtualMachine.VirtualMachine) *Session {
+	session := &Session{
+		ID:        id,
+		vm:        vm,
+		viewers:   map[*viewer]bool{},
+		snapshots: map[string][]byte{},
+	}
+	session.runner = VirtualMachine.NewRunner(vm, &session.mu, (*sessionOutput)(session))
+	return session
+}
+
+// Input queues line for the game, which reads it as if it was typed.
+func (session *Session) Input(line string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line += "\n"
+	}
+	session.runner.Input(line)
+}
+
+// Starts sending the output of the session to a new viewer, beginning with the output kept from before.
+func (session *Session) watch() *viewer {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	watcher := &viewer{ready: make(chan struct{}, 1)}
+	session.viewers[watcher] = true
+	session.send(watcher, session.history)
+	return watcher
+}
+
+// Returns the output pending for watcher, and whether it is still watching.
+func (session *Session) take(watcher *viewer) ([]byte, bool) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	pending := watcher.pending
+	watcher.pending = nil
+	return pending, session.viewers[watcher]
+}
+
+// Stops sending output to watcher and closes its ready channel, unless that already happened.
+func (session *Session) unwatch(watcher *viewer) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.drop(watcher)
+}
+
+// Adds data to the output pending for watcher, dropping it if it fell too far behind. Call with mu held.
+func (session *Session) send(watcher *viewer, data []byte) {
+	watcher.pending = append(watcher.pending, data...)
+	if len(watcher.pending) > maxHistory {
+		session.drop(watcher)
+		return
+	}
+	select {
+	case watcher.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (session *Session) drop(watcher *viewer) {
+	if session.viewers[watcher] {
+		delete(session.viewers, watcher)
+		close(watcher.ready)
+	}
+}
+
+// sessionOutput keeps what the VM prints for viewers that connect later and sends it to the ones connected. It is
+// called with mu held.
+type sessionOutput Session
+
+func (output *sessionOutput) Write(data []byte) (int, error) {
+	session := (*Session)(output)
+	session.history = append(session.history, data...)
+	if len(session.history) > maxHistory {
+		session.history = append([]byte{}, session.history[len(session.history)-maxHistory:]...)
+	}
+	for watcher := range session.viewers {
+		session.send(watcher, data)
+	}
+	return len(data), nil
+}
@@ -0,0 +1,284 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ckyong/synacor/assembler"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Greets and then echoes what it reads.
+var echo = assembler.MustAssemble(`
+	out 'h'
+	out 'i'
+	out 10
+loop:
+	in r0
+	out r0
+	jmp loop
+`)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	server := NewServer(VirtualMachine.New(echo))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Close()
+	})
+	return server, httpServer
+}
+
+// Waits for the session to run out of input.
+func waitForInput(t *testing.T, session *Session) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for session.info().State != string(VirtualMachine.WaitingForInput) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the session to wait for input, it is %v", session.info().State)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// The client end of a WebSocket, just enough to test the server.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, httpServer *httptest.Server, path string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", httpServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The key and accept header of the example in RFC 6455.
+	fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: %v\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path, conn.RemoteAddr())
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); response.StatusCode != http.StatusSwitchingProtocols ||
+		accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected the handshake to succeed, got %v with %q", response.Status, accept)
+	}
+	return &client{conn: conn, reader: reader}
+}
+
+func (client *client) send(t *testing.T, opcode byte, message string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(message))}, mask...)
+	for i := range message {
+		frame = append(frame, message[i]^mask[i%4])
+	}
+	if _, err := client.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads frames until the messages received end with expected.
+func (client *client) expect(t *testing.T, expected string) {
+	t.Helper()
+	received := []byte{}
+	for !bytes.HasSuffix(received, []byte(expected)) {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(client.reader, header); err != nil {
+			t.Fatalf("expected %q, got %q and then %v", expected, received, err)
+		}
+		length := int(header[1])
+		if length == 126 {
+			extended := make([]byte, 2)
+			io.ReadFull(client.reader, extended)
+			length = int(binary.BigEndian.Uint16(extended))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(client.reader, payload); err != nil {
+			t.Fatal(err)
+		}
+		if header[0]&0x0f == opBinary {
+			received = append(received, payload...)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	session := server.NewSession()
+	waitForInput(t, session)
+
+	driver := dial(t, httpServer, "/api/sessions/1/ws")
+	watcher := dial(t, httpServer, "/api/sessions/1/ws")
+	driver.expect(t, "hi\n")
+	watcher.expect(t, "hi\n")
+
+	driver.send(t, opPing, "")
+	driver.send(t, opText, "look")
+	driver.expect(t, "look\n")
+	watcher.expect(t, "look\n")
+
+	// Those who come later see what they missed.
+	dial(t, httpServer, "/api/sessions/1/ws").expect(t, "hi\nlook\n")
+	if viewers := session.info().Viewers; viewers != 3 {
+		t.Errorf("expected 3 viewers, got %v", viewers)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	api := httpServer.URL + "/api/sessions"
+
+	var created SessionInfo
+	if status := post(t, api, "", &created); status != http.StatusCreated || created.ID != "1" {
+		t.Fatalf("expected session 1 to be created, got %v %+v", status, created)
+	}
+	session := server.Session("1")
+	waitForInput(t, session)
+
+	var sessions []SessionInfo
+	get(t, api, &sessions)
+	if len(sessions) != 1 || sessions[0].State != string(VirtualMachine.WaitingForInput) || sessions[0].Index != 6 {
+		t.Errorf("expected the session waiting at 6, got %+v", sessions)
+	}
+
+	if status := post(t, api+"/1/snapshots", `{"name": "start"}`, nil); status != http.StatusNoContent {
+		t.Errorf("expected the snapshot to be saved, got %v", status)
+	}
+	for _, patch := range []string{`{"address": 100, "values": [1, 2]}`, `{"register": 7, "values": [25734]}`} {
+		if status := post(t, api+"/1/patches", patch, nil); status != http.StatusNoContent {
+			t.Errorf("expected %v to be applied, got %v", patch, status)
+		}
+	}
+	var memory Memory
+	get(t, api+"/1/memory?start=100&length=3", &memory)
+	if !reflect.DeepEqual(memory, Memory{Start: 100, Values: []uint16{1, 2, 0}}) {
+		t.Errorf("expected the patch in memory, got %+v", memory)
+	}
+	var info SessionInfo
+	get(t, api+"/1", &info)
+	if info.Register[7] != 25734 {
+		t.Errorf("expected r7 to be patched, got %v", info.Register)
+	}
+
+	var names []string
+	get(t, api+"/1/snapshots", &names)
+	if !reflect.DeepEqual(names, []string{"start"}) {
+		t.Errorf("expected the snapshot to be listed, got %v", names)
+	}
+	if status := post(t, api+"/1/snapshots/start", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected the snapshot to be restored, got %v", status)
+	}
+	get(t, api+"/1/memory?start=100&length=2", &memory)
+	get(t, api+"/1", &info)
+	if !reflect.DeepEqual(memory.Values, []uint16{0, 0}) || info.Register[7] != 0 {
+		t.Errorf("expected the patches to be undone, got %v and %v", memory.Values, info.Register)
+	}
+
+	for _, bad := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/2", "", http.StatusNotFound},
+		{http.MethodPost, "/1/snapshots/missing", "", http.StatusNotFound},
+		{http.MethodPost, "/1/patches", `{"address": 32767, "values": [1, 2]}`, http.StatusBadRequest},
+		{http.MethodPost, "/1/patches", `{"register": 8, "values": [1]}`, http.StatusBadRequest},
+		{http.MethodGet, "/1/memory?start=32768", "", http.StatusBadRequest},
+	} {
+		request, _ := http.NewRequest(bad.method, api+bad.path, strings.NewReader(bad.body))
+		if status := do(t, request, nil); status != bad.status {
+			t.Errorf("%v %v: expected %v, got %v", bad.method, bad.path, bad.status, status)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, api, nil)
+	request.Header.Set("Origin", "http://elsewhere.example")
+	if status := do(t, request, nil); status != http.StatusForbidden {
+		t.Errorf("expected a request from another page to be refused, got %v", status)
+	}
+
+	// A page whose name was rebound to the server sends its own name as the host, and its origin matches it.
+	request, _ = http.NewRequest(http.MethodPost, api, nil)
+	request.Host = "rebound.example"
+	request.Header.Set("Origin", "http://rebound.example")
+	if status := do(t, request, nil); status != http.StatusForbidden {
+		t.Errorf("expected a request for another host to be refused, got %v", status)
+	}
+}
+
+func TestHacksAreOff(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	waitForInput(t, server.NewSession())
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	driver := dial(t, httpServer, "/api/sessions/1/ws")
+	driver.send(t, opText, "xsave state "+path)
+	// The game reads the line instead, and echoes it.
+	driver.expect(t, "xsave state "+path+"\n")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no state to be saved, got %v", err)
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	for host, expected := range map[string]bool{
+		"127.0.0.1:8080":       true,
+		"127.0.0.2":            true,
+		"[::1]:8080":           true,
+		"::1":                  true,
+		"localhost:8080":       true,
+		"game.localhost":       true,
+		":8080":                false,
+		"0.0.0.0:8080":         false,
+		"192.168.1.10:8080":    false,
+		"rebound.example:8080": false,
+		"127.0.0.1.example":    false,
+	} {
+		if Loopback(host) != expected {
+			t.Errorf("%v: expected loopback to be %v", host, expected)
+		}
+	}
+}
+
+func get(t *testing.T, url string, value interface{}) int {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	return do(t, request, value)
+}
+
+func post(t *testing.T, url, body string, value interface{}) int {
+	request, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	return do(t, request, value)
+}
+
+// Sends request and decodes the response into value unless it is nil. Returns the status of the response.
+func do(t *testing.T, request *http.Request, value interface{}) int {
+	t.Helper()
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if value != nil {
+		if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response.StatusCode
+}
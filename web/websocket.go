@@ -0,0 +1,181 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Appended to the key of a handshake to compute the accept header, as RFC 6455 defines it.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Longest message a browser can send. Input is a line of text.
+const maxMessage = 4096
+
+// Opcodes of WebSocket frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var errNotMasked = errors.New("websocket: frame from the client is not masked")
+
+// websocket is the server end of a WebSocket connection, with just what viewing a session needs: reading text
+// messages and writing them. Writes may come from more than one goroutine.
+type websocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// Completes the WebSocket handshake of request and takes over its connection, or replies with an error if it is not
+// a handshake.
+func upgrade(writer http.ResponseWriter, request *http.Request) (*websocket, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if !headerHas(request.Header, "Connection", "upgrade") || !headerHas(request.Header, "Upgrade", "websocket") ||
+		request.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(writer, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("websocket: not a handshake")
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		http.Error(writer, "the connection cannot be taken over", http.StatusInternalServerError)
+		return nil, errors.New("websocket: the response cannot be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %v\r\n\r\n", base64.StdEncoding.EncodeToString(hash[:]))
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocket{conn: conn, reader: buffered.Reader}, nil
+}
+
+// Reports whether the comma separated header name has value among its values, ignoring case.
+func headerHas(header http.Header, name, value string) bool {
+	for _, line := range header.Values(name) {
+		for _, field := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the next text or binary message, answering pings on the way. Returns io.EOF once the client closes the
+// connection.
+func (ws *websocket) read() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opClose:
+			ws.write(opClose, nil)
+			return nil, io.EOF
+		case opPing:
+			if err := ws.write(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opText, opBinary, opContinuation:
+			if len(message)+len(payload) > maxMessage {
+				return nil, fmt.Errorf("websocket: message longer than %v bytes", maxMessage)
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("websocket: unknown opcode %v", opcode)
+		}
+	}
+}
+
+func (ws *websocket) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errNotMasked
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxMessage {
+		return false, 0, nil, fmt.Errorf("websocket: frame longer than %v bytes", maxMessage)
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(ws.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Sends payload in a single frame. The server does not mask its frames.
+func (ws *websocket) write(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (ws *websocket) close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,243 @@
+// Package world maps the rooms of the game by going through every exit of every room it finds, starting each move
+// from a snapshot of the VM taken when the room was first entered.
+package world
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+// Outcomes of sending a command. Waiting means the game asked for the next one, any other outcome means it did not
+// and that the exit the command took did not lead to a room.
+const (
+	Waiting = ""
+	Halted  = "halted"
+	NoRoom  = "no room"
+	TooLong = "too long"
+)
+
+type Room struct {
+	// Value of the room word while the player is in the room.
+	ID          uint16   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Items       []string `json:"items,omitempty"`
+	Exits       []Exit   `json:"exits"`
+}
+
+type Exit struct {
+	Name string `json:"name"`
+	// Room the exit leads to, if Outcome is empty.
+	To      uint16 `json:"to,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+}
+
+type Map struct {
+	// Room the exploration started in.
+	Start uint16           `json:"start"`
+	Rooms map[uint16]*Room `json:"rooms"`
+}
+
+// ParseRoom reads the last room the game described in output. Exits only have their names filled in.
+func ParseRoom(output string) (Room, bool) {
+	lines := strings.Split(strings.ReplaceAll(output, "\r", ""), "\n")
+
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "== ") && strings.HasSuffix(line, " ==") {
+			start = i
+		}
+	}
+	if start < 0 {
+		return Room{}, false
+	}
+
+	room := Room{Title: strings.TrimSuffix(strings.TrimPrefix(lines[start], "== "), " ==")}
+	var description []string
+	section := "description"
+	for _, line := range lines[start+1:] {
+		switch {
+		case line == "Things of interest here:":
+			section = "items"
+		case strings.HasPrefix(line, "There are ") && strings.HasSuffix(line, " exits:"), line == "There is 1 exit:":
+			section = "exits"
+		case strings.HasPrefix(line, "- ") && section == "items":
+			room.Items = append(room.Items, strings.TrimPrefix(line, "- "))
+		case strings.HasPrefix(line, "- ") && section == "exits":
+			room.Exits = append(room.Exits, Exit{Name: strings.TrimPrefix(line, "- ")})
+		case section == "description":
+			description = append(description, line)
+		case line == "":
+			section = ""
+		}
+	}
+	room.Description = strings.TrimSpace(strings.Join(description, "\n"))
+	return room, true
+}
+
+// Send types command into the game and runs vm until the game asks for the next one, which leaves vm on the in
+// instruction where it can be snapshotted. Returns what the game printed and, if it never asked again, Halted or
+// TooLong once budget instructions have gone by.
+func Send(vm *VirtualMachine.VirtualMachine, command string, budget uint64) (string, string, error) {
+	output := strings.Builder{}
+	vm.SetIO(strings.NewReader(command+"\n"), &output)
+
+	start := vm.Steps
+	for vm.Steps-start < budget {
+		halted, err := vm.Step()
+		if halted {
+			return output.String(), Halted, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return output.String(), Waiting, nil
+		}
+		if err != nil {
+			return output.String(), Waiting, err
+		}
+	}
+	return output.String(), TooLong, nil
+}
+
+// Explore maps every room that can be walked to from the one vm is in, which must be waiting for a command. Rooms are
+// told apart by the word at roomAddress, which holds a different value in every room, even in the ones that look the
+// same like the twisty passages. Every move may take up to budget instructions and is made on a clone of the VM in the
+// room it leaves, so vm itself is left waiting in the room it was in.
+func Explore(vm *VirtualMachine.VirtualMachine, roomAddress uint16, budget uint64) (*Map, error) {
+	output, outcome, err := Send(vm, "look", budget)
+	if err != nil {
+		return nil, err
+	}
+	start, ok := ParseRoom(output)
+	if outcome != Waiting || !ok {
+		return nil, fmt.Errorf("the game did not describe a room when asked to look: %q", output)
+	}
+	start.ID = vm.Memory.Get(roomAddress)
+
+	world := &Map{Start: start.ID, Rooms: map[uint16]*Room{start.ID: &start}}
+	forks := map[uint16]*VirtualMachine.VirtualMachine{start.ID: vm}
+
+	queue := []uint16{start.ID}
+	for len(queue) > 0 {
+		room := world.Rooms[queue[0]]
+		queue = queue[1:]
+
+		for i := range room.Exits {
+			exit := &room.Exits[i]
+			fork := forks[room.ID].Clone()
+
+			output, outcome, err := Send(fork, exit.Name, budget)
+			if err != nil {
+				return nil, fmt.Errorf("%v (%v), exit %v: %w", room.Title, room.ID, exit.Name, err)
+			}
+			next, ok := ParseRoom(output)
+			if outcome == Waiting && !ok {
+				outcome = NoRoom
+			}
+			if exit.Outcome = outcome; outcome != Waiting {
+				continue
+			}
+
+			exit.To = fork.Memory.Get(roomAddress)
+			if _, seen := world.Rooms[exit.To]; seen {
+				continue
+			}
+			next.ID = exit.To
+			world.Rooms[next.ID] = &next
+			forks[next.ID] = fork
+			queue = append(queue, next.ID)
+		}
+	}
+	return world, nil
+}
+
+// Path returns the fewest exits to take to walk from one room to another, trying the exits of every room in the
+// order the game lists them.
+func (world *Map) Path(from uint16, to uint16) ([]Exit, bool) {
+	if _, ok := world.Rooms[from]; !ok {
+		return nil, false
+	}
+
+	// How every room that has been reached was first entered.
+	via := map[uint16]Exit{}
+	previous := map[uint16]uint16{}
+	reached := map[uint16]bool{from: true}
+	queue := []uint16{from}
+	for len(queue) > 0 && !reached[to] {
+		room := world.Rooms[queue[0]]
+		queue = queue[1:]
+		for _, exit := range room.Exits {
+			if exit.Outcome != Waiting || reached[exit.To] {
+				continue
+			}
+			reached[exit.To] = true
+			via[exit.To] = exit
+			previous[exit.To] = room.ID
+			queue = append(queue, exit.To)
+		}
+	}
+	if !reached[to] {
+		return nil, false
+	}
+
+	var path []Exit
+	for id := to; id != from; id = previous[id] {
+		path = append([]Exit{via[id]}, path...)
+	}
+	return path, true
+}
+
+// Route turns a path into transcript entries that take each exit and expect the title of the room it leads to.
+func (world *Map) Route(path []Exit) []transcript.Entry {
+	var entries []transcript.Entry
+	for _, exit := range path {
+		entries = append(entries,
+			transcript.Entry{Kind: transcript.Command, Text: exit.Name},
+			transcript.Entry{Kind: transcript.Expect, Text: "== " + world.Rooms[exit.To].Title + " =="},
+		)
+	}
+	return entries
+}
+
+// WriteDot draws the map in the DOT language of Graphviz, with an edge for every exit. Exits that do not lead to a
+// room point at a node named after their outcome.
+func (world *Map) WriteDot(writer io.Writer) error {
+	text := strings.Builder{}
+	text.WriteString("digraph world {\n")
+	for _, id := range world.ids() {
+		room := world.Rooms[id]
+		shape := "box"
+		if id == world.Start {
+			shape = "doubleoctagon"
+		}
+		fmt.Fprintf(&text, "\tr%v [label=%q, shape=%v];\n", id, fmt.Sprintf("%v\n%v", room.Title, id), shape)
+	}
+	for _, id := range world.ids() {
+		for _, exit := range world.Rooms[id].Exits {
+			if exit.Outcome != Waiting {
+				fmt.Fprintf(&text, "\tr%v -> %q [label=%q, style=dashed];\n", id, exit.Outcome, exit.Name)
+				continue
+			}
+			fmt.Fprintf(&text, "\tr%v -> r%v [label=%q];\n", id, exit.To, exit.Name)
+		}
+	}
+	text.WriteString("}\n")
+
+	_, err := io.WriteString(writer, text.String())
+	return err
+}
+
+// Room IDs in ascending order.
+func (world *Map) ids() []uint16 {
+	ids := make([]uint16, 0, len(world.Rooms))
+	for id := range world.Rooms {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,109 @@
+package world
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ckyong/synacor/gamestate"
+	"github.com/ckyong/synacor/transcript"
+	VirtualMachine "github.com/ckyong/synacor/vm"
+)
+
+func TestParseRoom(t *testing.T) {
+	output := `Taken.
+
+== Foothills ==
+You find yourself standing at the base of an enormous mountain.
+
+A sign nearby reads "Keep out!"
+
+Things of interest here:
+- tablet
+- empty lantern
+
+There are 2 exits:
+- doorway
+- south
+
+What do you do?
+`
+	room, ok := ParseRoom(output)
+	if !ok {
+		t.Fatal("no room found")
+	}
+
+	expected := Room{
+		Title:       "Foothills",
+		Description: "You find yourself standing at the base of an enormous mountain.\n\nA sign nearby reads \"Keep out!\"",
+		Items:       []string{"tablet", "empty lantern"},
+		Exits:       []Exit{{Name: "doorway"}, {Name: "south"}},
+	}
+	if !reflect.DeepEqual(room, expected) {
+		t.Errorf("expected %+v, got %+v", expected, room)
+	}
+
+	if _, ok := ParseRoom("Taken.\n\nWhat do you do?\n"); ok {
+		t.Error("found a room in output without one")
+	}
+}
+
+func TestPath(t *testing.T) {
+	world := &Map{Start: 1, Rooms: map[uint16]*Room{
+		1: {ID: 1, Title: "A", Exits: []Exit{{Name: "east", To: 2}, {Name: "down", Outcome: Halted}}},
+		2: {ID: 2, Title: "B", Exits: []Exit{{Name: "west", To: 1}, {Name: "north", To: 3}}},
+		3: {ID: 3, Title: "C", Exits: []Exit{{Name: "south", To: 2}}},
+	}}
+
+	path, ok := world.Path(1, 3)
+	if expected := []Exit{{Name: "east", To: 2}, {Name: "north", To: 3}}; !ok || !reflect.DeepEqual(path, expected) {
+		t.Errorf("expected %v, got %v", expected, path)
+	}
+	if _, ok := world.Path(1, 4); ok {
+		t.Error("found a path to a room that does not exist")
+	}
+
+	route := world.Route(path)
+	if len(route) != 4 || route[0].String() != "east" || route[3].String() != `expect "== C =="` {
+		t.Errorf("unexpected route %v", route)
+	}
+}
+
+func TestExplore(t *testing.T) {
+	file, err := os.Open("../resources/challenge.bin")
+	if err != nil {
+		t.Skip("challenge.bin is not available:", err)
+	}
+	vm, err := VirtualMachine.Load(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := vm.DumpMemory()
+
+	if err := transcript.NewPlayer(vm, nil, io.Discard).Play(vm); err != nil {
+		t.Fatal(err)
+	}
+	world, err := Explore(vm, gamestate.Challenge.Room, 10_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(world.Rooms) != 23 || world.Rooms[world.Start].Title != "Foothills" {
+		t.Fatalf("expected 23 rooms starting at the Foothills, got %v starting at %v", len(world.Rooms), world.Start)
+	}
+
+	// The first of the twisty passages, down the ladder from the passage off the moss cavern.
+	path, ok := world.Path(world.Start, 2377)
+	if !ok {
+		t.Fatal("no path to the twisty passages")
+	}
+
+	game := VirtualMachine.New(memory[:])
+	if err := transcript.NewPlayer(game, world.Route(path), io.Discard).Play(game); err != nil {
+		t.Fatal(err)
+	}
+	if game.Memory.Get(gamestate.Challenge.Room) != 2377 {
+		t.Errorf("the route ended in room %v", game.Memory.Get(gamestate.Challenge.Room))
+	}
+}